@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"video/config"
+	"video/core"
+	"video/model"
+	"video/pkg/collect"
+	"video/pkg/db"
+	"video/pkg/ingest"
+
+	"github.com/spf13/viper"
+)
+
+func main() {
+	sourceName := flag.String("source", "", "只采集指定名称的采集源，默认采集全部")
+	full := flag.Bool("full", false, "强制全量采集，忽略上次采集时间和未完成的断点")
+	flag.Parse()
+
+	viper.SetConfigName("config") // name of config file (without extension)
+	viper.SetConfigType("yaml")   // REQUIRED if the config file does not have the extension in the name
+	viper.AddConfigPath("etc/")   // path to look for the config file in
+	err := viper.ReadInConfig()   // Find and read the config file
+	if err != nil {               // Handle errors reading the config file
+		panic(fmt.Errorf("fatal error config file: %w", err))
+	}
+	var configGlobal config.ConfigGlobal
+	if err := viper.Unmarshal(&configGlobal); err != nil {
+		fmt.Printf("Unable to decode into struct, %v", err)
+		return
+	}
+	core.New().ConfigGlobal = configGlobal
+	if err := db.NewDBS().InitGorm(configGlobal.Mysql); err != nil {
+		log.Fatalf("数据库连接失败: %v", err)
+	}
+	core.New().DB = db.DBS
+	if err := model.CheckSearchColumns(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := core.New().DB.AutoMigrate(&model.CollectCheckpoint{}); err != nil {
+		log.Fatalf("创建采集断点表失败: %v", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	for _, source := range configGlobal.Sources {
+		if *sourceName != "" && source.Name != *sourceName {
+			continue
+		}
+		log.Printf("[%s] 开始采集: %s", source.Name, source.BaseUrl)
+		var submitter collect.Submitter = collect.NewIngestSubmitter(ingest.New(nil))
+		if source.SubmitUrl != "" {
+			httpSubmitter := collect.NewHttpSubmitter(source.SubmitUrl)
+			httpSubmitter.ApiKey = source.ApiKey
+			submitter = httpSubmitter
+		}
+		collector := collect.New(source, submitter)
+		collector.Checkpoints = collect.DBCheckpointStore{}
+		collector.Full = *full
+		stats, err := collector.Run(ctx)
+		if err != nil {
+			log.Printf("[%s] 采集失败: %v", source.Name, err)
+		}
+		log.Printf("[%s] 采集结束: h=%d, 起始页 %d, 页数 %d, 提交 %d, 跳过 %d, 失败 %d",
+			source.Name, stats.Hours, stats.FromPage, stats.Pages, stats.Submitted, stats.Skipped, stats.Failed)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+	"video/config"
+	"video/core"
+	"video/model"
+	"video/pkg/db"
+	"video/pkg/healthcheck"
+
+	"github.com/spf13/viper"
+)
+
+func main() {
+	interval := flag.Int("interval", -1, "两轮检测间隔(秒)，0 表示只检测一轮，默认读取配置")
+	limit := flag.Int("limit", 0, "每轮最多检测的线路数，0 表示全部")
+	flag.Parse()
+
+	viper.SetConfigName("config") // name of config file (without extension)
+	viper.SetConfigType("yaml")   // REQUIRED if the config file does not have the extension in the name
+	viper.AddConfigPath("etc/")   // path to look for the config file in
+	err := viper.ReadInConfig()   // Find and read the config file
+	if err != nil {               // Handle errors reading the config file
+		panic(fmt.Errorf("fatal error config file: %w", err))
+	}
+	var configGlobal config.ConfigGlobal
+	if err := viper.Unmarshal(&configGlobal); err != nil {
+		fmt.Printf("Unable to decode into struct, %v", err)
+		return
+	}
+	core.New().ConfigGlobal = configGlobal
+	if err := db.NewDBS().InitGorm(configGlobal.Mysql); err != nil {
+		log.Fatalf("数据库连接失败: %v", err)
+	}
+	core.New().DB = db.DBS
+	if err := core.New().DB.AutoMigrate(&model.LineHealth{}); err != nil {
+		log.Fatalf("创建线路健康表失败: %v", err)
+	}
+	if *interval < 0 {
+		*interval = configGlobal.HealthCheck.Interval
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	checker := healthcheck.New(configGlobal.HealthCheck, healthcheck.DBStore{})
+	for {
+		start := time.Now()
+		checked, dead, err := checker.Sweep(ctx, *limit)
+		if err != nil {
+			log.Printf("线路检测中断: %v", err)
+		}
+		log.Printf("线路检测结束: 检测 %d, 失效 %d, 耗时 %s", checked, dead, time.Since(start).Round(time.Second))
+		if *interval <= 0 || ctx.Err() != nil {
+			return
+		}
+		select {
+		case <-time.After(time.Duration(*interval) * time.Second):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"video/config"
+	"video/core"
+	"video/model"
+	"video/pkg/db"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// 迁移任务，按名称执行：go run ./cmd/migrate -task episodes
+var tasks = map[string]func() error{
+	"episodes":     backfillEpisodes,
+	"outbox":       createOutbox,
+	"content_hash": addContentHash,
+	"api_key":      createApiKey,
+	"ngram":        model.CreateNgramIndex,
+	"pinyin":       backfillPinyin,
+	"zhconv":       backfillSearchText,
+	"browse_index": model.CreateBrowseIndexes,
+	"line_index":   model.CreateLineSampleIndex,
+}
+
+func main() {
+	task := flag.String("task", "", "迁移任务名称")
+	flag.Parse()
+
+	viper.SetConfigName("config") // name of config file (without extension)
+	viper.SetConfigType("yaml")   // REQUIRED if the config file does not have the extension in the name
+	viper.AddConfigPath("etc/")   // path to look for the config file in
+	err := viper.ReadInConfig()   // Find and read the config file
+	if err != nil {               // Handle errors reading the config file
+		panic(fmt.Errorf("fatal error config file: %w", err))
+	}
+	var configGlobal config.ConfigGlobal
+	if err := viper.Unmarshal(&configGlobal); err != nil {
+		fmt.Printf("Unable to decode into struct, %v", err)
+		return
+	}
+	core.New().ConfigGlobal = configGlobal
+	if err := db.NewDBS().InitGorm(configGlobal.Mysql); err != nil {
+		log.Fatalf("数据库连接失败: %v", err)
+	}
+	core.New().DB = db.DBS
+
+	run, ok := tasks[*task]
+	if !ok {
+		log.Fatalf("未知的迁移任务: %q", *task)
+	}
+	if err := run(); err != nil {
+		log.Fatalf("迁移任务 %s 失败: %v", *task, err)
+	}
+	log.Printf("迁移任务 %s 完成", *task)
+}
+
+// backfillEpisodes 建立 video_episode 表，并把已有 video_url 的播放串解析为分集
+func backfillEpisodes() error {
+	if err := core.New().DB.AutoMigrate(&model.VideoUrl{}, &model.VideoEpisode{}); err != nil {
+		return err
+	}
+	var total int
+	var videoUrls []model.VideoUrl
+	return core.New().DB.Model(&model.VideoUrl{}).FindInBatches(&videoUrls, 500, func(tx *gorm.DB, batch int) error {
+		for _, videoUrl := range videoUrls {
+			var episode model.VideoEpisode
+			if err := episode.SyncByVideoUrl(core.New().DB.DB.DB, videoUrl); err != nil {
+				return fmt.Errorf("video_url %d: %w", videoUrl.Id, err)
+			}
+		}
+		total += len(videoUrls)
+		log.Printf("已处理 %d 条 video_url", total)
+		return nil
+	}).Error
+}
+
+// createOutbox 建立 outbox 表，视频入库和浏览时写入领域事件
+func createOutbox() error {
+	return core.New().DB.AutoMigrate(&model.Outbox{})
+}
+
+// addContentHash 为 video_url 增加 content_hash 列，入库内容不变时跳过
+func addContentHash() error {
+	return core.New().DB.AutoMigrate(&model.VideoUrl{})
+}
+
+// createApiKey 建立 api_key 表，采集程序使用 API key 调用写接口
+func createApiKey() error {
+	return core.New().DB.AutoMigrate(&model.ApiKey{})
+}
+
+// backfillPinyin 为 video 增加 pinyin 列，并按标题、别名和演员回填拼音
+func backfillPinyin() error {
+	if !core.New().DB.Migrator().HasColumn(&model.Video{}, "Pinyin") {
+		if err := core.New().DB.Migrator().AddColumn(&model.Video{}, "Pinyin"); err != nil {
+			return err
+		}
+	}
+	var total int
+	var afterId int64
+	var video model.Video
+	for {
+		videos, err := video.ListAfter(afterId, 500)
+		if err != nil {
+			return err
+		}
+		if len(videos) == 0 {
+			return nil
+		}
+		ids := make([]int64, len(videos))
+		for i := range videos {
+			ids[i] = videos[i].Id
+		}
+		names, err := model.ListCategoryNames(ids)
+		if err != nil {
+			return err
+		}
+		categoryIds := make(map[int64][]int64, len(videos))
+		for _, name := range names {
+			categoryIds[name.VideoId] = append(categoryIds[name.VideoId], name.CategoryId)
+		}
+		for i := range videos {
+			if err := videos[i].UpdatePinyin(core.New().DB.DB.DB, categoryIds[videos[i].Id]); err != nil {
+				return fmt.Errorf("video %d: %w", videos[i].Id, err)
+			}
+		}
+		afterId = videos[len(videos)-1].Id
+		total += len(videos)
+		log.Printf("已处理 %d 个视频", total)
+	}
+}
+
+// backfillSearchText 为 video 增加 search_title、search_alias 列，为 category 增加 search_name 列，并回填简体的检索形式
+func backfillSearchText() error {
+	migrator := core.New().DB.Migrator()
+	for _, column := range model.SearchColumns {
+		if migrator.HasColumn(column.Model, column.Field) {
+			continue
+		}
+		if err := migrator.AddColumn(column.Model, column.Field); err != nil {
+			return err
+		}
+	}
+	for _, index := range []struct {
+		model any
+		field string
+	}{{&model.Video{}, "SearchTitle"}, {&model.Category{}, "SearchName"}} {
+		if migrator.HasIndex(index.model, index.field) {
+			continue
+		}
+		if err := migrator.CreateIndex(index.model, index.field); err != nil {
+			return err
+		}
+	}
+
+	// 已删除的视频恢复后也要能检索、已删除的分类也按 search_name 去重，读写都包含已删除的行
+	var total int
+	var videos []model.Video
+	err := core.New().DB.Unscoped().Model(&model.Video{}).Select("id", "title", "alias").FindInBatches(&videos, 500, func(tx *gorm.DB, batch int) error {
+		for _, v := range videos {
+			if err := core.New().DB.Unscoped().Model(&model.Video{}).Where("id = ?", v.Id).UpdateColumns(map[string]any{
+				"search_title": model.SearchText(v.Title),
+				"search_alias": model.SearchText(v.Alias),
+			}).Error; err != nil {
+				return fmt.Errorf("video %d: %w", v.Id, err)
+			}
+		}
+		total += len(videos)
+		log.Printf("已处理 %d 个视频", total)
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	total = 0
+	var categories []model.Category
+	return core.New().DB.Unscoped().Model(&model.Category{}).Select("id", "name").FindInBatches(&categories, 500, func(tx *gorm.DB, batch int) error {
+		for _, category := range categories {
+			if err := core.New().DB.Unscoped().Model(&model.Category{}).Where("id = ?", category.Id).
+				UpdateColumn("search_name", model.SearchText(category.Name)).Error; err != nil {
+				return fmt.Errorf("category %d: %w", category.Id, err)
+			}
+		}
+		total += len(categories)
+		log.Printf("已处理 %d 个分类", total)
+		return nil
+	}).Error
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"video/config"
+	"video/core"
+	"video/model"
+	"video/pkg/db"
+
+	"github.com/spf13/viper"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "只输出偏差，不修改 video_count")
+	flag.Parse()
+
+	viper.SetConfigName("config") // name of config file (without extension)
+	viper.SetConfigType("yaml")   // REQUIRED if the config file does not have the extension in the name
+	viper.AddConfigPath("etc/")   // path to look for the config file in
+	err := viper.ReadInConfig()   // Find and read the config file
+	if err != nil {               // Handle errors reading the config file
+		panic(fmt.Errorf("fatal error config file: %w", err))
+	}
+	var configGlobal config.ConfigGlobal
+	if err := viper.Unmarshal(&configGlobal); err != nil {
+		fmt.Printf("Unable to decode into struct, %v", err)
+		return
+	}
+	core.New().ConfigGlobal = configGlobal
+	if err := db.NewDBS().InitGorm(configGlobal.Mysql); err != nil {
+		log.Fatalf("数据库连接失败: %v", err)
+	}
+	core.New().DB = db.DBS
+
+	// 按 video_category 重新统计 category.video_count
+	var category model.Category
+	drift, err := category.ListVideoCountDrift()
+	if err != nil {
+		log.Fatalf("统计分类视频数失败: %v", err)
+	}
+	var total int
+	for _, item := range drift {
+		diff := item.VideoCount - item.Actual
+		total += diff
+		log.Printf("分类 %d %s: video_count=%d 实际=%d 偏差=%+d", item.Id, item.Name, item.VideoCount, item.Actual, diff)
+		if *dryRun {
+			continue
+		}
+		if err := category.SetVideoCount(item.Id, item.Actual); err != nil {
+			log.Fatalf("修正分类 %d 失败: %v", item.Id, err)
+		}
+	}
+	if *dryRun {
+		log.Printf("共 %d 个分类存在偏差，合计 %+d，未修改", len(drift), total)
+		return
+	}
+	log.Printf("已修正 %d 个分类，合计 %+d", len(drift), total)
+}
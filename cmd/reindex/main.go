@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"video/config"
+	"video/core"
+	"video/model"
+	"video/pkg/db"
+	"video/pkg/search"
+
+	"github.com/spf13/viper"
+)
+
+func main() {
+	batch := flag.Int("batch", 500, "每批写入的视频数")
+	flag.Parse()
+
+	viper.SetConfigName("config") // name of config file (without extension)
+	viper.SetConfigType("yaml")   // REQUIRED if the config file does not have the extension in the name
+	viper.AddConfigPath("etc/")   // path to look for the config file in
+	err := viper.ReadInConfig()   // Find and read the config file
+	if err != nil {               // Handle errors reading the config file
+		panic(fmt.Errorf("fatal error config file: %w", err))
+	}
+	var configGlobal config.ConfigGlobal
+	if err := viper.Unmarshal(&configGlobal); err != nil {
+		fmt.Printf("Unable to decode into struct, %v", err)
+		return
+	}
+	core.New().ConfigGlobal = configGlobal
+	if len(configGlobal.Elastic.Addresses) == 0 {
+		log.Fatalf("未配置 Elastic.Addresses，MySQL 搜索不需要重建索引")
+	}
+	if err := db.NewDBS().InitGorm(configGlobal.Mysql); err != nil {
+		log.Fatalf("数据库连接失败: %v", err)
+	}
+	core.New().DB = db.DBS
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	// 全量写入新索引后切换别名，重建期间搜索仍使用旧索引
+	es := search.NewElastic(configGlobal.Elastic)
+	// 重建期间 relay 的增量更新写入旧索引，切换后从这里开始重放
+	var outbox model.Outbox
+	lastEventId, err := outbox.MaxId(0)
+	if err != nil {
+		log.Fatalf("查询 outbox 失败: %v", err)
+	}
+	start := time.Now()
+	total, err := es.Reindex(ctx, *batch, func(afterId int64, limit int) ([]search.Document, error) {
+		docs, err := search.LoadDocumentsAfter(afterId, limit)
+		if len(docs) > 0 {
+			log.Printf("写入视频 %d - %d", docs[0].Id, docs[len(docs)-1].Id)
+		}
+		return docs, err
+	})
+	if err != nil {
+		log.Fatalf("重建索引失败(已写入 %d 个视频): %v", total, err)
+	}
+	log.Printf("重建索引完成，共 %d 个视频，耗时 %s，别名 %s 已指向新索引", total, time.Since(start).Round(time.Second), es.Alias)
+	replayed, err := search.NewIndexer(es).Replay(ctx, lastEventId, outbox.ListAfter)
+	if err != nil {
+		log.Fatalf("重放重建期间的事件失败(已重放 %d 个视频)，可再次执行 reindex: %v", replayed, err)
+	}
+	log.Printf("已重放重建期间变更的 %d 个视频", replayed)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"video/config"
+	"video/core"
+	"video/model"
+	"video/pkg/cache"
+	"video/pkg/db"
+	"video/pkg/event"
+	"video/pkg/kafka"
+	"video/pkg/search"
+
+	"github.com/spf13/viper"
+)
+
+func main() {
+	interval := flag.Duration("interval", time.Second, "轮询 outbox 的间隔")
+	batch := flag.Int("batch", 100, "每次读取的事件数")
+	retention := flag.Duration("retention", 7*24*time.Hour, "已发布事件的保留时间，0 表示不删除")
+	maxAttempts := flag.Int("max-attempts", 10, "同一事件最多失败(发布或发布后处理)的次数，超过后放弃并继续发布后面的事件，0 表示一直重试")
+	flag.Parse()
+
+	viper.SetConfigName("config") // name of config file (without extension)
+	viper.SetConfigType("yaml")   // REQUIRED if the config file does not have the extension in the name
+	viper.AddConfigPath("etc/")   // path to look for the config file in
+	err := viper.ReadInConfig()   // Find and read the config file
+	if err != nil {               // Handle errors reading the config file
+		panic(fmt.Errorf("fatal error config file: %w", err))
+	}
+	var configGlobal config.ConfigGlobal
+	if err := viper.Unmarshal(&configGlobal); err != nil {
+		fmt.Printf("Unable to decode into struct, %v", err)
+		return
+	}
+	core.New().ConfigGlobal = configGlobal
+	if configGlobal.Kafka.EventTopic == "" {
+		log.Fatalf("未配置 Kafka.EventTopic")
+	}
+	if err := db.NewDBS().InitGorm(configGlobal.Mysql); err != nil {
+		log.Fatalf("数据库连接失败: %v", err)
+	}
+	core.New().DB = db.DBS
+	if err := core.New().DB.AutoMigrate(&model.Outbox{}); err != nil {
+		log.Fatalf("创建 outbox 表失败: %v", err)
+	}
+	if err := cache.InitRedis(configGlobal); err != nil {
+		log.Fatalf("%v", err)
+	}
+	producer, err := kafka.ProducerInit()
+	if err != nil {
+		log.Fatalf("Failed to create producer: %v", err)
+	}
+	defer producer.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	relay := event.NewRelay(event.DBStore{}, kafka.NewProducer(producer), configGlobal.Kafka.EventTopic)
+	relay.Interval = *interval
+	relay.BatchSize = *batch
+	relay.MaxAttempts = *maxAttempts
+	relay.Retention = *retention
+	var handlers []func(ctx context.Context, e event.Event) error
+	if cache.Client() != nil {
+		// 采集、Kafka 入库等进程写入的视频在事件发布后使接口缓存失效
+		handlers = append(handlers, func(ctx context.Context, e event.Event) error {
+			cache.Default().HandleEvent(ctx, e)
+			return nil
+		})
+	}
+	if len(configGlobal.Elastic.Addresses) > 0 {
+		// 按事件增量更新 Elasticsearch 索引
+		es := search.NewElastic(configGlobal.Elastic)
+		if err := es.EnsureIndex(ctx); err != nil {
+			log.Fatalf("创建搜索索引失败: %v", err)
+		}
+		handlers = append(handlers, search.NewIndexer(es).HandleEvent)
+	}
+	// 索引失败时事件留在 outbox 中重试，超过 -max-attempts 后放弃，由 reindex 补齐
+	relay.OnPublished = func(ctx context.Context, e event.Event) error {
+		for _, handle := range handlers {
+			if err := handle(ctx, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	log.Printf("outbox relay 启动，发布到 %s", configGlobal.Kafka.EventTopic)
+	relay.Run(ctx)
+}
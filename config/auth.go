@@ -0,0 +1,8 @@
+package config
+
+// AuthUser 可登录后台的账号，Password 为 bcrypt 哈希
+type AuthUser struct {
+	Name     string // 登录名，写入 token 的 sub
+	Password string // bcrypt 哈希，可用 htpasswd -bnBC 10 "" <密码> | tr -d ':\n' 生成
+	Role     string // admin、collector 或 viewer
+}
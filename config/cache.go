@@ -0,0 +1,11 @@
+package config
+
+// Cache 接口响应缓存，未配置 Redis 时只合并并发的相同查询
+type Cache struct {
+	Prefix      string // key 前缀，默认 video:
+	GetTTL      int    // 视频详情缓存时间(秒)
+	ListTTL     int    // 视频列表缓存时间(秒)
+	CategoryTTL int    // 分类、视频类型缓存时间(秒)
+	CountTTL    int    // 列表总数缓存时间(秒)，入库时不失效
+	MaxListPage int    // 只缓存前几页的列表，带关键词的搜索不缓存
+}
@@ -0,0 +1,14 @@
+package config
+
+// Source maccms 采集源配置
+type Source struct {
+	Name      string          // 采集源名称，用于日志和命令行筛选
+	BaseUrl   string          // maccms 接口地址，如 http://xxx/api.php/provide/vod/
+	ProxyName string          // 播放代理名称，写入 VideoUrl.ProxyName
+	ProxyUrl  string          // 播放代理地址，写入 VideoUrl.Proxy
+	SubmitUrl string          // 远程提交地址，如 https://api.7x.chat/api/v1/video/create，为空时直接写入本地数据库
+	ApiKey    string          // 远程提交使用的 API key，通过 X-Api-Key 发送
+	Workers   int             // 并发处理的页数，默认 10
+	Interval  int             // 每条视频提交后的间隔(毫秒)
+	TypeMap   map[int64]int64 // 源站 type_id -> 本站 type_id，未配置的分类原样保留，映射为 0 的分类跳过
+}
@@ -4,4 +4,5 @@ type Elastic struct {
 	Addresses []string
 	Username  string
 	Password  string
+	Index     string // 索引别名，默认 video；重建索引时指向新索引
 }
@@ -1,19 +1,28 @@
 package config
 
 type ConfigGlobal struct {
-	Zap         Zap
-	Mysql       Mysql
-	RedisConfig RedisConfig
-	Elastic     Elastic
-	RabbitMq    RabbitMq
-	Gorse       Gorse
-	Kafka       Kafka
+	Zap          Zap
+	Mysql        Mysql
+	RedisConfig  RedisConfig
+	RedisCluster RedisCluster
+	Cache        Cache
+	Views        Views
+	Elastic      Elastic
+	RabbitMq     RabbitMq
+	Gorse        Gorse
+	Kafka        Kafka
+	Sources      []Source
+	Hls          Hls
+	HlsCache     HlsCache
+	HealthCheck  HealthCheck
+	UserJwt      UserJwt
+	Users        []AuthUser
 }
 type UserJwt struct {
-	SSO           bool
-	Secret        string
-	Expire        int64
-	RefreshExpire int64
+	SSO           bool   // 单点登录，同一账号重新登录后旧 token 失效
+	Secret        string // HS256 签名密钥
+	Expire        int64  // access token 有效期(秒)
+	RefreshExpire int64  // refresh token 有效期(秒)
 }
 
 type AvatarPool []string
@@ -0,0 +1,10 @@
+package config
+
+// HealthCheck 播放线路健康检测
+type HealthCheck struct {
+	Concurrency int     // 并发检测数
+	HostRate    float64 // 同一 host 每秒最多请求次数
+	DeadAfter   int     // 连续失败多少次标记失效
+	Interval    int     // 两轮检测间隔(秒)，0 表示只检测一轮
+	Timeout     int     // 单次请求超时(秒)
+}
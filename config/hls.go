@@ -0,0 +1,18 @@
+package config
+
+// Hls m3u8 去除插播配置
+type Hls struct {
+	Rules             []string // 启用的检测规则: discontinuity, duration, prefix，为空时启用 discontinuity 和 duration
+	MaxAdDuration     float64  // discontinuity 规则下插播段的最长总时长(秒)，默认 120
+	DurationTolerance float64  // duration 规则下分片常见时长与主体相差多少秒视为插播，默认 0.5
+}
+
+// HlsCache m3u8 与分片的本地磁盘缓存配置，Dir 为空时不启用
+type HlsCache struct {
+	Dir           string // 缓存目录
+	MaxSize       int64  // 最大占用(MB)，默认 10240
+	PlaylistTTL   int64  // 播放列表缓存时间(秒)，默认 600
+	SegmentTTL    int64  // 分片缓存时间(秒)，默认 7 天
+	MaxObjectSize int64  // 单个播放列表或分片的最大大小(MB)，超过时放弃缓存并返回错误，默认 64
+	Secret        string // 分片地址签名密钥，启用缓存时必填，多个实例需相同
+}
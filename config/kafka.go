@@ -1,9 +1,14 @@
 package config
 
 type Kafka struct {
-	User     string
-	Password string
-	Brokers  []string
-	GroupId  string
-	Topic    string
+	User            string
+	Password        string
+	Brokers         []string
+	GroupId         string
+	Topic           string
+	EventTopic      string // 领域事件 topic，由 cmd/relay 从 outbox 表发布
+	DeadLetterTopic string // 重试后仍失败的消息转发到该 topic，为空时只记录日志
+	MaxRetries      int    // 入库失败重试次数
+	RetryBackoff    int    // 首次重试等待(毫秒)，之后每次翻倍
+	MaxRetryBackoff int    // 重试最长等待(毫秒)
 }
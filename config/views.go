@@ -0,0 +1,7 @@
+package config
+
+// Views 浏览数统计，配置了 Redis 时在 Redis 中累计，否则在进程内累计
+type Views struct {
+	FlushInterval int // 浏览数写入数据库的间隔(秒)
+	DedupWindow   int // 同一客户端在该时间(秒)内重复浏览同一视频只计一次
+}
@@ -0,0 +1,166 @@
+package account
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"video/model"
+	"video/pkg/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+type loginRequest struct {
+	Name     string
+	Password string
+}
+
+type refreshRequest struct {
+	RefreshToken string
+}
+
+type createKeyRequest struct {
+	Name      string
+	Role      string
+	Scopes    []string
+	ExpiresAt *time.Time
+}
+
+type revokeKeyRequest struct {
+	Id int64
+}
+
+// Token 账号密码登录，返回 access token 和 refresh token
+func Token(c *gin.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println(r)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		}
+	}()
+	var req loginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON", "code": "INVALID_JSON"})
+		return
+	}
+	token, err := auth.Default().Login(c.Request.Context(), req.Name, req.Password)
+	if err != nil {
+		if !errors.Is(err, auth.ErrBadCredentials) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Session store unavailable", "code": "SESSION_ERROR"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid name or password", "code": "UNAUTHORIZED"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"Data": token})
+}
+
+// Refresh 使用 refresh token 换取新的 token
+func Refresh(c *gin.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println(r)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		}
+	}()
+	var req refreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON", "code": "INVALID_JSON"})
+		return
+	}
+	token, err := auth.Default().Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		message := "Invalid refresh token"
+		switch {
+		case errors.Is(err, auth.ErrTokenExpired):
+			message = "Refresh token expired"
+		case errors.Is(err, auth.ErrTokenReused):
+			message = "Refresh token reused, please login again"
+		case !errors.Is(err, auth.ErrInvalidToken):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Session store unavailable", "code": "SESSION_ERROR"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": message, "code": "UNAUTHORIZED"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"Data": token})
+}
+
+// CreateKey 创建采集程序使用的 API key，Key 只在创建时返回
+func CreateKey(c *gin.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println(r)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		}
+	}()
+	var req createKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON", "code": "INVALID_JSON"})
+		return
+	}
+	if req.Role == "" {
+		req.Role = auth.RoleCollector
+	}
+	plain, key, err := auth.Default().CreateKey(c.Request.Context(), req.Name, req.Role, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		writeError(c, "CreateKey", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"Data": key, "Key": plain})
+}
+
+// ListKeys 列出 API key，不含明文和哈希
+func ListKeys(c *gin.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println(r)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		}
+	}()
+	data, err := auth.Default().ListKeys(c.Request.Context())
+	if err != nil {
+		writeError(c, "ListKeys", err)
+		return
+	}
+	if data == nil {
+		data = []model.ApiKey{}
+	}
+	c.JSON(http.StatusOK, gin.H{"Data": data})
+}
+
+// RevokeKey 吊销 API key
+func RevokeKey(c *gin.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println(r)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		}
+	}()
+	var req revokeKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON", "code": "INVALID_JSON"})
+		return
+	}
+	if err := auth.Default().RevokeKey(c.Request.Context(), req.Id); err != nil {
+		writeError(c, "RevokeKey", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"Data": req.Id})
+}
+
+func writeError(c *gin.Context, name string, err error) {
+	fmt.Println(name+" error:", err)
+	switch {
+	case errors.Is(err, auth.ErrKeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Api key not found", "code": "NOT_FOUND"})
+	case model.KindOf(err) == model.KindValidation:
+		var modelErr *model.Error
+		errors.As(err, &modelErr)
+		c.JSON(http.StatusBadRequest, gin.H{"error": modelErr.Message, "code": "VALIDATION_FAILED"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database Error", "code": "DATABASE_ERROR"})
+	}
+}
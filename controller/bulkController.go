@@ -0,0 +1,203 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"video/model"
+	"video/pkg/cache"
+	"video/pkg/ingest"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultBulkBatch = 100
+	maxBulkLine      = 4 << 20 // NDJSON 单行最大字节数
+)
+
+// 批量入库每个视频的结果状态
+const (
+	BulkCreated = "created"
+	BulkUpdated = "updated"
+	BulkSkipped = "skipped"
+	BulkError   = "error"
+)
+
+// BulkResult /api/v1/video/bulk 返回的一行
+type BulkResult struct {
+	Index     int
+	VideoId   int64 `json:",omitempty"`
+	Status    string
+	Error     string `json:",omitempty"`
+	Code      string `json:",omitempty"`
+	Retryable bool   `json:",omitempty"`
+}
+
+// bulkDecoder 逐个读取请求体中的视频，支持 JSON 数组和 NDJSON
+type bulkDecoder struct {
+	array *json.Decoder  // JSON 数组
+	lines *bufio.Scanner // NDJSON，每行一个视频
+	index int
+}
+
+func newBulkDecoder(r io.Reader) (*bulkDecoder, error) {
+	reader := bufio.NewReaderSize(r, 64<<10)
+	for {
+		b, err := reader.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			reader.Discard(1)
+			continue
+		case '[':
+			decoder := json.NewDecoder(reader)
+			if _, err = decoder.Token(); err != nil {
+				return nil, err
+			}
+			return &bulkDecoder{array: decoder}, nil
+		}
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 64<<10), maxBulkLine)
+		return &bulkDecoder{lines: scanner}, nil
+	}
+}
+
+// Next 返回下一个视频及其序号。itemErr 表示该行无法解析，可以继续读取下一行；
+// err 为 io.EOF 表示读取完毕，其它 err 表示请求体已无法继续解析
+func (that *bulkDecoder) Next() (index int, video *model.Video, itemErr error, err error) {
+	if that.array != nil {
+		if !that.array.More() {
+			return that.index, nil, nil, io.EOF
+		}
+		index = that.index
+		that.index++
+		video = &model.Video{}
+		if err = that.array.Decode(video); err != nil {
+			return index, nil, nil, err
+		}
+		return index, video, nil, nil
+	}
+	for that.lines.Scan() {
+		line := bytes.TrimSpace(that.lines.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		index = that.index
+		that.index++
+		video = &model.Video{}
+		if itemErr = json.Unmarshal(line, video); itemErr != nil {
+			return index, nil, itemErr, nil
+		}
+		return index, video, nil, nil
+	}
+	if err = that.lines.Err(); err == nil {
+		err = io.EOF
+	}
+	return that.index, nil, nil, err
+}
+
+type bulkItem struct {
+	index int
+	video *model.Video
+	err   error
+}
+
+// Bulk 批量入库，请求体为 JSON 数组或 NDJSON，按批次事务写入；
+// 每处理完一批即以 NDJSON 输出该批每个视频的结果，处理完一批才继续读取请求体
+func Bulk(c *gin.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println(r)
+		}
+	}()
+	batchSize := defaultBulkBatch
+	if s := c.Query("BatchSize"); s != "" {
+		if n, err := strconv.Atoi(s); err == nil && n > 0 {
+			batchSize = min(n, ingest.MaxBatch)
+		}
+	}
+	decoder, err := newBulkDecoder(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON", "code": CodeInvalidJson, "retryable": false})
+		return
+	}
+	// HTTP/1 默认在写响应前读完请求体，边读边写需要开启全双工
+	http.NewResponseController(c.Writer).EnableFullDuplex()
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+
+	ctx := c.Request.Context()
+	service := ingest.New(nil)
+	encoder := json.NewEncoder(c.Writer)
+	batch := make([]bulkItem, 0, batchSize)
+	flush := func() {
+		videos := make([]*model.Video, 0, len(batch))
+		for _, item := range batch {
+			if item.err == nil {
+				videos = append(videos, item.video)
+			}
+		}
+		var results []ingest.BatchItem
+		var changed []int64
+		if len(videos) > 0 {
+			results = service.IngestBatch(ctx, videos)
+		}
+		for _, item := range batch {
+			if item.err != nil {
+				encoder.Encode(BulkResult{Index: item.index, Status: BulkError, Error: "Invalid JSON", Code: CodeInvalidJson})
+				continue
+			}
+			res := bulkResult(item.index, results[0])
+			if res.Status == BulkCreated || res.Status == BulkUpdated {
+				changed = append(changed, res.VideoId)
+			}
+			encoder.Encode(res)
+			results = results[1:]
+		}
+		if len(changed) > 0 {
+			cache.Default().InvalidateVideos(ctx, changed...)
+		}
+		c.Writer.Flush()
+		batch = batch[:0]
+	}
+	for ctx.Err() == nil {
+		index, video, itemErr, err := decoder.Next()
+		if err != nil {
+			flush()
+			if !errors.Is(err, io.EOF) {
+				encoder.Encode(BulkResult{Index: index, Status: BulkError, Error: "Invalid JSON, stopped reading", Code: CodeInvalidJson})
+				c.Writer.Flush()
+			}
+			return
+		}
+		batch = append(batch, bulkItem{index: index, video: video, err: itemErr})
+		if len(batch) >= batchSize {
+			flush()
+		}
+	}
+}
+
+func bulkResult(index int, item ingest.BatchItem) BulkResult {
+	if item.Err != nil {
+		fmt.Println("Bulk error:", item.Err)
+		_, code, message := classifyIngestError(item.Err)
+		return BulkResult{Index: index, Status: BulkError, Error: message, Code: code, Retryable: ingest.Retryable(item.Err)}
+	}
+	res := BulkResult{Index: index, VideoId: item.VideoId, Status: BulkUpdated}
+	switch {
+	case item.Skipped:
+		res.Status = BulkSkipped
+	case item.Created:
+		res.Status = BulkCreated
+	}
+	return res
+}
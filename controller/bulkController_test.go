@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestBulkDecoder(t *testing.T) {
+	cases := map[string]struct {
+		body   string
+		titles []string
+		bad    []int // 无法解析的行
+		fatal  bool
+	}{
+		"array":        {body: ` [{"Title":"a"},{"Title":"b"}]`, titles: []string{"a", "b"}},
+		"ndjson":       {body: "{\"Title\":\"a\"}\n\nnot json\n{\"Title\":\"c\"}\n", titles: []string{"a", "", "c"}, bad: []int{1}},
+		"broken array": {body: `[{"Title":"a"},{"Title":`, titles: []string{"a"}, fatal: true},
+	}
+	for name, c := range cases {
+		decoder, err := newBulkDecoder(strings.NewReader(c.body))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var titles []string
+		var bad []int
+		for {
+			index, video, itemErr, err := decoder.Next()
+			if errors.Is(err, io.EOF) {
+				if c.fatal {
+					t.Errorf("%s: expected fatal error", name)
+				}
+				break
+			}
+			if err != nil {
+				if !c.fatal {
+					t.Errorf("%s: unexpected error %v", name, err)
+				}
+				break
+			}
+			if index != len(titles) {
+				t.Errorf("%s: expected index %d, got %d", name, len(titles), index)
+			}
+			if itemErr != nil {
+				bad = append(bad, index)
+				titles = append(titles, "")
+				continue
+			}
+			titles = append(titles, video.Title)
+		}
+		if strings.Join(titles, ",") != strings.Join(c.titles, ",") || len(bad) != len(c.bad) {
+			t.Errorf("%s: got titles %v bad %v", name, titles, bad)
+		}
+	}
+}
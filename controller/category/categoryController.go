@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
-	"video/model"
+	"video/pkg/cache"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,8 +20,7 @@ func List(c *gin.Context) {
 	if typeIdStr != "" {
 		typeId, _ = strconv.ParseInt(typeIdStr, 10, 64)
 	}
-	var categoryModel model.Category
-	res := categoryModel.HomeList(typeId)
+	res := cache.Default().HomeList(c.Request.Context(), typeId)
 	c.JSON(http.StatusOK, gin.H{
 		"Data": res,
 	})
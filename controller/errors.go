@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"video/model"
+	"video/pkg/ingest"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 错误码，采集程序根据 retryable 决定是否重试
+const (
+	CodeInvalidJson      = "INVALID_JSON"
+	CodeValidationFailed = "VALIDATION_FAILED"
+	CodeNotFound         = "NOT_FOUND"
+	CodeConflict         = "CONFLICT"
+	CodeDatabaseError    = "DATABASE_ERROR"
+	CodeInternalError    = "INTERNAL_ERROR"
+)
+
+// writeIngestError 把入库错误映射为 HTTP 状态码和错误码
+func writeIngestError(c *gin.Context, name string, err error) {
+	fmt.Println(name+" error:", err)
+	status, code, message := classifyIngestError(err)
+	c.JSON(status, gin.H{
+		"error":     message,
+		"code":      code,
+		"retryable": ingest.Retryable(err),
+	})
+}
+
+// classifyIngestError 返回入库错误对应的 HTTP 状态码、错误码和可返回给调用方的信息
+func classifyIngestError(err error) (status int, code string, message string) {
+	status, code, message = http.StatusInternalServerError, CodeInternalError, "Database Error"
+	var ingestErr *ingest.Error
+	if errors.As(err, &ingestErr) {
+		message = ingestErr.Message
+	}
+	var modelErr *model.Error
+	switch {
+	case errors.Is(err, ingest.ErrNotFound):
+		status, code, message = http.StatusNotFound, CodeNotFound, "Video not found"
+	case errors.As(err, &modelErr):
+		switch modelErr.Kind {
+		case model.KindValidation:
+			status, code, message = http.StatusBadRequest, CodeValidationFailed, modelErr.Message
+		case model.KindConflict:
+			status, code = http.StatusConflict, CodeConflict
+		case model.KindDB:
+			status, code = http.StatusServiceUnavailable, CodeDatabaseError
+		}
+	}
+	return
+}
@@ -0,0 +1,92 @@
+package play
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"video/core"
+	"video/model"
+	"video/pkg/hls"
+	"video/pkg/playurl"
+
+	"github.com/gin-gonic/gin"
+)
+
+var hlsClient = hls.NewClient()
+
+// M3u8 拉取分集的上游 m3u8，去除插播分片后输出绝对地址的媒体播放列表。
+// 启用 HlsCache 时播放列表经由磁盘缓存拉取，分片地址改写为 /api/v1/play/segment。
+func M3u8(c *gin.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println(r)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		}
+	}()
+	id, err := strconv.ParseInt(c.Query("episode"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid episode"})
+		return
+	}
+	var episodeModel model.VideoEpisode
+	episode, err := episodeModel.Get(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Episode not found"})
+		return
+	}
+	if episode.Format != playurl.FormatM3u8 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Episode is not m3u8"})
+		return
+	}
+	client := hlsClient
+	cache := core.New().HlsCache
+	if cache != nil {
+		client = &hls.Client{HttpClient: hlsClient.HttpClient, Getter: cache}
+	}
+	playlist, err := client.FetchMedia(c.Request.Context(), episode.Url)
+	if err != nil {
+		fmt.Println("M3u8 fetch error:", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch upstream playlist"})
+		return
+	}
+	out, removed := hls.StripAds(playlist, hls.RulesFromConfig(core.New().ConfigGlobal.Hls))
+	if cache != nil {
+		out.RewriteUris(func(uri string) string {
+			query := url.Values{}
+			query.Set("u", base64.RawURLEncoding.EncodeToString([]byte(uri)))
+			query.Set("s", cache.Sign(uri))
+			return "/api/v1/play/segment?" + query.Encode()
+		})
+	}
+	c.Header("X-Ads-Removed", strconv.Itoa(removed))
+	c.Data(http.StatusOK, "application/vnd.apple.mpegurl", []byte(out.String()))
+}
+
+// Segment 经由磁盘缓存输出分片(含 #EXT-X-KEY/#EXT-X-MAP 引用的文件)，只接受 M3u8 签过名的地址
+func Segment(c *gin.Context) {
+	cache := core.New().HlsCache
+	if cache == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cache disabled"})
+		return
+	}
+	rawUrl, err := base64.RawURLEncoding.DecodeString(c.Query("u"))
+	if err != nil || !cache.Verify(string(rawUrl), c.Query("s")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid signature"})
+		return
+	}
+	cache.Serve(c.Writer, c.Request, string(rawUrl))
+}
+
+// CacheStats 缓存命中统计
+func CacheStats(c *gin.Context) {
+	cache := core.New().HlsCache
+	if cache == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cache disabled"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"Data": cache.Stats(),
+	})
+}
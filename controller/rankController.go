@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"video/model"
+	"video/pkg/cache"
+	"video/pkg/views"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultRankSize = 20
+	maxRankSize     = 100
+	rankTTL         = time.Minute
+)
+
+// RankItem 排行中的视频，Views 为周期内的浏览数
+type RankItem struct {
+	model.Video
+	Views int64
+}
+
+// Rank 浏览排行：period 为 day、week 或 all，TypeId 为视频类型(type_pid)，为空表示全部
+func Rank(c *gin.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println(r)
+			c.JSON(http.StatusOK, gin.H{"Data": []RankItem{}})
+		}
+	}()
+	period := c.DefaultQuery("period", views.PeriodDay)
+	if period != views.PeriodDay && period != views.PeriodWeek && period != views.PeriodAll {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period must be day, week or all", "code": CodeValidationFailed})
+		return
+	}
+	typeId, _ := strconv.ParseInt(c.Query("TypeId"), 10, 64)
+	limit := defaultRankSize
+	if n, err := strconv.Atoi(c.Query("Limit")); err == nil && n > 0 {
+		limit = min(n, maxRankSize)
+	}
+	ctx := c.Request.Context()
+	key := fmt.Sprintf("rank:%s:%d:%d", period, typeId, limit)
+	data, err := cache.Load(ctx, cache.Default(), key, rankTTL, func() ([]RankItem, error) {
+		return rankItems(ctx, period, typeId, limit)
+	})
+	if err != nil {
+		fmt.Println("Rank error:", err)
+		c.JSON(http.StatusOK, gin.H{"Data": []RankItem{}})
+		return
+	}
+	if data == nil {
+		data = []RankItem{}
+	}
+	c.JSON(http.StatusOK, gin.H{"Data": data})
+}
+
+func rankItems(ctx context.Context, period string, typeId int64, limit int) ([]RankItem, error) {
+	scores, err := views.Default().Top(ctx, period, typeId, limit)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(scores))
+	for _, score := range scores {
+		ids = append(ids, score.VideoId)
+	}
+	var video model.Video
+	videos, err := video.ListByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[int64]model.Video, len(videos))
+	for _, v := range videos {
+		byId[v.Id] = v
+	}
+	// 已删除的视频不出现在排行中
+	items := make([]RankItem, 0, len(scores))
+	for _, score := range scores {
+		if v, ok := byId[score.VideoId]; ok {
+			items = append(items, RankItem{Video: v, Views: score.Views})
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"video/pkg/suggest"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Suggest 搜索框输入提示：q 为输入的前缀，可以是中文、英文或拼音全拼、首字母，Limit 默认 10，最多 20
+func Suggest(c *gin.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println(r)
+			c.JSON(http.StatusOK, gin.H{"Data": []suggest.Suggestion{}})
+		}
+	}()
+	q := strings.TrimSpace(c.Query("q"))
+	limit, _ := strconv.Atoi(c.Query("Limit"))
+	data := suggest.Default().Suggest(q, limit)
+	if data == nil {
+		data = []suggest.Suggestion{}
+	}
+	c.JSON(http.StatusOK, gin.H{"Data": data})
+}
@@ -3,7 +3,7 @@ package videoClass
 import (
 	"fmt"
 	"net/http"
-	"video/model"
+	"video/pkg/cache"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,7 +14,6 @@ func List(c *gin.Context) {
 			fmt.Println(r)
 		}
 	}()
-	var videoClass model.VideoClass
-	res := videoClass.List()
+	res := cache.Default().VideoClassList(c.Request.Context())
 	c.JSON(http.StatusOK, res)
 }
@@ -1,15 +1,18 @@
 package controller
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strconv"
 
-	"video/core"
 	"video/model"
+	"video/pkg/cache"
+	"video/pkg/ingest"
+	"video/pkg/search"
+	"video/pkg/views"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 func List(c *gin.Context) {
@@ -17,9 +20,10 @@ func List(c *gin.Context) {
 		if r := recover(); r != nil {
 			fmt.Println(r)
 			c.JSON(http.StatusOK, gin.H{
-				"Data":   []model.Video{},
-				"LastId": 0,
-				"Total":  0,
+				"Data":       []model.Video{},
+				"LastId":     0,
+				"NextCursor": "",
+				"Total":      0,
 			})
 		}
 	}()
@@ -52,37 +56,109 @@ func List(c *gin.Context) {
 	} else {
 		id = 0
 	}
-	var categoryId string
-	if categoryIdStr := c.Query("CategoryId"); categoryIdStr != "" {
-		categoryId = categoryIdStr
+	// 分类筛选：CategoryId 为逗号分隔的 id(兼容旧参数，"-id" 排除)，Filter 为 JSON 格式，两者合并
+	categoryFilter, err := model.ParseCategoryIds(c.Query("CategoryId"))
+	if err == nil && c.Query("Filter") != "" {
+		var filter model.CategoryFilter
+		if filter, err = model.ParseCategoryFilter(c.Query("Filter")); err == nil {
+			categoryFilter = categoryFilter.Merge(filter)
+		}
+	}
+	if err != nil {
+		writeIngestError(c, "List", err)
+		return
 	}
 	var typeId int64
 	if typeIdStr := c.Query("TypeId"); typeIdStr != "" {
 		typeId, _ = strconv.ParseInt(typeIdStr, 10, 64)
 	}
 
-	keyWord := c.Query("KeyWord")
-
-	var video model.Video
-	data, total, err := video.List(page, pageSize, id, keyWord, categoryId, typeId)
+	q := model.VideoQuery{
+		Page:     page,
+		PageSize: pageSize,
+		Id:       id,
+		KeyWord:  c.Query("KeyWord"),
+		Category: categoryFilter,
+		TypeId:   typeId,
+		Cursor:   c.Query("Cursor"),
+	}
+	ctx := c.Request.Context()
+	var (
+		data       []model.Video
+		nextCursor string
+		total      int64
+		highlights map[int64]map[string][]string
+	)
+	if q.Keyword() != "" {
+		// 关键词搜索走搜索后端，总数由后端返回
+		data, nextCursor, total, highlights, err = searchVideos(ctx, q)
+	} else {
+		data, nextCursor, err = cache.Default().ListVideos(ctx, q)
+	}
+	if model.KindOf(err) == model.KindValidation {
+		writeIngestError(c, "List", err)
+		return
+	}
 	if err != nil {
 		fmt.Println("List error:", err)
 		c.JSON(http.StatusOK, gin.H{
-			"Data":   []model.Video{},
-			"LastId": 0,
-			"Total":  0,
+			"Data":       []model.Video{},
+			"LastId":     0,
+			"NextCursor": "",
+			"Total":      0,
 		})
 		return
 	}
+	if q.Keyword() == "" {
+		// 总数单独缓存，按游标翻页时不再每页 COUNT
+		if total, err = cache.Default().CountVideos(ctx, q); err != nil {
+			fmt.Println("List count error:", err)
+		}
+	}
 	var lastId int64
 	if len(data) > 0 {
 		lastId = data[len(data)-1].Id
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"Data":   data,
-		"LastId": lastId,
-		"Total":  total,
-	})
+	res := gin.H{
+		"Data":       data,
+		"LastId":     lastId,
+		"NextCursor": nextCursor,
+		"Total":      total,
+	}
+	if highlights != nil {
+		res["Highlights"] = highlights
+	}
+	// Facets=1 时返回当前条件下各子分类的视频数，失败时不影响列表
+	if facetsStr := c.Query("Facets"); facetsStr == "1" || facetsStr == "true" {
+		// 使用 Elasticsearch 时按索引聚合，与关键词搜索的结果一致
+		facets, err := search.Default().Facets(ctx, q)
+		if err != nil {
+			fmt.Println("List facets error:", err)
+		}
+		if facets == nil {
+			facets = []model.Facet{}
+		}
+		res["Facets"] = facets
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// searchVideos 通过搜索后端查询，返回视频和按视频 id 分组的高亮片段
+func searchVideos(ctx context.Context, q model.VideoQuery) (data []model.Video, nextCursor string, total int64, highlights map[int64]map[string][]string, err error) {
+	res, err := search.Default().Search(ctx, q)
+	if err != nil {
+		return
+	}
+	if data, err = search.Videos(res.Hits); err != nil {
+		return
+	}
+	highlights = make(map[int64]map[string][]string, len(res.Hits))
+	for _, hit := range res.Hits {
+		if len(hit.Highlight) > 0 {
+			highlights[hit.Id] = hit.Highlight
+		}
+	}
+	return data, res.NextCursor, res.Total, highlights, nil
 }
 
 func Get(c *gin.Context) {
@@ -96,20 +172,22 @@ func Get(c *gin.Context) {
 		c.JSON(http.StatusNotFound, nil)
 		return
 	}
-	var video model.Video
-	data, err := video.Get(id)
+	data, err := cache.Default().GetVideo(c.Request.Context(), id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, nil)
 		return
 	}
-	go func(id int64) {
-		core.New().DB.Model(&model.Video{}).Where("id = ?", id).
-			UpdateColumn("browse", gorm.Expr("browse + 1"))
-	}(id)
+	// 浏览数先累计，由 views.Counter 定期批量写库
+	if _, err := views.Default().Record(c.Request.Context(), &data, views.ClientId(c.ClientIP(), c.Request.UserAgent())); err != nil {
+		fmt.Println("Browse error:", err)
+	}
 	category, _ := model.ListByVideoId(id)
+	var episode model.VideoEpisode
+	episodes, _ := episode.ListLinesByVideoId(id)
 	c.JSON(http.StatusOK, gin.H{
 		"Data":     data,
 		"Category": category,
+		"Episodes": episodes,
 	})
 }
 
@@ -124,116 +202,114 @@ func Create(c *gin.Context) {
 	var video model.Video
 	err := c.BindJSON(&video)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON", "code": CodeInvalidJson, "retryable": false})
 		return
 	}
 
-	tx := core.New().DB.Begin()
-	if tx.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database Error"})
+	res, err := ingest.New(nil).Ingest(c.Request.Context(), &video)
+	if err != nil {
+		writeIngestError(c, "Create", err)
 		return
 	}
+	if !res.Skipped {
+		cache.Default().InvalidateVideos(c.Request.Context(), res.VideoId)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"VideoId":     res.VideoId,
+		"Created":     res.Created,
+		"Skipped":     res.Skipped,
+		"CategoryIds": res.CategoryIds,
+	})
+}
 
-	// Ensure rollback on panic
+// Update 按 Id 修改视频，只修改请求中出现的字段
+func Update(c *gin.Context) {
 	defer func() {
 		if r := recover(); r != nil {
-			tx.Rollback()
-			panic(r)
+			fmt.Println(r)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
 		}
 	}()
-
-	if err := video.VideoClass.Create(tx); err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create video class"})
+	var req ingest.Update
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON", "code": CodeInvalidJson, "retryable": false})
 		return
 	}
-
-	video.TypeId = video.VideoClass.TypeId
-	video.TypePid = video.VideoClass.TypePid
-	cc := model.Category{}
-	var categoryIds []int64
-	if len(video.Category) > 0 && video.Category[0].Type != nil {
-		categoryIds = cc.Create(tx, *video.Category[0].Type, video.Category, video.VideoClass)
+	if err := req.Validate(); err != nil {
+		writeIngestError(c, "Update", err)
+		return
 	}
 
-	video.VideoGroup.Edit(tx)
-	if video.VideoGroup.Id > 0 {
-		video.VideoGroupId = video.VideoGroup.Id
-	}
-	err = video.Create(tx)
+	video, categoryIds, err := ingest.New(nil).Update(c.Request.Context(), &req)
 	if err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create video"})
+		writeIngestError(c, "Update", err)
 		return
 	}
-	video.VideoUrl.VideoId = video.Id
-	if err := video.VideoUrl.Create(tx); err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create video url"})
-		return
-	}
-	// 同步 Video-Category 关联：已存在不创建、缺失则新增、多余则删除
-	// 查询当前已存在的关联
-	var existing []model.VideoCategory
-	if err := tx.Where("video_id = ?", video.Id).Find(&existing).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query existing categories"})
-		return
+	cache.Default().InvalidateVideos(c.Request.Context(), video.Id)
+	c.JSON(http.StatusOK, gin.H{
+		"Data":        video,
+		"CategoryIds": categoryIds,
+	})
+}
+
+// idsRequest 删除、恢复的请求，Id 和 Ids 可同时传
+type idsRequest struct {
+	Id  int64
+	Ids []int64
+}
+
+func (that *idsRequest) ids() []int64 {
+	ids := make([]int64, 0, len(that.Ids)+1)
+	if that.Id > 0 {
+		ids = append(ids, that.Id)
 	}
-	// 计算需要新增的条目
-	var toCreate []model.VideoCategory
-	for _, categoryId := range categoryIds {
-		found := false
-		for _, vc := range existing {
-			if vc.CategoryId == categoryId { // 已存在
-				found = true
-				break
-			}
-		}
-		if !found { // 缺失，需创建
-			toCreate = append(toCreate, model.VideoCategory{
-				CategoryId: categoryId,
-				VideoId:    video.Id,
-			})
+	for _, id := range that.Ids {
+		if id > 0 {
+			ids = append(ids, id)
 		}
 	}
-	if len(toCreate) > 0 {
-		if err := tx.Create(&toCreate).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create video categories"})
-			return
+	return ids
+}
+
+// Delete 删除视频，同时删除播放地址、分集、分类关联并减少分类视频数
+func Delete(c *gin.Context) {
+	batchVideos(c, "Delete", ingest.New(nil).Delete)
+}
+
+// Restore 恢复已删除的视频
+func Restore(c *gin.Context) {
+	batchVideos(c, "Restore", ingest.New(nil).Restore)
+}
+
+func batchVideos(c *gin.Context, name string, fn func(ctx context.Context, ids []int64) ([]int64, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println(r)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
 		}
+	}()
+	var req idsRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON", "code": CodeInvalidJson, "retryable": false})
+		return
 	}
-	// 计算需要删除的条目（数据库多出来的）
-	var toDeleteIds []interface{}
-	for _, vc := range existing {
-		keep := false
-		for _, categoryId := range categoryIds {
-			if vc.CategoryId == categoryId { // 仍在请求集合中，保留
-				keep = true
-				break
-			}
-		}
-		if !keep {
-			toDeleteIds = append(toDeleteIds, vc.CategoryId)
-		}
+	ids := req.ids()
+	if len(ids) == 0 {
+		writeIngestError(c, name, model.NewValidationError("Id or Ids is required"))
+		return
 	}
-	if len(toDeleteIds) > 0 {
-		if err := tx.Where("video_id = ? AND category_id IN ?", video.Id, toDeleteIds).Delete(&model.VideoCategory{}).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete old categories"})
-			return
-		}
+	if len(ids) > ingest.MaxBatch {
+		writeIngestError(c, name, model.NewValidationError(fmt.Sprintf("At most %d ids per request", ingest.MaxBatch)))
+		return
 	}
-
-	if err := tx.Commit().Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction Commit Failed"})
+	data, err := fn(c.Request.Context(), ids)
+	if err != nil {
+		writeIngestError(c, name, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{})
-}
-
-func Update(c *gin.Context) {
-	// id := c.Query("id")
+	cache.Default().InvalidateVideos(c.Request.Context(), data...)
+	if data == nil {
+		data = []int64{}
+	}
+	c.JSON(http.StatusOK, gin.H{"Data": data})
 }
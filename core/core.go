@@ -4,6 +4,7 @@ import (
 	"sync"
 	"video/config"
 	"video/pkg/db"
+	"video/pkg/hlscache"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -17,6 +18,7 @@ type Core struct {
 	Jwt          config.UserJwt
 	ConfigGlobal config.ConfigGlobal
 	DB           *db.Dbs
+	HlsCache     *hlscache.Cache
 }
 
 func New() *Core {
@@ -31,5 +33,5 @@ func (c *Core) InitRedis(client redis.Cmdable) {
 }
 
 func (c *Core) InitRedisCluster(client redis.Cmdable) {
-	c.Redis = client
+	c.RedisCluster = client
 }
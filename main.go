@@ -1,12 +1,23 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 	"video/config"
 	"video/core"
 	"video/middlewares"
+	"video/model"
+	"video/pkg/cache"
 	"video/pkg/db"
+	"video/pkg/hlscache"
+	"video/pkg/suggest"
+	"video/pkg/views"
 	"video/router"
 
 	"github.com/gin-gonic/gin"
@@ -28,11 +39,32 @@ func main() {
 		return
 	}
 	core.New().ConfigGlobal = config
+	core.New().Jwt = config.UserJwt
 	err = db.NewDBS().InitGorm(config.Mysql)
 	if err != nil {
 		return
 	}
 	core.New().DB = db.DBS
+	if err := model.CheckSearchColumns(); err != nil {
+		panic(err)
+	}
+	// 有 ngram 全文索引时中文关键词也走索引，否则使用 LIKE
+	strategy, err := model.DetectSearchStrategy()
+	if err != nil {
+		log.Printf("检测全文索引失败，使用 %s: %v", strategy, err)
+	} else {
+		log.Printf("关键词检索方式: %s", strategy)
+	}
+	if err := cache.InitRedis(config); err != nil {
+		panic(fmt.Errorf("init redis: %w", err))
+	}
+	if config.HlsCache.Dir != "" {
+		cache, err := hlscache.New(config.HlsCache)
+		if err != nil {
+			panic(fmt.Errorf("init hls cache: %w", err))
+		}
+		core.New().HlsCache = cache
+	}
 	r := gin.Default()
 	r.Use(middlewares.Cors())
 	router.RouterGroupApp.ApiRouter.InitApiRouter(r.Group("/api"))
@@ -42,5 +74,32 @@ func main() {
 		})
 	})
 
-	r.Run(":9191")
+	// 浏览数定期写库，退出前写入剩余的浏览数
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	counterCtx, stopCounter := context.WithCancel(context.Background())
+	counterDone := make(chan struct{})
+	go func() {
+		views.Default().Run(counterCtx)
+		close(counterDone)
+	}()
+
+	// 输入提示在进程内构建，有视频入库、修改、删除时重建
+	go suggest.Default().Run(ctx)
+
+	srv := &http.Server{Addr: ":9191", Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("listen: %v", err)
+		}
+	}()
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+	// 请求处理完后再停止计数，最后一次写库包含所有浏览
+	stopCounter()
+	<-counterDone
 }
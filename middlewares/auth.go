@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"video/pkg/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClaimsKey 认证通过后 Claims 保存在 gin.Context 中的 key
+const ClaimsKey = "claims"
+
+// 错误码，与 controller 的错误码格式一致
+const (
+	CodeUnauthorized = "UNAUTHORIZED"
+	CodeForbidden    = "FORBIDDEN"
+)
+
+// Auth 要求请求携带拥有 scope 的凭证：Authorization: Bearer <access token 或 API key>，或 X-Api-Key: <API key>
+func Auth(service *auth.Service, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader("X-Api-Key")
+		if token == "" {
+			if header := c.GetHeader("Authorization"); len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+				token = strings.TrimSpace(header[7:])
+			}
+		}
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing credentials", "code": CodeUnauthorized, "retryable": false})
+			return
+		}
+		claims, err := service.Authenticate(c.Request.Context(), token)
+		if err != nil {
+			message := "Invalid credentials"
+			switch {
+			case errors.Is(err, auth.ErrTokenExpired):
+				message = "Token expired"
+			case errors.Is(err, auth.ErrKeyRevoked):
+				message = "Api key revoked"
+			case !errors.Is(err, auth.ErrInvalidToken):
+				// 查询密钥或会话失败，调用方可以重试
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Database Error", "code": "DATABASE_ERROR", "retryable": true})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": message, "code": CodeUnauthorized, "retryable": false})
+			return
+		}
+		if !claims.Allow(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Permission denied: " + scope, "code": CodeForbidden, "retryable": false})
+			return
+		}
+		c.Set(ClaimsKey, claims)
+		c.Next()
+	}
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"time"
+	"video/core"
+)
+
+// ApiKey 采集程序使用的长期密钥，只保存 sha256 哈希，明文只在创建时返回一次。
+type ApiKey struct {
+	Id         int64      `gorm:"column:id;primaryKey" json:"Id"`                            //type:int64             comment:
+	CreatedAt  *time.Time `gorm:"column:created_at" json:"CreatedAt"`                        //type:*time.Time        comment:创建时间
+	UpdatedAt  *time.Time `gorm:"column:updated_at" json:"UpdatedAt"`                        //type:*time.Time        comment:更新时间
+	Name       string     `gorm:"column:name;size:64" json:"Name"`                           //type:string            comment:名称，如采集源名称
+	Prefix     string     `gorm:"column:prefix;size:16;uniqueIndex:uk_prefix" json:"Prefix"` //type:string            comment:密钥前缀，用于查找和展示
+	KeyHash    string     `gorm:"column:key_hash;size:64" json:"-"`                          //type:string            comment:完整密钥的 sha256 十六进制
+	Role       string     `gorm:"column:role;size:16" json:"Role"`                           //type:string            comment:角色 admin、collector、viewer
+	Scopes     string     `gorm:"column:scopes;size:255" json:"Scopes"`                      //type:string            comment:权限范围，逗号分隔，不能超出角色的权限
+	ExpiresAt  *time.Time `gorm:"column:expires_at" json:"ExpiresAt"`                        //type:*time.Time        comment:过期时间，为空表示不过期
+	RevokedAt  *time.Time `gorm:"column:revoked_at" json:"RevokedAt"`                        //type:*time.Time        comment:吊销时间，为空表示有效
+	LastUsedAt *time.Time `gorm:"column:last_used_at" json:"LastUsedAt"`                     //type:*time.Time        comment:最近使用时间
+}
+
+// TableName 表名:api_key，采集程序密钥。
+func (*ApiKey) TableName() string {
+	return "api_key"
+}
+
+func (that *ApiKey) Create() error {
+	if err := core.New().DB.Create(that).Error; err != nil {
+		return dbError("Failed to create api key", err)
+	}
+	return nil
+}
+
+// GetByPrefix 按前缀查找密钥，不存在时 Id 为 0
+func (that *ApiKey) GetByPrefix(prefix string) (data ApiKey, err error) {
+	err = core.New().DB.Where("prefix = ?", prefix).Limit(1).Find(&data).Error
+	return
+}
+
+func (that *ApiKey) List() (data []ApiKey, err error) {
+	err = core.New().DB.Order("id DESC").Find(&data).Error
+	return
+}
+
+// Revoke 吊销密钥，返回是否有密钥被吊销
+func (that *ApiKey) Revoke(id int64) (bool, error) {
+	res := core.New().DB.Model(&ApiKey{}).Where("id = ? AND revoked_at IS NULL", id).
+		UpdateColumn("revoked_at", time.Now())
+	return res.RowsAffected > 0, res.Error
+}
+
+func (that *ApiKey) Touch(id int64) error {
+	return core.New().DB.Model(&ApiKey{}).Where("id = ?", id).
+		UpdateColumn("last_used_at", time.Now()).Error
+}
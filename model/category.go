@@ -29,6 +29,7 @@ type Category struct {
 	TypeId     int64           `gorm:"column:type_id" json:"TypeId"`         //type:int64             comment:            version:2025-9-28 17:18
 	TypePid    int64           `gorm:"column:type_pid" json:"TypePid"`       //type:int64             comment:            version:2025-9-28 17:18
 	VideoCount int             `gorm:"column:video_count" json:"VideoCount"` //type:*int              comment:            version:2025-10-14 10:29
+	SearchName string          `gorm:"column:search_name;index" json:"-"`    //type:string            comment:名称的检索形式(简体)，繁简不同的同名分类按它去重
 
 	SonCategory []Category `gorm:"foreignKey:ParentId;references:Id" json:"SonCategory"`
 	Category    []Category `gorm:"foreignKey:ParentId;references:Id" json:"Category,omitempty"`
@@ -112,98 +113,57 @@ func (that *Category) HomeList(typeId int64) (categorySonArr []Category) {
 	return
 }
 
-func (that *Category) Create(tx *gorm.DB, cType int, categoryArr []*Category, videoClass VideoClass) (categoryIds []int64) {
+// Create 按名称的检索形式查找或创建分类，返回分类 id，已有分类保留原来的名称；VideoCount 不在这里修改，由 video_category 关联变化时调整
+func (that *Category) Create(tx *gorm.DB, cType int, categoryArr []*Category, videoClass VideoClass) (categoryIds []int64, err error) {
 	if tx == nil {
 		tx = core.New().DB.DB.DB
 	}
 	for index := range categoryArr {
 		category := categoryArr[index]
+		if category == nil || strings.TrimSpace(category.Name) == "" {
+			return nil, NewValidationError("Category name is required")
+		}
 		var parentCategory Category
-		tx.Unscoped().Where("name = ?", category.Name).First(&parentCategory)
+		if err = tx.Unscoped().Where("search_name = ?", SearchText(category.Name)).Limit(1).Find(&parentCategory).Error; err != nil {
+			return nil, dbError("Failed to query category", err)
+		}
 		if parentCategory.Id <= 0 {
 			parentCategory.Name = category.Name
+			parentCategory.SearchName = SearchText(category.Name)
 			parentCategory.Type = &cType
-			tx.Create(&parentCategory)
+			if err = tx.Create(&parentCategory).Error; err != nil {
+				return nil, dbError("Failed to create category", err)
+			}
 		}
 		if len(category.Category) > 0 {
 			for index := range category.Category {
-				names := strings.Split(category.Category[index].Name, ",")
-				if len(names) == 1 {
-					names = strings.Split(category.Category[index].Name, "/")
-				}
-
-				if len(names) == 1 {
-					names = strings.Split(category.Category[index].Name, "、")
-				}
-				if len(names) == 1 {
-					names = strings.Split(category.Category[index].Name, "，")
-				}
-				if len(names) == 1 {
-					names = strings.Split(category.Category[index].Name, ".")
-				}
-				if len(names) == 1 {
-					names = strings.Split(category.Category[index].Name, ":")
-				}
-				if len(names) == 1 {
-					names = strings.Split(category.Category[index].Name, "：")
-				}
-				if len(names) == 1 {
-					names = strings.Split(category.Category[index].Name, ";")
-				}
-				if len(names) == 1 {
-					names = strings.Split(category.Category[index].Name, "；")
-				}
-
-				if len(names) == 1 {
-					names = strings.Split(category.Category[index].Name, "\\")
-				}
-				if category.Name == "地区" {
-					if len(names) == 1 {
-						names = strings.Split(category.Category[index].Name, " ")
-					}
-				}
-				if category.Name == "演员" {
-					if len(names) == 1 && isChinese(category.Category[index].Name) {
-						names = strings.Split(category.Category[index].Name, " ")
-					}
-				}
-				for i := range names {
-					name := strings.TrimSpace(names[i])
-					if name == "" {
-						continue
-					}
-					if category.Name == "年代" {
-						if len(name) != 4 {
-							continue
-						}
-					}
-					if category.Name == "地区" {
-						name = normalizeRegionName(name)
-					}
+				for _, name := range splitCategoryNames(category.Name, category.Category[index].Name) {
 					var sonCategory Category
-					tx.Unscoped().Where("name = ?", name).
-						Where("type = ?", cType).First(&sonCategory)
+					if err = tx.Unscoped().Where("search_name = ?", SearchText(name)).
+						Where("type = ?", cType).Limit(1).Find(&sonCategory).Error; err != nil {
+						return nil, dbError("Failed to query category", err)
+					}
 
 					if sonCategory.Id <= 0 {
 						sonCategory.ParentId = parentCategory.Id
 						sonCategory.Name = name
+						sonCategory.SearchName = SearchText(name)
 						sonCategory.Type = &cType
 						if category.Name == "类型" {
 							sonCategory.TypeId = videoClass.TypeId
 							sonCategory.TypePid = videoClass.TypePid
 						}
-						sonCategory.VideoCount = 1
-						tx.Create(&sonCategory)
-					} else {
-						updates := map[string]any{
-							"video_count": gorm.Expr("video_count + 1"),
+						if err = tx.Create(&sonCategory).Error; err != nil {
+							return nil, dbError("Failed to create category", err)
 						}
-						if category.Name == "类型" {
-							updates["type_id"] = videoClass.TypeId
-							updates["type_pid"] = videoClass.TypePid
+					} else if category.Name == "类型" {
+						if err = tx.Model(&Category{}).Where("id = ?", sonCategory.Id).
+							UpdateColumns(map[string]any{
+								"type_id":  videoClass.TypeId,
+								"type_pid": videoClass.TypePid,
+							}).Error; err != nil {
+							return nil, dbError("Failed to update category", err)
 						}
-						tx.Model(&Category{}).Where("id = ?", sonCategory.Id).
-							UpdateColumns(&updates)
 					}
 					categoryIds = append(categoryIds, sonCategory.Id)
 				}
@@ -214,3 +174,86 @@ func (that *Category) Create(tx *gorm.DB, cType int, categoryArr []*Category, vi
 	}
 	return
 }
+
+// splitCategoryNames 按常见分隔符拆分子分类名称，年代只保留 4 位，地区名称标准化
+func splitCategoryNames(parentName string, value string) (names []string) {
+	parts := strings.Split(value, ",")
+	for _, sep := range []string{"/", "、", "，", ".", ":", "：", ";", "；", "\\"} {
+		if len(parts) > 1 {
+			break
+		}
+		parts = strings.Split(value, sep)
+	}
+	if parentName == "地区" {
+		if len(parts) == 1 {
+			parts = strings.Split(value, " ")
+		}
+	}
+	if parentName == "演员" {
+		if len(parts) == 1 && isChinese(value) {
+			parts = strings.Split(value, " ")
+		}
+	}
+	for i := range parts {
+		name := strings.TrimSpace(parts[i])
+		if name == "" {
+			continue
+		}
+		if parentName == "年代" {
+			if len(name) != 4 {
+				continue
+			}
+		}
+		if parentName == "地区" {
+			name = normalizeRegionName(name)
+		}
+		names = append(names, name)
+	}
+	return
+}
+
+// IncrVideoCount 调整分类的视频数，delta 为负时不会减到 0 以下
+func (that *Category) IncrVideoCount(tx *gorm.DB, categoryIds []int64, delta int) error {
+	if tx == nil {
+		tx = core.New().DB.DB.DB
+	}
+	if len(categoryIds) == 0 || delta == 0 {
+		return nil
+	}
+	expr := gorm.Expr("video_count + ?", delta)
+	if delta < 0 {
+		expr = gorm.Expr("GREATEST(video_count - ?, 0)", -delta)
+	}
+	return tx.Model(&Category{}).Where("id IN ?", categoryIds).
+		UpdateColumn("video_count", expr).Error
+}
+
+// CategoryCount 分类记录的视频数与按 video_category 统计的实际视频数
+type CategoryCount struct {
+	Id         int64
+	Name       string
+	VideoCount int
+	Actual     int
+}
+
+// ListVideoCountDrift 返回 video_count 与实际关联视频数不一致的分类，已删除的视频和关联不计入
+func (that *Category) ListVideoCountDrift() (data []CategoryCount, err error) {
+	db := core.New().DB
+	actual := db.Table("video_category").
+		Select("video_category.category_id, COUNT(*) AS actual").
+		Joins("INNER JOIN video ON video.id = video_category.video_id AND video.deleted_at IS NULL").
+		Where("video_category.deleted_at IS NULL").
+		Group("video_category.category_id")
+	err = db.Model(&Category{}).
+		Select("category.id, category.name, category.video_count, COALESCE(a.actual, 0) AS actual").
+		Joins("LEFT JOIN (?) AS a ON a.category_id = category.id", actual).
+		Where("category.video_count <> COALESCE(a.actual, 0)").
+		Order("category.id ASC").
+		Scan(&data).Error
+	return
+}
+
+func (that *Category) SetVideoCount(id int64, count int) error {
+	return core.New().DB.Model(&Category{}).Where("id = ?", id).
+		UpdateColumn("video_count", count).Error
+}
@@ -0,0 +1,196 @@
+package model
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+
+	"video/core"
+
+	"gorm.io/gorm"
+)
+
+// yearCategoryName 年代父分类的名称，子分类名称为 4 位年份
+const yearCategoryName = "年代"
+
+// CategoryFilter 分类筛选。同一父分类(地区、年代、类型)下的 id 为"或"，不同父分类之间为"且"；
+// 视频属于 Exclude 中任一分类时排除
+type CategoryFilter struct {
+	Include []int64    `json:"Include,omitempty"`
+	Exclude []int64    `json:"Exclude,omitempty"`
+	Year    *YearRange `json:"Year,omitempty"` // 与 Include 中的年代分类同组
+}
+
+// YearRange 年代范围，From、To 为 0 时不限
+type YearRange struct {
+	From int `json:"From,omitempty"`
+	To   int `json:"To,omitempty"`
+}
+
+// ParseCategoryIds 解析逗号分隔的分类 id，"-id" 表示排除，如 "1,2,-3"
+func ParseCategoryIds(s string) (filter CategoryFilter, err error) {
+	clean := strings.Trim(strings.TrimSpace(s), "\"'")
+	for _, p := range strings.Split(clean, ",") {
+		if p = strings.Trim(strings.TrimSpace(p), "\"'"); p == "" {
+			continue
+		}
+		exclude := strings.HasPrefix(p, "-")
+		id, err := strconv.ParseInt(strings.TrimPrefix(p, "-"), 10, 64)
+		if err != nil || id <= 0 {
+			return CategoryFilter{}, NewValidationError("Invalid CategoryId: " + p)
+		}
+		if exclude {
+			filter.Exclude = append(filter.Exclude, id)
+		} else {
+			filter.Include = append(filter.Include, id)
+		}
+	}
+	filter.normalize()
+	return
+}
+
+// ParseCategoryFilter 解析 JSON 格式的筛选条件，如 {"Include":[1,2],"Exclude":[3],"Year":{"From":2010,"To":2019}}
+func ParseCategoryFilter(s string) (filter CategoryFilter, err error) {
+	if err = json.Unmarshal([]byte(s), &filter); err != nil {
+		return CategoryFilter{}, NewValidationError("Invalid Filter")
+	}
+	if filter.Year != nil && filter.Year.From > 0 && filter.Year.To > 0 && filter.Year.From > filter.Year.To {
+		return CategoryFilter{}, NewValidationError("Invalid Filter: Year.From is greater than Year.To")
+	}
+	filter.normalize()
+	return
+}
+
+// Merge 合并另一组筛选条件，other 的年代范围优先
+func (that CategoryFilter) Merge(other CategoryFilter) CategoryFilter {
+	that.Include = append(slices.Clone(that.Include), other.Include...)
+	that.Exclude = append(slices.Clone(that.Exclude), other.Exclude...)
+	if other.Year != nil {
+		that.Year = other.Year
+	}
+	that.normalize()
+	return that
+}
+
+// Empty 是否没有任何分类条件
+func (that *CategoryFilter) Empty() bool {
+	return len(that.Include) == 0 && len(that.Exclude) == 0 && that.Year == nil
+}
+
+// normalize 排序去重，相同条件得到相同的缓存 key 和游标
+func (that *CategoryFilter) normalize() {
+	for _, ids := range []*[]int64{&that.Include, &that.Exclude} {
+		slices.Sort(*ids)
+		*ids = slices.Compact(*ids)
+		if len(*ids) == 0 {
+			*ids = nil
+		}
+	}
+	if that.Year != nil && that.Year.From <= 0 && that.Year.To <= 0 {
+		that.Year = nil
+	}
+}
+
+// key 筛选条件的规范表示，用于游标摘要
+func (that *CategoryFilter) key() string {
+	data, _ := json.Marshal(that)
+	return string(data)
+}
+
+// CategoryGroup 同一父分类下的分类 id，Parent 为 0 表示顶级分类或查不到的分类，单独成组
+type CategoryGroup struct {
+	Parent int64
+	Ids    []int64
+	Year   bool // 父分类为年代
+}
+
+// groupCategoryIds 按父分类分组，parents 为分类 id 到父分类 id 的映射
+func groupCategoryIds(ids []int64, parents map[int64]int64) (groups []CategoryGroup) {
+	index := make(map[int64]int)
+	for _, id := range ids {
+		parent := parents[id]
+		key := parent
+		if parent <= 0 {
+			parent, key = 0, -id
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, CategoryGroup{Parent: parent})
+		}
+		groups[i].Ids = append(groups[i].Ids, id)
+	}
+	return
+}
+
+// groups 查询 Include 的父分类并分组，同时返回年代父分类 id
+func (that *CategoryFilter) groups() (groups []CategoryGroup, yearParents []int64, err error) {
+	if len(that.Include) == 0 && that.Year == nil {
+		return
+	}
+	var categories []Category
+	if err = core.New().DB.Unscoped().Model(&Category{}).Select("id", "parent_id", "name").
+		Where("id IN ?", that.Include).
+		Or("parent_id = 0 AND name = ?", yearCategoryName).
+		Find(&categories).Error; err != nil {
+		return nil, nil, dbError("Failed to query category", err)
+	}
+	parents := make(map[int64]int64, len(categories))
+	for _, category := range categories {
+		parents[category.Id] = category.ParentId
+		if category.ParentId == 0 && category.Name == yearCategoryName {
+			yearParents = append(yearParents, category.Id)
+		}
+	}
+	groups = groupCategoryIds(that.Include, parents)
+	for i := range groups {
+		groups[i].Year = slices.Contains(yearParents, groups[i].Parent)
+	}
+	return groups, yearParents, nil
+}
+
+// Groups 查询 Include 的父分类并分组，供其它搜索实现按同样的规则筛选
+func (that *CategoryFilter) Groups() ([]CategoryGroup, error) {
+	groups, _, err := that.groups()
+	return groups, err
+}
+
+// apply 把分类条件加到视频查询上，每组一个 video_category 子查询
+func (that *CategoryFilter) apply(query *gorm.DB) (*gorm.DB, error) {
+	groups, yearParents, err := that.groups()
+	if err != nil {
+		return nil, err
+	}
+	db := core.New().DB
+	videoIds := func(categoryIds any) *gorm.DB {
+		return db.Model(&VideoCategory{}).Select("video_id").Where("category_id IN (?)", categoryIds)
+	}
+	var years *gorm.DB
+	if that.Year != nil {
+		years = db.Model(&Category{}).Select("id").Where("parent_id IN ?", yearParents)
+		if that.Year.From > 0 {
+			years = years.Where("name >= ?", strconv.Itoa(that.Year.From))
+		}
+		if that.Year.To > 0 {
+			years = years.Where("name <= ?", strconv.Itoa(that.Year.To))
+		}
+	}
+	for _, group := range groups {
+		if years != nil && slices.Contains(yearParents, group.Parent) {
+			// 选中的年代与年代范围同组
+			query = query.Where("(id IN (?) OR id IN (?))", videoIds(group.Ids), videoIds(years))
+			years = nil
+			continue
+		}
+		query = query.Where("id IN (?)", videoIds(group.Ids))
+	}
+	if years != nil {
+		query = query.Where("id IN (?)", videoIds(years))
+	}
+	if len(that.Exclude) > 0 {
+		query = query.Where("id NOT IN (?)", videoIds(that.Exclude))
+	}
+	return query, nil
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCategoryIds(t *testing.T) {
+	filter, err := ParseCategoryIds(` "3, '1',-7,3,,2" `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := CategoryFilter{Include: []int64{1, 2, 3}, Exclude: []int64{7}}
+	if !reflect.DeepEqual(filter, want) {
+		t.Errorf("filter = %+v, want %+v", filter, want)
+	}
+	if filter, err = ParseCategoryIds(""); err != nil || !filter.Empty() {
+		t.Errorf("empty = %+v, %v", filter, err)
+	}
+	for _, s := range []string{"1,abc", "0", "--1"} {
+		if _, err = ParseCategoryIds(s); KindOf(err) != KindValidation {
+			t.Errorf("%q err = %v, want validation error", s, err)
+		}
+	}
+}
+
+func TestParseCategoryFilter(t *testing.T) {
+	filter, err := ParseCategoryFilter(`{"Include":[5,4,5],"Exclude":[9],"Year":{"From":2010,"To":2019}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := CategoryFilter{Include: []int64{4, 5}, Exclude: []int64{9}, Year: &YearRange{From: 2010, To: 2019}}
+	if !reflect.DeepEqual(filter, want) {
+		t.Errorf("filter = %+v, want %+v", filter, want)
+	}
+	if empty, _ := ParseCategoryFilter(`{"Year":{}}`); empty.Year != nil {
+		t.Error("empty year range should be dropped")
+	}
+	for _, s := range []string{`{`, `{"Year":{"From":2020,"To":2010}}`} {
+		if _, err = ParseCategoryFilter(s); KindOf(err) != KindValidation {
+			t.Errorf("%s err = %v, want validation error", s, err)
+		}
+	}
+
+	merged := CategoryFilter{Include: []int64{1}}.Merge(filter)
+	if !reflect.DeepEqual(merged.Include, []int64{1, 4, 5}) || merged.Year == nil {
+		t.Errorf("merged = %+v", merged)
+	}
+}
+
+func TestGroupCategoryIds(t *testing.T) {
+	// 10 地区: 11 香港, 12 台湾；20 年代: 21 2020；30 为顶级分类；99 不存在
+	parents := map[int64]int64{11: 10, 12: 10, 21: 20, 30: 0}
+	groups := groupCategoryIds([]int64{11, 21, 12, 30, 99}, parents)
+	want := []CategoryGroup{
+		{Parent: 10, Ids: []int64{11, 12}},
+		{Parent: 20, Ids: []int64{21}},
+		{Parent: 0, Ids: []int64{30}},
+		{Parent: 0, Ids: []int64{99}},
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("groups = %+v, want %+v", groups, want)
+	}
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"errors"
+	"time"
+	"video/core"
+
+	"gorm.io/gorm"
+)
+
+// CollectCheckpoint  采集断点，每个采集源一条。
+type CollectCheckpoint struct {
+	Id           int64           `gorm:"column:id;primaryKey" json:"Id"`                  //type:int64             comment:
+	CreatedAt    *time.Time      `gorm:"column:created_at" json:"CreatedAt"`              //type:*time.Time        comment:创建时间
+	UpdatedAt    *time.Time      `gorm:"column:updated_at" json:"UpdatedAt"`              //type:*time.Time        comment:更新时间
+	DeletedAt    *gorm.DeletedAt `gorm:"column:deleted_at" json:"DeletedAt"`              //type:*gorm.DeletedAt   comment:删除时间
+	Source       string          `gorm:"column:source;size:64;uniqueIndex" json:"Source"` //type:string            comment:采集源名称
+	LastRunAt    *time.Time      `gorm:"column:last_run_at" json:"LastRunAt"`             //type:*time.Time        comment:上次成功采集的开始时间
+	RunStartedAt *time.Time      `gorm:"column:run_started_at" json:"RunStartedAt"`       //type:*time.Time        comment:进行中采集的开始时间，为空表示没有未完成的采集
+	RunHours     int             `gorm:"column:run_hours" json:"RunHours"`                //type:int               comment:进行中采集使用的 h 参数，0 表示全量
+	LastPage     int             `gorm:"column:last_page" json:"LastPage"`                //type:int               comment:进行中采集已连续完成的最后一页
+}
+
+// TableName 表名:collect_checkpoint，采集断点。
+func (*CollectCheckpoint) TableName() string {
+	return "collect_checkpoint"
+}
+
+// GetBySource 获取采集源的断点，不存在时返回仅带 Source 的空断点
+func (that *CollectCheckpoint) GetBySource(source string) (data CollectCheckpoint, err error) {
+	err = core.New().DB.Where("source = ?", source).First(&data).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+		data.Source = source
+	}
+	return
+}
+
+func (that *CollectCheckpoint) Save() (err error) {
+	return core.New().DB.Save(that).Error
+}
@@ -0,0 +1,62 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+// ErrorKind 模型层错误的类别，调用方据此决定 HTTP 状态码以及是否重试
+type ErrorKind int
+
+const (
+	KindValidation ErrorKind = iota + 1 // 数据不合法，重试也不会成功
+	KindConflict                        // 唯一索引冲突，通常是并发写入同一数据，可重试
+	KindDB                              // 数据库错误，可重试
+)
+
+// Error 模型层错误，Message 可直接返回给调用方，Err 为原始错误
+type Error struct {
+	Kind    ErrorKind
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NewValidationError 创建数据不合法错误
+func NewValidationError(message string) error {
+	return &Error{Kind: KindValidation, Message: message}
+}
+
+// dbError 包装数据库错误，唯一索引冲突归为 KindConflict
+func dbError(message string, err error) error {
+	if err == nil {
+		return nil
+	}
+	kind := KindDB
+	var mysqlErr *mysql.MySQLError
+	if errors.Is(err, gorm.ErrDuplicatedKey) || (errors.As(err, &mysqlErr) && mysqlErr.Number == 1062) {
+		kind = KindConflict
+	}
+	return &Error{Kind: kind, Message: message, Err: err}
+}
+
+// KindOf 返回错误链中第一个模型层错误的类别，不是模型层错误时返回 0
+func KindOf(err error) ErrorKind {
+	var modelErr *Error
+	if errors.As(err, &modelErr) {
+		return modelErr.Kind
+	}
+	return 0
+}
@@ -0,0 +1,124 @@
+package model
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"video/core"
+)
+
+// FacetNames 返回分面统计的父分类，顺序即返回顺序
+var FacetNames = []string{"类型", yearCategoryName, "地区", "语言"}
+
+// Facet 父分类下各子分类在当前查询条件下的视频数
+type Facet struct {
+	Id    int64       `json:"Id"`
+	Name  string      `json:"Name"`
+	Items []FacetItem `json:"Items"`
+}
+
+// FacetItem 子分类及其视频数，视频数为 0 的子分类不返回
+type FacetItem struct {
+	Id    int64  `gorm:"column:id" json:"Id"`
+	Name  string `gorm:"column:name" json:"Name"`
+	Count int64  `gorm:"column:count" json:"Count"`
+}
+
+// facetQuery 统计某个父分类时去掉该分类下已选的条件，同组内为"或"，选中一项后其它项的数量不变
+func facetQuery(q VideoQuery, groups []CategoryGroup, parent int64, yearParents []int64) VideoQuery {
+	q.Page, q.PageSize, q.Id, q.Cursor = 0, 0, 0, ""
+	var include []int64
+	for _, group := range groups {
+		if group.Parent != parent {
+			include = append(include, group.Ids...)
+		}
+	}
+	q.Category.Include = include
+	if slices.Contains(yearParents, parent) {
+		q.Category.Year = nil
+	}
+	q.Category.normalize()
+	return q
+}
+
+// FacetScope 统计一个父分类时的查询条件，见 facetQuery
+type FacetScope struct {
+	Parent Category
+	Query  VideoQuery
+}
+
+// FacetScopes 按 FacetNames 的顺序返回存在的父分类及统计它时的查询条件，MySQL 和 Elasticsearch 的分面统计共用
+func FacetScopes(q VideoQuery) (scopes []FacetScope, err error) {
+	var parents []Category
+	if err = core.New().DB.Model(&Category{}).Select("id", "name").
+		Where("parent_id = 0 AND name IN ?", FacetNames).
+		Find(&parents).Error; err != nil {
+		return nil, dbError("Failed to query category", err)
+	}
+	groups, yearParents, err := q.Category.groups()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range FacetNames {
+		for _, parent := range parents {
+			if parent.Name == name {
+				scopes = append(scopes, FacetScope{Parent: parent, Query: facetQuery(q, groups, parent.Id, yearParents)})
+			}
+		}
+	}
+	return
+}
+
+// FacetChildren 返回父分类下的子分类，只有 id 和名称
+func FacetChildren(parentId int64) (data []Category, err error) {
+	err = core.New().DB.Model(&Category{}).Select("id", "name").
+		Where("parent_id = ?", parentId).
+		Find(&data).Error
+	return data, dbError("Failed to query category", err)
+}
+
+// SortFacetItems 年代按年份倒序，其它按视频数倒序，数量相同时按 id 升序
+func SortFacetItems(name string, items []FacetItem) {
+	slices.SortStableFunc(items, func(a, b FacetItem) int {
+		if name == yearCategoryName {
+			return strings.Compare(b.Name, a.Name)
+		}
+		if a.Count != b.Count {
+			return cmp.Compare(b.Count, a.Count)
+		}
+		return cmp.Compare(a.Id, b.Id)
+	})
+}
+
+// Facets 按关键词、分类、类型条件统计 FacetNames 中每个父分类下子分类的视频数
+func (that *Video) Facets(q VideoQuery) (facets []Facet, err error) {
+	scopes, err := FacetScopes(q)
+	if err != nil {
+		return nil, err
+	}
+	db := core.New().DB
+	for _, scope := range scopes {
+		videoQuery, err := that.filter(scope.Query)
+		if err != nil {
+			return nil, err
+		}
+		order := "count DESC, id"
+		if scope.Parent.Name == yearCategoryName {
+			order = "name DESC"
+		}
+		facet := Facet{Id: scope.Parent.Id, Name: scope.Parent.Name, Items: []FacetItem{}}
+		if err = db.Model(&VideoCategory{}).
+			Select("category.id AS id, category.name AS name, COUNT(DISTINCT video_category.video_id) AS count").
+			Joins("INNER JOIN category ON category.id = video_category.category_id AND category.deleted_at IS NULL").
+			Where("category.parent_id = ?", scope.Parent.Id).
+			Where("video_category.video_id IN (?)", videoQuery.Select("id")).
+			Group("category.id, category.name").
+			Order(order).
+			Scan(&facet.Items).Error; err != nil {
+			return nil, dbError("Failed to count facet", err)
+		}
+		facets = append(facets, facet)
+	}
+	return
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFacetQuery(t *testing.T) {
+	q := VideoQuery{
+		Page:     2,
+		KeyWord:  "三体",
+		Category: CategoryFilter{Include: []int64{11, 12, 21, 30}, Exclude: []int64{40}, Year: &YearRange{From: 2010}},
+		Cursor:   "x",
+	}
+	groups := []CategoryGroup{
+		{Parent: 10, Ids: []int64{11, 12}},
+		{Parent: 20, Ids: []int64{21}},
+		{Parent: 0, Ids: []int64{30}},
+	}
+	region := facetQuery(q, groups, 10, []int64{20})
+	want := CategoryFilter{Include: []int64{21, 30}, Exclude: []int64{40}, Year: &YearRange{From: 2010}}
+	if !reflect.DeepEqual(region.Category, want) || region.Page != 0 || region.Cursor != "" || region.KeyWord != "三体" {
+		t.Errorf("region facet query = %+v", region)
+	}
+	year := facetQuery(q, groups, 20, []int64{20})
+	want = CategoryFilter{Include: []int64{11, 12, 30}, Exclude: []int64{40}}
+	if !reflect.DeepEqual(year.Category, want) {
+		t.Errorf("year facet query = %+v", year.Category)
+	}
+	if len(q.Category.Include) != 4 {
+		t.Error("facetQuery modified the original query")
+	}
+}
+
+func TestSortFacetItems(t *testing.T) {
+	items := []FacetItem{{Id: 3, Name: "喜剧", Count: 2}, {Id: 1, Name: "动作", Count: 5}, {Id: 2, Name: "爱情", Count: 2}}
+	SortFacetItems("类型", items)
+	if items[0].Id != 1 || items[1].Id != 2 || items[2].Id != 3 {
+		t.Errorf("sorted by count = %+v", items)
+	}
+	years := []FacetItem{{Id: 1, Name: "2019", Count: 9}, {Id: 2, Name: "2023", Count: 1}, {Id: 3, Name: "2021", Count: 5}}
+	SortFacetItems(yearCategoryName, years)
+	if years[0].Name != "2023" || years[1].Name != "2021" || years[2].Name != "2019" {
+		t.Errorf("sorted by year = %+v", years)
+	}
+}
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"errors"
+	"time"
+	"video/core"
+
+	"gorm.io/gorm"
+)
+
+const (
+	LineStatusUnknown = 0 // 未检测
+	LineStatusLive    = 1 // 可播放
+	LineStatusDead    = 2 // 连续失败达到阈值
+)
+
+// LineHealth  播放线路健康状态，每个 VideoUrl 的每条线路一条。
+type LineHealth struct {
+	Id         int64           `gorm:"column:id;primaryKey" json:"Id"`                            //type:int64             comment:
+	CreatedAt  *time.Time      `gorm:"column:created_at" json:"CreatedAt"`                        //type:*time.Time        comment:创建时间
+	UpdatedAt  *time.Time      `gorm:"column:updated_at" json:"UpdatedAt"`                        //type:*time.Time        comment:更新时间
+	DeletedAt  *gorm.DeletedAt `gorm:"column:deleted_at" json:"DeletedAt"`                        //type:*gorm.DeletedAt   comment:删除时间
+	VideoId    int64           `gorm:"column:video_id;index:idx_video_id" json:"VideoId"`         //type:int64             comment:视频id
+	VideoUrlId int64           `gorm:"column:video_url_id;uniqueIndex:uk_line" json:"VideoUrlId"` //type:int64             comment:视频地址id
+	Line       string          `gorm:"column:line;size:64;uniqueIndex:uk_line" json:"Line"`       //type:string            comment:播放线路
+	Status     int             `gorm:"column:status" json:"Status"`                               //type:int               comment:状态 0 未检测 1 可播放 2 失效
+	HttpStatus int             `gorm:"column:http_status" json:"HttpStatus"`                      //type:int               comment:最近一次检测的 HTTP 状态码
+	LatencyMs  int64           `gorm:"column:latency_ms" json:"LatencyMs"`                        //type:int64             comment:最近一次检测耗时(毫秒)
+	FailCount  int             `gorm:"column:fail_count" json:"FailCount"`                        //type:int               comment:连续失败次数
+	LastError  string          `gorm:"column:last_error;size:255" json:"LastError"`               //type:string            comment:最近一次失败原因
+	CheckedAt  *time.Time      `gorm:"column:checked_at;index:idx_checked_at" json:"CheckedAt"`   //type:*time.Time        comment:最近检测时间
+}
+
+// TableName 表名:line_health，播放线路健康状态。
+func (*LineHealth) TableName() string {
+	return "line_health"
+}
+
+func (that *LineHealth) GetByLine(videoUrlId int64, line string) (data LineHealth, err error) {
+	err = core.New().DB.Where("video_url_id = ? AND line = ?", videoUrlId, line).First(&data).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+		data.VideoUrlId = videoUrlId
+		data.Line = line
+	}
+	return
+}
+
+func (that *LineHealth) Save() error {
+	return core.New().DB.Save(that).Error
+}
+
+// ListByVideoId 返回视频各线路的健康状态，key 为 VideoUrlId + 线路
+func (that *LineHealth) ListByVideoId(videoId int64) (data map[LineKey]LineHealth, err error) {
+	var list []LineHealth
+	if err = core.New().DB.Where("video_id = ?", videoId).Find(&list).Error; err != nil {
+		return
+	}
+	data = make(map[LineKey]LineHealth, len(list))
+	for _, item := range list {
+		data[LineKey{VideoUrlId: item.VideoUrlId, Line: item.Line}] = item
+	}
+	return
+}
+
+// LineKey 一条播放线路
+type LineKey struct {
+	VideoUrlId int64
+	Line       string
+}
+
+// ListLineSamples 每条线路取 Sort 最小的一集作为检测样本，按 (video_url_id, line) 游标分页，after 为上一页最后一条线路；
+// 沿 idx_video_url_line 索引顺序分组，每页只读取本页的线路，不对全表分组；随视频软删除的分集不参与
+func ListLineSamples(after LineKey, limit int) (samples []VideoEpisode, err error) {
+	db := core.New().DB
+	var firsts []VideoEpisode
+	// deleted_at 在索引中，过滤软删除的分集时分组仍只需读索引
+	if err = db.Model(&VideoEpisode{}).
+		Select("video_url_id, line, MIN(sort) AS sort").
+		Where("video_url_id > ? OR (video_url_id = ? AND line > ?)", after.VideoUrlId, after.VideoUrlId, after.Line).
+		Group("video_url_id, line").
+		Order("video_url_id ASC, line ASC").
+		Limit(limit).
+		Find(&firsts).Error; err != nil || len(firsts) == 0 {
+		return
+	}
+	keys := make([][]any, len(firsts))
+	for i, first := range firsts {
+		keys[i] = []any{first.VideoUrlId, first.Line, first.Sort}
+	}
+	var episodes []VideoEpisode
+	if err = db.Where("(video_url_id, line, sort) IN ?", keys).
+		Order("video_url_id ASC, line ASC, id ASC").
+		Find(&episodes).Error; err != nil {
+		return
+	}
+	// 同一线路同一 Sort 有多条时取 id 最小的
+	for _, episode := range episodes {
+		if n := len(samples); n > 0 && samples[n-1].VideoUrlId == episode.VideoUrlId && samples[n-1].Line == episode.Line {
+			continue
+		}
+		samples = append(samples, episode)
+	}
+	return
+}
+
+// CreateLineSampleIndex 建立 video_episode 的 (video_url_id, line, deleted_at, sort) 索引，线路检测按该索引分页取样本
+func CreateLineSampleIndex() error {
+	migrator := core.New().DB.Migrator()
+	if migrator.HasIndex(&VideoEpisode{}, "idx_video_url_line") {
+		return nil
+	}
+	return migrator.CreateIndex(&VideoEpisode{}, "idx_video_url_line")
+}
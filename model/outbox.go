@@ -0,0 +1,113 @@
+package model
+
+import (
+	"time"
+	"video/core"
+
+	"gorm.io/gorm"
+)
+
+// Outbox  待发布的领域事件，与业务数据在同一事务写入，由 relay 发布后标记。
+type Outbox struct {
+	Id          int64           `gorm:"column:id;primaryKey" json:"Id"`                                 //type:int64             comment:
+	CreatedAt   *time.Time      `gorm:"column:created_at" json:"CreatedAt"`                             //type:*time.Time        comment:创建时间
+	UpdatedAt   *time.Time      `gorm:"column:updated_at" json:"UpdatedAt"`                             //type:*time.Time        comment:更新时间
+	DeletedAt   *gorm.DeletedAt `gorm:"column:deleted_at" json:"DeletedAt"`                             //type:*gorm.DeletedAt   comment:删除时间
+	EventId     string          `gorm:"column:event_id;size:64;uniqueIndex:uk_event_id" json:"EventId"` //type:string            comment:事件id，消费方据此去重
+	EventType   string          `gorm:"column:event_type;size:64" json:"EventType"`                     //type:string            comment:事件类型 video.created 等
+	MessageKey  string          `gorm:"column:message_key;size:64" json:"MessageKey"`                   //type:string            comment:消息 key，同一视频的事件进入同一分区
+	Payload     string          `gorm:"column:payload;type:text" json:"Payload"`                        //type:string            comment:事件 JSON
+	Attempts    int             `gorm:"column:attempts" json:"Attempts"`                                //type:int               comment:发布失败次数
+	LastError   string          `gorm:"column:last_error;size:255" json:"LastError"`                    //type:string            comment:最近一次发布失败原因
+	PublishedAt *time.Time      `gorm:"column:published_at;index:idx_published_at" json:"PublishedAt"`  //type:*time.Time        comment:发布时间，为空表示待发布
+	SentAt      *time.Time      `gorm:"column:sent_at" json:"SentAt"`                                   //type:*time.Time        comment:发送到 Kafka 的时间，发布后处理失败重试时不再重复发送
+	DeadAt      *time.Time      `gorm:"column:dead_at" json:"DeadAt"`                                   //type:*time.Time        comment:多次发布失败后放弃的时间，不再重试
+}
+
+// TableName 表名:outbox，待发布的领域事件。
+func (*Outbox) TableName() string {
+	return "outbox"
+}
+
+func (that *Outbox) Create(tx *gorm.DB) error {
+	if tx == nil {
+		tx = core.New().DB.DB.DB
+	}
+	return tx.Create(that).Error
+}
+
+// ListPending 按写入顺序返回未发布且未放弃的事件
+func (that *Outbox) ListPending(limit int) (data []Outbox, err error) {
+	err = core.New().DB.Where("published_at IS NULL AND dead_at IS NULL").
+		Order("id ASC").
+		Limit(limit).
+		Find(&data).Error
+	return
+}
+
+func (that *Outbox) MarkPublished(id int64) error {
+	return core.New().DB.Model(&Outbox{}).Where("id = ?", id).
+		UpdateColumn("published_at", time.Now()).Error
+}
+
+// MarkSent 记录事件已发送到 Kafka，发布后的处理成功后再 MarkPublished
+func (that *Outbox) MarkSent(id int64) error {
+	return core.New().DB.Model(&Outbox{}).Where("id = ?", id).
+		UpdateColumn("sent_at", time.Now()).Error
+}
+
+func (that *Outbox) MarkFailed(id int64, lastError string) error {
+	if len(lastError) > 255 {
+		lastError = lastError[:255]
+	}
+	return core.New().DB.Model(&Outbox{}).Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{
+			"attempts":   gorm.Expr("attempts + 1"),
+			"last_error": lastError,
+		}).Error
+}
+
+// MarkDead 放弃发布，事件保留在表中供排查，可清空 dead_at 后重新发布
+func (that *Outbox) MarkDead(id int64, lastError string) error {
+	if len(lastError) > 255 {
+		lastError = lastError[:255]
+	}
+	return core.New().DB.Model(&Outbox{}).Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{
+			"attempts":   gorm.Expr("attempts + 1"),
+			"last_error": lastError,
+			"dead_at":    time.Now(),
+		}).Error
+}
+
+// DeletePublished 删除 before 之前发布的事件，每次最多删除 limit 条，返回删除数量
+func (that *Outbox) DeletePublished(before time.Time, limit int) (int64, error) {
+	result := core.New().DB.Unscoped().Where("published_at < ?", before).
+		Limit(limit).Delete(&Outbox{})
+	return result.RowsAffected, result.Error
+}
+
+// ListAfter 按 id 升序返回 id 大于 afterId 的事件，包括已发布的
+func (that *Outbox) ListAfter(afterId int64, limit int) (data []Outbox, err error) {
+	err = core.New().DB.Where("id > ?", afterId).
+		Order("id ASC").
+		Limit(limit).
+		Find(&data).Error
+	return
+}
+
+// MaxId 返回 id 大于 afterId 的事件中最大的 id，eventTypes 不为空时只统计这些类型，没有时返回 0
+func (that *Outbox) MaxId(afterId int64, eventTypes ...string) (int64, error) {
+	query := core.New().DB.Model(&Outbox{}).Where("id > ?", afterId)
+	if len(eventTypes) > 0 {
+		query = query.Where("event_type IN ?", eventTypes)
+	}
+	var maxId *int64
+	if err := query.Select("MAX(id)").Scan(&maxId).Error; err != nil {
+		return 0, err
+	}
+	if maxId == nil {
+		return 0, nil
+	}
+	return *maxId, nil
+}
@@ -1,12 +1,14 @@
 package model
 
 import (
+	"fmt"
 	"regexp"
 	"strings"
 	"time"
 	"unicode"
 
 	"video/core"
+	"video/pkg/pinyin"
 
 	"gorm.io/gorm"
 )
@@ -33,7 +35,11 @@ type Video struct {
 	TypePid      int64           `gorm:"column:type_pid" json:"TypePid"`  //type:int64             comment:                        version:2025-9-28 17:45
 	TypeId       int64           `gorm:"column:type_id" json:"TypeId"`    //type:int64             comment:                        version:2025-9-28 17:45
 	VideoUrlArr  []VideoUrl      `gorm:"foreignKey:VideoId;references:Id" json:"VideoUrlArr"`
-	Browse       int             `gorm:"column:browse" json:"Browse"` // type:*int              comment:                        version:2025-10-04 21:43
+	Browse       int             `gorm:"column:browse" json:"Browse"`            // type:*int              comment:                        version:2025-10-04 21:43
+	SearchTitle  string          `gorm:"column:search_title;index" json:"-"`     //type:string            comment:标题的检索形式(简体)，去重和关键词检索使用，见 SearchText
+	SearchAlias  string          `gorm:"column:search_alias;type:text" json:"-"` //type:string            comment:别名的检索形式(简体)
+	Pinyin       string          `gorm:"column:pinyin;type:text" json:"-"`       //type:string            comment:标题、别名、演员的拼音全拼和首字母，空格分隔
+	Score        float64         `gorm:"column:score;->;-:migration" json:"-"`   //type:float64           comment:搜索相关性得分，只在 List 查询时有值
 }
 
 // TableName 表名:video，。
@@ -41,115 +47,135 @@ func (*Video) TableName() string {
 	return "video"
 }
 
-func (that *Video) Create(tx *gorm.DB) (err error) {
+// Create 按标题的检索形式 + type_pid 去重，繁简不同的同名视频视为同一个，已存在则更新，created 表示是否新建
+func (that *Video) Create(tx *gorm.DB) (created bool, err error) {
 	if tx == nil {
 		tx = core.New().DB.DB.DB
 	}
 	if that.Title == "" {
-		return
+		return false, NewValidationError("Title is required")
 	}
+	that.SearchTitle = SearchText(that.Title)
+	that.SearchAlias = SearchText(that.Alias)
 	var oldVideo Video
-	tx.Where("title = ?", that.Title).
+	if err = tx.Where("search_title = ?", that.SearchTitle).
 		Where("type_pid = ?", that.TypePid).
-		First(&oldVideo)
+		Limit(1).Find(&oldVideo).Error; err != nil {
+		return false, dbError("Failed to query video", err)
+	}
 	if oldVideo.Id > 0 {
-		tx.Where("id = ?", oldVideo.Id).Updates(that)
+		// 保留已有的标题，避免不同来源的繁简写法来回覆盖
+		that.Title = oldVideo.Title
+		if err = tx.Where("id = ?", oldVideo.Id).Updates(that).Error; err != nil {
+			return false, dbError("Failed to update video", err)
+		}
 		that.Id = oldVideo.Id
 	} else {
-		err = tx.Create(that).Error
+		if err = tx.Create(that).Error; err != nil {
+			return false, dbError("Failed to create video", err)
+		}
+		created = true
 	}
 	return
 }
 
-func (that *Video) List(page int, pageSize int, id int64, keyWord string, categoryId string, typeId int64) (data []Video, total int64, err error) {
+// filter 按关键词、分类、类型构建查询条件，Count 和 List 共用
+func (that *Video) filter(q VideoQuery) (*gorm.DB, error) {
 	// 1. 构建基础查询条件
 	queryBuilder := core.New().DB.Model(&Video{})
 
-	// 关键词过滤：根据中文/短词决定使用全文检索或 LIKE
-	useSearch := false
-	if keyWord != "" {
-		kw := strings.TrimSpace(keyWord)
-		if kw != "" {
-			useSearch = true
-			if containsHan(kw) || isShortAsciiQuery(kw) {
-				// 中文或过短英文：使用 LIKE 回退，兼容短词与未启用 ngram 分词的 MySQL
-				like := "%" + kw + "%"
-				queryBuilder = queryBuilder.Where("(title LIKE ? OR alias LIKE ? OR keywords LIKE ?)", like, like, like)
-			} else {
-				// 英文/拼音等较规范的检索：使用 BOOLEAN MODE（仅 title 有 FULLTEXT）+ 短语 LIKE 兜底
-				bq := buildBooleanQuery(kw)
-				like := "%" + kw + "%"
-				queryBuilder = queryBuilder.Where("(MATCH(title) AGAINST(? IN BOOLEAN MODE) OR title LIKE ? OR alias LIKE ? OR keywords LIKE ?)", bq, like, like, like)
-			}
-		}
+	// 关键词过滤：按当前检索方式使用全文索引或 LIKE，见 keywordCondition
+	if kw := q.Keyword(); kw != "" {
+		cond, args := keywordCondition(kw)
+		queryBuilder = queryBuilder.Where(cond, args...)
 	}
 
-	if categoryId != "" {
-		// ... (解析 ids 的代码和上面一样)
-		clean := strings.Trim(strings.TrimSpace(categoryId), "\"'")
-		var ids []string
-		if strings.Contains(clean, ",") {
-			parts := strings.Split(clean, ",")
-			for _, p := range parts {
-				p = strings.Trim(strings.TrimSpace(p), "\"'")
-				if p != "" {
-					ids = append(ids, p)
-				}
-			}
-		} else if clean != "" {
-			ids = append(ids, clean)
+	if !q.Category.Empty() {
+		var err error
+		if queryBuilder, err = q.Category.apply(queryBuilder); err != nil {
+			return nil, err
 		}
+	}
+	if q.TypeId > 0 {
+		queryBuilder = queryBuilder.Where("type_pid IN (?)", q.TypeId)
+	}
+	return queryBuilder, nil
+}
 
-		if len(ids) > 0 {
-			subQuery := core.New().DB.Model(&VideoCategory{}).
-				Select("video_id").
-				Where("category_id IN ?", ids).
-				Group("video_id").
-				Having("COUNT(DISTINCT category_id) = ?", len(ids))
-
-			queryBuilder = queryBuilder.Where("id IN (?)", subQuery)
-		}
+// Count 符合条件的视频数
+func (that *Video) Count(q VideoQuery) (total int64, err error) {
+	queryBuilder, err := that.filter(q)
+	if err != nil {
+		return 0, err
+	}
+	err = queryBuilder.Count(&total).Error
+	return
+}
 
+// List 查询一页视频。q.Cursor 不为空时从游标位置继续，否则按 Page 偏移；
+// 返回的 nextCursor 为最后一条的排序值，不足一页时为空
+func (that *Video) List(q VideoQuery) (data []Video, nextCursor string, err error) {
+	if q.Page <= 0 {
+		q.Page = 1
 	}
-	if typeId > 0 {
-		queryBuilder = queryBuilder.Where("type_pid IN (?)", typeId)
+	if q.PageSize <= 0 {
+		q.PageSize = 30
 	}
-	// 2. 使用构建好的查询条件执行 Count
-	err = queryBuilder.Count(&total).Error
+	sort := q.Sort()
+	queryBuilder, err := that.filter(q)
 	if err != nil {
-		return
+		return nil, "", err
 	}
-	if total == 0 {
-		return // 如果总数为0，没必要执行后续的Find查询
-	}
-	// 3. 排序（在 Count 之后再追加 Select/Order，避免干扰 Count）
-	if categoryId != "" || (useSearch && keyWord != "") {
-		kw := strings.TrimSpace(keyWord)
-		if kw == "" {
-			queryBuilder = queryBuilder.Order("browse DESC, id DESC")
-		} else if containsHan(kw) || isShortAsciiQuery(kw) {
-			// LIKE 分支：构造一个简易的相关性得分
-			like := "%" + kw + "%"
-			scoreCase := "(CASE WHEN title = ? THEN 200 WHEN title LIKE ? THEN 80 WHEN alias LIKE ? THEN 60 WHEN keywords LIKE ? THEN 30 ELSE 0 END) AS score"
-			queryBuilder = queryBuilder.Select("video.*, "+scoreCase, kw, like, like, like).
-				Order("score DESC, browse DESC, id DESC")
-		} else {
-			// BOOLEAN MODE 分支：多字段加权 + 精确匹配强力加权
-			bq := buildBooleanQuery(kw)
-			like := "%" + kw + "%"
-			scoreExpr := "((MATCH(title) AGAINST(? IN BOOLEAN MODE))*3 + (CASE WHEN title = ? THEN 200 ELSE 0 END) + (CASE WHEN title LIKE ? THEN 80 WHEN alias LIKE ? THEN 60 WHEN keywords LIKE ? THEN 30 ELSE 0 END)) AS score"
-			queryBuilder = queryBuilder.Select("video.*, "+scoreExpr, bq, kw, like, like, like).
-				Order("score DESC, browse DESC, id DESC")
-		}
-	} else {
+
+	// 排序：关键词按相关性，分类按浏览数，其它按 id
+	var score string
+	var scoreArgs []any
+	switch sort {
+	case SortScore:
+		score, scoreArgs = scoreExpr(q.Keyword())
+		queryBuilder = queryBuilder.Select("video.*, "+score+" AS score", scoreArgs...).
+			Order("score DESC, browse DESC, id DESC")
+	case SortBrowse:
+		queryBuilder = queryBuilder.Order("browse DESC, id DESC")
+	default:
 		queryBuilder = queryBuilder.Order("id DESC")
 	}
-	// 3. 在同样的查询条件下，添加分页和排序，执行 Find
-	err = queryBuilder.Where("id > ?", id).
-		Offset((page - 1) * pageSize).
-		Limit(pageSize).
-		Find(&data).Error
 
+	if q.Cursor != "" {
+		var cursor videoCursor
+		if cursor, err = decodeCursor(q.Cursor); err != nil || cursor.Sort != sort || cursor.Query != q.Hash() {
+			return nil, "", NewValidationError("Invalid Cursor")
+		}
+		// 按排序元组取游标之后的行：(score, browse, id) < (cursor...)
+		switch sort {
+		case SortScore:
+			args := append([]any{}, scoreArgs...)
+			args = append(args, cursor.Score)
+			args = append(args, scoreArgs...)
+			args = append(args, cursor.Score, cursor.Browse, cursor.Browse, cursor.Id)
+			queryBuilder = queryBuilder.Where("("+score+" < ? OR ("+score+" = ? AND (browse < ? OR (browse = ? AND id < ?))))", args...)
+		case SortBrowse:
+			queryBuilder = queryBuilder.Where("(browse < ? OR (browse = ? AND id < ?))", cursor.Browse, cursor.Browse, cursor.Id)
+		default:
+			queryBuilder = queryBuilder.Where("id < ?", cursor.Id)
+		}
+	} else {
+		// 兼容旧的 Page/Id 参数
+		queryBuilder = queryBuilder.Where("id > ?", q.Id).Offset((q.Page - 1) * q.PageSize)
+	}
+	if err = queryBuilder.Limit(q.PageSize).Find(&data).Error; err != nil {
+		return
+	}
+	if len(data) == q.PageSize {
+		last := data[len(data)-1]
+		nextCursor = encodeCursor(videoCursor{
+			Sort:   sort,
+			Score:  last.Score,
+			Browse: int64(last.Browse),
+			Id:     last.Id,
+			Query:  q.Hash(),
+		})
+	}
 	return
 }
 
@@ -164,6 +190,93 @@ func (that *Video) Del(id int64) (err error) {
 	return
 }
 
+// ListByIds 按 id 查询视频，不保证顺序
+func (that *Video) ListByIds(ids []int64) (data []Video, err error) {
+	if len(ids) == 0 {
+		return
+	}
+	err = core.New().DB.Where("id IN ?", ids).Find(&data).Error
+	return
+}
+
+// UpdatePinyin 按标题、别名和 categoryIds 中的演员生成拼音，入库时在分类写入后调用
+func (that *Video) UpdatePinyin(tx *gorm.DB, categoryIds []int64) error {
+	if tx == nil {
+		tx = core.New().DB.DB.DB
+	}
+	var actors []string
+	if len(categoryIds) > 0 {
+		if err := tx.Model(&Category{}).
+			Joins("INNER JOIN category AS parent ON parent.id = category.parent_id").
+			Where("category.id IN ? AND parent.name = ?", categoryIds, "演员").
+			Pluck("category.name", &actors).Error; err != nil {
+			return dbError("Failed to query actors", err)
+		}
+	}
+	that.Pinyin = pinyin.Keywords(append([]string{that.Title, that.Alias}, actors...)...)
+	if err := tx.Model(&Video{}).Where("id = ?", that.Id).UpdateColumn("pinyin", that.Pinyin).Error; err != nil {
+		return dbError("Failed to update pinyin", err)
+	}
+	return nil
+}
+
+// ListAfter 按 id 升序查询 id 大于 afterId 的视频，用于全量遍历
+func (that *Video) ListAfter(afterId int64, limit int) (data []Video, err error) {
+	err = core.New().DB.Where("id > ?", afterId).Order("id").Limit(limit).Find(&data).Error
+	return
+}
+
+// ListTopBrowse 按总浏览数排序，typePid 为 0 时不限类型
+func (that *Video) ListTopBrowse(typePid int64, limit int) (data []Video, err error) {
+	query := core.New().DB.Model(&Video{})
+	if typePid > 0 {
+		query = query.Where("type_pid = ?", typePid)
+	}
+	err = query.Order("browse DESC, id DESC").Limit(limit).Find(&data).Error
+	return
+}
+
+// browseIndexes 按浏览数排序的索引，排行和按浏览数排序的列表按索引顺序读取，不需要对全表排序
+var browseIndexes = []struct {
+	name    string
+	columns string
+}{
+	{"idx_video_type_pid_browse", "type_pid, browse, id"},
+	{"idx_video_browse", "browse, id"},
+}
+
+// CreateBrowseIndexes 建立按浏览数排序的索引，已存在时跳过，由 go run ./cmd/migrate -task browse_index 执行
+func CreateBrowseIndexes() error {
+	for _, index := range browseIndexes {
+		exists, err := videoIndexExists(index.name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if err = core.New().DB.Exec(fmt.Sprintf("ALTER TABLE video ADD INDEX %s (%s)", index.name, index.columns)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddBrowse 批量增加浏览数，相同增量的视频合并为一条 UPDATE
+func (that *Video) AddBrowse(tx *gorm.DB, counts map[int64]int64) error {
+	byDelta := make(map[int64][]int64)
+	for id, n := range counts {
+		byDelta[n] = append(byDelta[n], id)
+	}
+	for delta, ids := range byDelta {
+		if err := tx.Model(&Video{}).Where("id IN ?", ids).
+			UpdateColumn("browse", gorm.Expr("browse + ?", delta)).Error; err != nil {
+			return dbError("Failed to update browse", err)
+		}
+	}
+	return nil
+}
+
 func (that *Video) ListByVideoGroupId(videoGroupId int64) (data []Video) {
 	core.New().DB.Model(that).Where("video_group_id = ?", &videoGroupId).Find(&data)
 	return
@@ -96,3 +96,25 @@ func ListByVideoId(videoId int64) (parentCategory []Category, err error) {
 	}
 	return
 }
+
+// VideoCategoryName 视频关联的分类及其父分类名称
+type VideoCategoryName struct {
+	VideoId    int64  `gorm:"column:video_id"`
+	CategoryId int64  `gorm:"column:category_id"`
+	Name       string `gorm:"column:name"`
+	ParentName string `gorm:"column:parent_name"`
+}
+
+// ListCategoryNames 批量查询视频关联的分类名称，父分类为顶级分类时 ParentName 为空
+func ListCategoryNames(videoIds []int64) (data []VideoCategoryName, err error) {
+	if len(videoIds) == 0 {
+		return
+	}
+	err = core.New().DB.Model(&VideoCategory{}).
+		Select("video_category.video_id, video_category.category_id, category.name, parent.name AS parent_name").
+		Joins("INNER JOIN category ON category.id = video_category.category_id").
+		Joins("LEFT JOIN category AS parent ON parent.id = category.parent_id").
+		Where("video_category.video_id IN ?", videoIds).
+		Scan(&data).Error
+	return
+}
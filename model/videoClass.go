@@ -32,13 +32,17 @@ func (that *VideoClass) Create(tx *gorm.DB) (err error) {
 		return
 	}
 	var oldVideoClass VideoClass
-	tx.Where("type_name = ?", that.TypeName).
-		First(&oldVideoClass)
+	if err = tx.Where("type_name = ?", that.TypeName).
+		Limit(1).Find(&oldVideoClass).Error; err != nil {
+		return dbError("Failed to query video class", err)
+	}
 
 	if oldVideoClass.Id > 0 {
-		tx.Where("id = ?", oldVideoClass.Id).Updates(that)
-	} else {
-		err = tx.Create(that).Error
+		if err = tx.Where("id = ?", oldVideoClass.Id).Updates(that).Error; err != nil {
+			return dbError("Failed to update video class", err)
+		}
+	} else if err = tx.Create(that).Error; err != nil {
+		return dbError("Failed to create video class", err)
 	}
 	return
 }
@@ -0,0 +1,225 @@
+package model
+
+import (
+	"slices"
+	"sort"
+	"time"
+	"video/core"
+	"video/pkg/playurl"
+
+	"gorm.io/gorm"
+)
+
+// VideoEpisode  视频分集，由 VideoUrl 的 maccms 播放串解析而来。
+type VideoEpisode struct {
+	Id         int64           `gorm:"column:id;primaryKey" json:"Id"`                                                                   //type:int64             comment:
+	CreatedAt  *time.Time      `gorm:"column:created_at" json:"CreatedAt"`                                                               //type:*time.Time        comment:创建时间
+	UpdatedAt  *time.Time      `gorm:"column:updated_at" json:"UpdatedAt"`                                                               //type:*time.Time        comment:更新时间
+	DeletedAt  *gorm.DeletedAt `gorm:"column:deleted_at;index:idx_video_url_line,priority:3" json:"DeletedAt"`                           //type:*gorm.DeletedAt   comment:删除时间
+	VideoId    int64           `gorm:"column:video_id;index:idx_video_id" json:"VideoId"`                                                //type:int64             comment:视频id
+	VideoUrlId int64           `gorm:"column:video_url_id;index:idx_video_url_id;index:idx_video_url_line,priority:1" json:"VideoUrlId"` //type:int64             comment:视频地址id
+	Line       string          `gorm:"column:line;size:64;index:idx_video_url_line,priority:2" json:"Line"`                              //type:string            comment:播放线路
+	Name       string          `gorm:"column:name;size:128" json:"Name"`                                                                 //type:string            comment:集名
+	Sort       int             `gorm:"column:sort;index:idx_video_url_line,priority:4" json:"Sort"`                                      //type:int               comment:线路内排序
+	Url        string          `gorm:"column:url;size:1024" json:"Url"`                                                                  //type:string            comment:播放地址
+	Format     string          `gorm:"column:format;size:16" json:"Format"`                                                              //type:string            comment:格式 m3u8 mp4 flv web
+}
+
+// TableName 表名:video_episode，视频分集。
+func (*VideoEpisode) TableName() string {
+	return "video_episode"
+}
+
+// EpisodeLine 按线路分组的分集，供 /api/v1/video/get 返回
+type EpisodeLine struct {
+	VideoUrlId int64          `json:"VideoUrlId"`
+	ProxyName  string         `json:"ProxyName"`
+	Proxy      string         `json:"Proxy"`
+	Line       string         `json:"Line"`
+	Status     int            `json:"Status"`    // 线路状态，见 LineStatus*
+	LatencyMs  int64          `json:"LatencyMs"` // 最近一次检测耗时
+	CheckedAt  *time.Time     `json:"CheckedAt"`
+	Episodes   []VideoEpisode `json:"Episodes"`
+}
+
+func (that *VideoEpisode) Get(id int64) (data VideoEpisode, err error) {
+	err = core.New().DB.Where("id = ?", id).First(&data).Error
+	return
+}
+
+// SyncByVideoUrl 根据 VideoUrl 的播放串同步其分集：按 (线路, 排序) 更新已有分集、新增新的分集，
+// 只删除播放串中已经没有的分集，重新采集后分集 id 不变
+func (that *VideoEpisode) SyncByVideoUrl(tx *gorm.DB, videoUrl VideoUrl) (err error) {
+	if tx == nil {
+		tx = core.New().DB.DB.DB
+	}
+	if videoUrl.Id <= 0 {
+		return
+	}
+	var existing []VideoEpisode
+	if err = tx.Where("video_url_id = ?", videoUrl.Id).Order("id ASC").Find(&existing).Error; err != nil {
+		return dbError("Failed to list video episodes", err)
+	}
+	parsed := playurl.Parse(videoUrl.PlayFrom, videoUrl.Url)
+	episodes := make([]VideoEpisode, 0, len(parsed))
+	for _, episode := range parsed {
+		episodes = append(episodes, VideoEpisode{
+			VideoId:    videoUrl.VideoId,
+			VideoUrlId: videoUrl.Id,
+			Line:       episode.Line,
+			Name:       episode.Name,
+			Sort:       episode.Sort,
+			Url:        episode.Url,
+			Format:     episode.Format,
+		})
+	}
+	created, updated, removed := diffEpisodes(existing, episodes)
+	if len(removed) > 0 {
+		if err = tx.Unscoped().Where("id IN ?", removed).Delete(&VideoEpisode{}).Error; err != nil {
+			return dbError("Failed to delete video episodes", err)
+		}
+	}
+	for _, episode := range updated {
+		if err = tx.Model(&VideoEpisode{}).Where("id = ?", episode.Id).Updates(map[string]any{
+			"video_id": episode.VideoId,
+			"name":     episode.Name,
+			"url":      episode.Url,
+			"format":   episode.Format,
+		}).Error; err != nil {
+			return dbError("Failed to update video episode", err)
+		}
+	}
+	if len(created) == 0 {
+		return
+	}
+	return dbError("Failed to create video episodes", tx.CreateInBatches(&created, 200).Error)
+}
+
+// episodeKey 同一个 VideoUrl 下分集的唯一标识
+type episodeKey struct {
+	Line string
+	Sort int
+}
+
+// diffEpisodes 按 (线路, 排序) 对比已有分集和新的分集，返回需要新增的、内容有变化需要更新的(带已有 id)
+// 和需要删除的分集 id；已有分集中重复的 (线路, 排序) 只保留 id 最小的一个
+func diffEpisodes(existing, episodes []VideoEpisode) (created, updated []VideoEpisode, removed []int64) {
+	index := make(map[episodeKey]VideoEpisode, len(existing))
+	for _, episode := range existing {
+		key := episodeKey{Line: episode.Line, Sort: episode.Sort}
+		if old, ok := index[key]; ok && old.Id < episode.Id {
+			removed = append(removed, episode.Id)
+			continue
+		}
+		index[key] = episode
+	}
+	seen := make(map[episodeKey]bool, len(episodes))
+	for _, episode := range episodes {
+		key := episodeKey{Line: episode.Line, Sort: episode.Sort}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		old, ok := index[key]
+		if !ok {
+			created = append(created, episode)
+			continue
+		}
+		if old.VideoId != episode.VideoId || old.Name != episode.Name || old.Url != episode.Url || old.Format != episode.Format {
+			episode.Id = old.Id
+			updated = append(updated, episode)
+		}
+	}
+	for key, episode := range index {
+		if !seen[key] {
+			removed = append(removed, episode.Id)
+		}
+	}
+	slices.Sort(removed)
+	return
+}
+
+// ListLinesByVideoId 返回视频的分集，按 VideoUrl 和线路分组，组内按 Sort 排序；
+// 失效线路不返回，可播放的线路排在前面
+func (that *VideoEpisode) ListLinesByVideoId(videoId int64) (lines []EpisodeLine, err error) {
+	db := core.New().DB
+	var videoUrls []VideoUrl
+	if err = db.Where("video_id = ?", videoId).Order("id ASC").Find(&videoUrls).Error; err != nil {
+		return
+	}
+	if len(videoUrls) == 0 {
+		return
+	}
+	var episodes []VideoEpisode
+	if err = db.Where("video_id = ?", videoId).
+		Order("video_url_id ASC, sort ASC, id ASC").Find(&episodes).Error; err != nil {
+		return
+	}
+	index := make(map[int64]map[string]int)
+	for _, videoUrl := range videoUrls {
+		index[videoUrl.Id] = make(map[string]int)
+	}
+	for _, episode := range episodes {
+		lineIndex, ok := index[episode.VideoUrlId]
+		if !ok {
+			continue
+		}
+		i, ok := lineIndex[episode.Line]
+		if !ok {
+			var videoUrl VideoUrl
+			for _, item := range videoUrls {
+				if item.Id == episode.VideoUrlId {
+					videoUrl = item
+				}
+			}
+			lines = append(lines, EpisodeLine{
+				VideoUrlId: videoUrl.Id,
+				ProxyName:  videoUrl.ProxyName,
+				Proxy:      videoUrl.Proxy,
+				Line:       episode.Line,
+			})
+			i = len(lines) - 1
+			lineIndex[episode.Line] = i
+		}
+		lines[i].Episodes = append(lines[i].Episodes, episode)
+	}
+	var lineHealth LineHealth
+	health, err := lineHealth.ListByVideoId(videoId)
+	if err != nil {
+		return
+	}
+	lines = SortLinesByHealth(lines, health)
+	return
+}
+
+// SortLinesByHealth 去掉失效线路，按 可播放 > 未检测 排序，同状态按检测耗时升序
+func SortLinesByHealth(lines []EpisodeLine, health map[LineKey]LineHealth) []EpisodeLine {
+	kept := lines[:0]
+	for _, line := range lines {
+		if item, ok := health[LineKey{VideoUrlId: line.VideoUrlId, Line: line.Line}]; ok {
+			line.Status = item.Status
+			line.LatencyMs = item.LatencyMs
+			line.CheckedAt = item.CheckedAt
+		}
+		if line.Status == LineStatusDead {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	rank := func(status int) int {
+		if status == LineStatusLive {
+			return 0
+		}
+		return 1
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		if ri, rj := rank(kept[i].Status), rank(kept[j].Status); ri != rj {
+			return ri < rj
+		}
+		if kept[i].Status == LineStatusLive {
+			return kept[i].LatencyMs < kept[j].LatencyMs
+		}
+		return false
+	})
+	return kept
+}
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffEpisodes(t *testing.T) {
+	existing := []VideoEpisode{
+		{Id: 1, VideoId: 9, Line: "m3u8", Name: "第01集", Sort: 0, Url: "https://a.com/1.m3u8"},
+		{Id: 2, VideoId: 9, Line: "m3u8", Name: "第02集", Sort: 1, Url: "https://a.com/2.m3u8"},
+		{Id: 3, VideoId: 9, Line: "web", Name: "第01集", Sort: 0, Url: "https://a.com/play/1"},
+		{Id: 4, VideoId: 9, Line: "m3u8", Name: "第01集", Sort: 0, Url: "https://a.com/1.m3u8"},
+	}
+	episodes := []VideoEpisode{
+		{VideoId: 9, Line: "m3u8", Name: "第01集", Sort: 0, Url: "https://a.com/1.m3u8"},
+		{VideoId: 9, Line: "m3u8", Name: "第02集", Sort: 1, Url: "https://b.com/2.m3u8"},
+		{VideoId: 9, Line: "m3u8", Name: "第03集", Sort: 2, Url: "https://a.com/3.m3u8"},
+	}
+	created, updated, removed := diffEpisodes(existing, episodes)
+	if len(created) != 1 || created[0].Sort != 2 || created[0].Id != 0 {
+		t.Errorf("created = %+v", created)
+	}
+	if len(updated) != 1 || updated[0].Id != 2 || updated[0].Url != "https://b.com/2.m3u8" {
+		t.Errorf("updated = %+v", updated)
+	}
+	// 不再出现的线路和重复的分集删除，未变化的分集保持原 id
+	if !reflect.DeepEqual(removed, []int64{3, 4}) {
+		t.Errorf("removed = %v", removed)
+	}
+
+	created, updated, removed = diffEpisodes(existing[:3], nil)
+	if created != nil || updated != nil || !reflect.DeepEqual(removed, []int64{1, 2, 3}) {
+		t.Errorf("empty play url: created = %v, updated = %v, removed = %v", created, updated, removed)
+	}
+}
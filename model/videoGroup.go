@@ -22,7 +22,8 @@ func (*VideoGroup) TableName() string {
 	return "video_group"
 }
 
-func (that *VideoGroup) Edit(tx *gorm.DB) {
+// Edit 按标题查找或创建分组并回填 Id，标题为空时不处理
+func (that *VideoGroup) Edit(tx *gorm.DB) (err error) {
 	if tx == nil {
 		tx = core.New().DB.DB.DB
 	}
@@ -30,7 +31,9 @@ func (that *VideoGroup) Edit(tx *gorm.DB) {
 		return
 	}
 	var videoGroupData VideoGroup
-	tx.Model(that).Where("title = ?", that.Title).First(&videoGroupData)
+	if err = tx.Where("title = ?", that.Title).Limit(1).Find(&videoGroupData).Error; err != nil {
+		return dbError("Failed to query video group", err)
+	}
 
 	if videoGroupData.Id > 0 {
 		that.Id = videoGroupData.Id
@@ -38,6 +41,10 @@ func (that *VideoGroup) Edit(tx *gorm.DB) {
 		if that.IsHide <= 0 {
 			that.IsHide = 2
 		}
-		tx.Model(that).Create(&that)
+		that.Id = 0
+		if err = tx.Create(that).Error; err != nil {
+			return dbError("Failed to create video group", err)
+		}
 	}
+	return
 }
@@ -0,0 +1,73 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+)
+
+// List 的排序方式
+const (
+	SortId     = "id"     // id DESC
+	SortBrowse = "browse" // browse DESC, id DESC
+	SortScore  = "score"  // 相关性 DESC, browse DESC, id DESC
+)
+
+// VideoQuery 视频列表的查询条件
+type VideoQuery struct {
+	Page     int
+	PageSize int
+	Id       int64 // 兼容旧参数，只在按 Page 翻页时生效：id > Id
+	KeyWord  string
+	Category CategoryFilter
+	TypeId   int64
+	Cursor   string // 上一页返回的 NextCursor，不为空时忽略 Page 和 Id
+}
+
+// Keyword 去掉首尾空白的关键词
+func (that *VideoQuery) Keyword() string {
+	return SearchText(that.KeyWord)
+}
+
+// Sort 排序方式：关键词按相关性，分类按浏览数，其它按 id
+func (that *VideoQuery) Sort() string {
+	if that.Keyword() != "" {
+		return SortScore
+	}
+	if len(that.Category.Include) > 0 || that.Category.Year != nil {
+		return SortBrowse
+	}
+	return SortId
+}
+
+// Hash 查询条件的摘要，游标只能用于生成它的查询
+func (that *VideoQuery) Hash() string {
+	key := that.Keyword() + "\x00" + that.Category.key() + "\x00" + strconv.FormatInt(that.TypeId, 10)
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:6])
+}
+
+// videoCursor 游标中保存最后一条的排序值，编码后对调用方不透明
+type videoCursor struct {
+	Sort   string  `json:"s"`
+	Score  float64 `json:"c,omitempty"`
+	Browse int64   `json:"b,omitempty"`
+	Id     int64   `json:"i"`
+	Query  string  `json:"q"`
+}
+
+func encodeCursor(cursor videoCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursor videoCursor, err error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &cursor)
+	return
+}
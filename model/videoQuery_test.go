@@ -0,0 +1,57 @@
+package model
+
+import "testing"
+
+func TestVideoQuerySort(t *testing.T) {
+	cases := []struct {
+		q    VideoQuery
+		want string
+	}{
+		{VideoQuery{}, SortId},
+		{VideoQuery{TypeId: 1}, SortId},
+		{VideoQuery{Category: CategoryFilter{Include: []int64{1, 2}}}, SortBrowse},
+		{VideoQuery{Category: CategoryFilter{Year: &YearRange{From: 2010}}}, SortBrowse},
+		{VideoQuery{Category: CategoryFilter{Exclude: []int64{1}}}, SortId},
+		{VideoQuery{KeyWord: " 三体 ", Category: CategoryFilter{Include: []int64{1}}}, SortScore},
+		{VideoQuery{KeyWord: "  "}, SortId},
+	}
+	for _, c := range cases {
+		if got := c.q.Sort(); got != c.want {
+			t.Errorf("%+v sort = %s, want %s", c.q, got, c.want)
+		}
+	}
+}
+
+func TestVideoQueryHash(t *testing.T) {
+	a := VideoQuery{KeyWord: "三体", Category: CategoryFilter{Include: []int64{1, 2}}, TypeId: 1, Page: 1}
+	b := VideoQuery{KeyWord: " 三体", Category: CategoryFilter{Include: []int64{1, 2}}, TypeId: 1, Page: 3, Cursor: "x"}
+	if a.Hash() != b.Hash() {
+		t.Error("hash should ignore paging and whitespace")
+	}
+	// 繁体关键词按简体检索
+	c := VideoQuery{KeyWord: "三體 ", Category: CategoryFilter{Include: []int64{1, 2}}, TypeId: 1}
+	if c.Keyword() != "三体" || c.Hash() != a.Hash() {
+		t.Errorf("keyword = %q, hash should match simplified", c.Keyword())
+	}
+	for _, other := range []VideoQuery{
+		{KeyWord: "三体", Category: CategoryFilter{Include: []int64{1}}, TypeId: 1},
+		{KeyWord: "三体", Category: CategoryFilter{Include: []int64{1}, Exclude: []int64{2}}, TypeId: 1},
+		{KeyWord: "三体", Category: CategoryFilter{Include: []int64{1, 2}}, TypeId: 2},
+		{KeyWord: "三", Category: CategoryFilter{Include: []int64{1, 2}}, TypeId: 1},
+	} {
+		if other.Hash() == a.Hash() {
+			t.Errorf("%+v has the same hash as %+v", other, a)
+		}
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	want := videoCursor{Sort: SortScore, Score: 83.25, Browse: 12, Id: 99, Query: "abc"}
+	got, err := decodeCursor(encodeCursor(want))
+	if err != nil || got != want {
+		t.Fatalf("decode = %+v, %v", got, err)
+	}
+	if _, err = decodeCursor("not a cursor!"); err == nil {
+		t.Error("expected error for invalid cursor")
+	}
+}
@@ -0,0 +1,231 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"video/core"
+	"video/pkg/pinyin"
+	"video/pkg/zhconv"
+)
+
+// SearchStrategy 关键词检索方式，启动时由 DetectSearchStrategy 根据索引选择
+type SearchStrategy string
+
+const (
+	// SearchTitle 只有 title 的 FULLTEXT 索引：中文和短词使用 LIKE，其它使用 MATCH(title)
+	SearchTitle SearchStrategy = "title"
+	// SearchNgram search_title、search_alias、keywords、describe、pinyin 上有 ngram FULLTEXT 索引，中文和拼音也走索引
+	SearchNgram SearchStrategy = "ngram"
+)
+
+// NgramIndex ngram 全文索引的名称，由 go run ./cmd/migrate -task ngram 创建
+const NgramIndex = "ft_video_search_pinyin_ngram"
+
+// legacyNgramIndexes 旧版本的 ngram 索引：建在 title、alias 原文上的，以及不含 pinyin 的，CreateNgramIndex 时删除
+var legacyNgramIndexes = []string{"ft_video_ngram", "ft_video_search_ngram"}
+
+// ngramColumns MATCH 的列必须与索引的列一致
+const ngramColumns = "search_title, search_alias, keywords, `describe`, pinyin"
+
+// maxPinyinPrefix 没有 ngram 索引时，只有不超过该长度的纯字母输入才按拼音前缀匹配 pinyin 列，如首字母 "xyj"；
+// pinyin 列上没有索引，更长的输入多为英文，仍只走 MATCH(title)，不为拼音放弃全文索引
+const maxPinyinPrefix = 6
+
+// ngramTokenSize 与 MySQL 默认的 ngram_token_size 一致，更短的词无法命中索引
+const ngramTokenSize = 2
+
+// 相关性分档：标题完全一致 > 标题包含 > 别名包含 > 关键词包含 > 只有简介命中；
+// 全文相关性只用于同一档内排序，最多加 ngramScoreCap，不会超过相邻两档的差距
+const (
+	scoreExactTitle = 200
+	scoreTitle      = 80
+	scoreAlias      = 60
+	scoreKeywords   = 30 // 拼音命中与关键词同档
+	ngramScoreCap   = 20
+)
+
+var (
+	searchStrategy atomic.Value
+	// ngramCleaner 去掉会被当作 BOOLEAN MODE 运算符的符号
+	ngramCleaner = regexp.MustCompile(`[^\p{L}\p{N}\s]+`)
+)
+
+// SearchText 标题、别名、分类名称和关键词的检索形式：去掉首尾空格，繁体转为简体；原文另外保存用于展示
+func SearchText(s string) string {
+	return zhconv.Simplify(strings.TrimSpace(s))
+}
+
+// CurrentSearchStrategy 当前的检索方式，未检测时为 SearchTitle
+func CurrentSearchStrategy() SearchStrategy {
+	if strategy, ok := searchStrategy.Load().(SearchStrategy); ok {
+		return strategy
+	}
+	return SearchTitle
+}
+
+func SetSearchStrategy(strategy SearchStrategy) {
+	searchStrategy.Store(strategy)
+}
+
+// DetectSearchStrategy 检查 video 表是否有 ngram 全文索引并设置检索方式，查询失败时保持 SearchTitle
+func DetectSearchStrategy() (SearchStrategy, error) {
+	var count int64
+	err := core.New().DB.Raw(
+		"SELECT COUNT(*) FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ? AND INDEX_TYPE = 'FULLTEXT'",
+		(&Video{}).TableName(), NgramIndex).Scan(&count).Error
+	if err != nil {
+		return CurrentSearchStrategy(), dbError("Failed to query index", err)
+	}
+	strategy := SearchTitle
+	if count > 0 {
+		strategy = SearchNgram
+	}
+	SetSearchStrategy(strategy)
+	return strategy, nil
+}
+
+// SearchColumn 保存简体检索形式的列，由 go run ./cmd/migrate -task zhconv 添加并回填
+type SearchColumn struct {
+	Model any
+	Field string
+}
+
+var SearchColumns = []SearchColumn{{&Video{}, "SearchTitle"}, {&Video{}, "SearchAlias"}, {&Category{}, "SearchName"}}
+
+// CheckSearchColumns 检查检索列是否存在，旧库未迁移时入库和检索的 SQL 都会报错，启动时直接失败并提示迁移
+func CheckSearchColumns() error {
+	migrator := core.New().DB.Migrator()
+	var missing []string
+	for _, column := range SearchColumns {
+		if !migrator.HasColumn(column.Model, column.Field) {
+			missing = append(missing, column.Field)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("缺少检索列 %s，请先执行 go run ./cmd/migrate -task zhconv", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// CreateNgramIndex 在 search_title、search_alias、keywords、describe、pinyin 上建立 ngram 全文索引，已存在时跳过；
+// 检索列由 go run ./cmd/migrate -task zhconv 添加，pinyin 列由 -task pinyin 添加，旧版本的索引同时删除
+func CreateNgramIndex() error {
+	db := core.New().DB
+	if !db.Migrator().HasColumn(&Video{}, "SearchTitle") {
+		return errors.New("video 表没有 search_title 列，请先执行 -task zhconv")
+	}
+	if !db.Migrator().HasColumn(&Video{}, "Pinyin") {
+		return errors.New("video 表没有 pinyin 列，请先执行 -task pinyin")
+	}
+	exists, err := videoIndexExists(NgramIndex)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err = db.Exec(fmt.Sprintf("ALTER TABLE video ADD FULLTEXT INDEX %s (%s) WITH PARSER ngram", NgramIndex, ngramColumns)).Error; err != nil {
+			return err
+		}
+	}
+	for _, name := range legacyNgramIndexes {
+		if exists, err = videoIndexExists(name); err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		if err = db.Exec("ALTER TABLE video DROP INDEX " + name).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func videoIndexExists(name string) (bool, error) {
+	var count int64
+	err := core.New().DB.Raw(
+		"SELECT COUNT(*) FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ?",
+		(&Video{}).TableName(), name).Scan(&count).Error
+	return count > 0, err
+}
+
+// buildNgramQuery 把关键词转换为 ngram BOOLEAN MODE 查询，每个词作为短语必须出现，如 +"三体" +"黑暗森林"；
+// 短于 ngramTokenSize 的词忽略，全部过短时返回空，由调用方改用 LIKE
+func buildNgramQuery(s string) string {
+	var out []string
+	for _, term := range strings.Fields(ngramCleaner.ReplaceAllString(s, " ")) {
+		if utf8.RuneCountInString(term) < ngramTokenSize || isEnglishStopword(term) {
+			continue
+		}
+		out = append(out, `+"`+term+`"`)
+	}
+	return strings.Join(out, " ")
+}
+
+// keywordCondition 关键词的 WHERE 条件；有 ngram 索引时 pinyin 列在索引中，由 MATCH 一并匹配，
+// 否则只有较短的纯字母输入按拼音前缀匹配 pinyin 列中的词
+func keywordCondition(kw string) (string, []any) {
+	cond, args := textCondition(kw)
+	if CurrentSearchStrategy() == SearchNgram && buildNgramQuery(kw) != "" {
+		return cond, args
+	}
+	if py := pinyinPrefix(kw); py != "" {
+		return "(" + cond + " OR CONCAT(' ', pinyin) LIKE ?)", append(args, "% "+py+"%")
+	}
+	return cond, args
+}
+
+// pinyinPrefix 没有 ngram 索引时按拼音前缀匹配的输入，不超过 maxPinyinPrefix 个字母，否则返回空
+func pinyinPrefix(kw string) string {
+	py := pinyin.Normalize(kw)
+	if py == "" || len(py) > maxPinyinPrefix || strings.ContainsAny(py, "0123456789") {
+		return ""
+	}
+	return py
+}
+
+func textCondition(kw string) (string, []any) {
+	like := "%" + kw + "%"
+	if CurrentSearchStrategy() == SearchNgram {
+		if bq := buildNgramQuery(kw); bq != "" {
+			return "MATCH(" + ngramColumns + ") AGAINST(? IN BOOLEAN MODE)", []any{bq}
+		}
+	} else if !containsHan(kw) && !isShortAsciiQuery(kw) {
+		// 英文/拼音等较规范的检索：使用 BOOLEAN MODE（仅 title 有 FULLTEXT）+ 短语 LIKE 兜底
+		return "(MATCH(title) AGAINST(? IN BOOLEAN MODE) OR search_title LIKE ? OR search_alias LIKE ? OR keywords LIKE ?)",
+			[]any{buildBooleanQuery(kw), like, like, like}
+	}
+	// 中文或过短的词：使用 LIKE 回退，匹配简体的检索列
+	return "(search_title LIKE ? OR search_alias LIKE ? OR keywords LIKE ?)", []any{like, like, like}
+}
+
+// scoreExpr 关键词相关性得分，排序和游标条件使用同一个表达式
+func scoreExpr(kw string) (string, []any) {
+	like := "%" + kw + "%"
+	pinyinTier, pinyinArgs := "", []any(nil)
+	if py := pinyin.Normalize(kw); py != "" {
+		pinyinTier, pinyinArgs = fmt.Sprintf(" WHEN pinyin LIKE ? THEN %d", scoreKeywords), []any{"%" + py + "%"}
+	}
+	tiers := fmt.Sprintf("(CASE WHEN search_title = ? THEN %d WHEN search_title LIKE ? THEN %d WHEN search_alias LIKE ? THEN %d WHEN keywords LIKE ? THEN %d%s ELSE 0 END)",
+		scoreExactTitle, scoreTitle, scoreAlias, scoreKeywords, pinyinTier)
+	tierArgs := append([]any{kw, like, like, like}, pinyinArgs...)
+	if CurrentSearchStrategy() == SearchNgram {
+		if bq := buildNgramQuery(kw); bq != "" {
+			// ngram 分支：全文相关性封顶后只在同一档内排序，只有简介命中的排在最后
+			return fmt.Sprintf("(%s + LEAST(MATCH(%s) AGAINST(? IN BOOLEAN MODE), %d))", tiers, ngramColumns, ngramScoreCap),
+				append(tierArgs, bq)
+		}
+		return tiers, tierArgs
+	}
+	if containsHan(kw) || isShortAsciiQuery(kw) {
+		// LIKE 分支：构造一个简易的相关性得分
+		return tiers, tierArgs
+	}
+	// BOOLEAN MODE 分支：多字段加权 + 精确匹配强力加权
+	return fmt.Sprintf("((MATCH(title) AGAINST(? IN BOOLEAN MODE))*3 + (CASE WHEN search_title = ? THEN %d ELSE 0 END) + (CASE WHEN search_title LIKE ? THEN %d WHEN search_alias LIKE ? THEN %d WHEN keywords LIKE ? THEN %d%s ELSE 0 END))",
+		scoreExactTitle, scoreTitle, scoreAlias, scoreKeywords, pinyinTier), append([]any{buildBooleanQuery(kw), kw, like, like, like}, pinyinArgs...)
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildNgramQuery(t *testing.T) {
+	cases := map[string]string{
+		"三体":             `+"三体"`,
+		" 三体  黑暗森林 ":     `+"三体" +"黑暗森林"`,
+		"三 体":            "",
+		"the Three-Body": `+"Three" +"Body"`,
+		`流浪"地球"+2`:       `+"流浪" +"地球"`,
+	}
+	for kw, want := range cases {
+		if got := buildNgramQuery(kw); got != want {
+			t.Errorf("buildNgramQuery(%q) = %q, want %q", kw, got, want)
+		}
+	}
+}
+
+func TestKeywordStrategy(t *testing.T) {
+	defer SetSearchStrategy(CurrentSearchStrategy())
+	cases := []struct {
+		strategy SearchStrategy
+		kw       string
+		where    string // WHERE 条件中应包含的片段
+		score    string // 得分表达式中应包含的片段
+	}{
+		{SearchTitle, "三体", "title LIKE", "THEN 200"},
+		{SearchTitle, "matrix", "MATCH(title)", "MATCH(title)"},
+		{SearchNgram, "三体", "MATCH(" + ngramColumns + ")", "LEAST(MATCH(" + ngramColumns + ")"},
+		{SearchNgram, "三", "title LIKE", "THEN 80"},
+		{SearchTitle, "XYJ", "CONCAT(' ', pinyin) LIKE", "WHEN pinyin LIKE ? THEN 30"},
+		{SearchTitle, "xi you", "CONCAT(' ', pinyin) LIKE", "WHEN pinyin LIKE ? THEN 30"},
+		// 有 ngram 索引时拼音由 MATCH 匹配
+		{SearchNgram, "xiyouji", "MATCH(" + ngramColumns + ")", "WHEN pinyin LIKE ? THEN 30"},
+	}
+	for _, c := range cases {
+		SetSearchStrategy(c.strategy)
+		where, whereArgs := keywordCondition(c.kw)
+		score, scoreArgs := scoreExpr(c.kw)
+		if !strings.Contains(where, c.where) || strings.Count(where, "?") != len(whereArgs) {
+			t.Errorf("%s %q where = %s %v", c.strategy, c.kw, where, whereArgs)
+		}
+		if !strings.Contains(score, c.score) || strings.Count(score, "?") != len(scoreArgs) {
+			t.Errorf("%s %q score = %s %v", c.strategy, c.kw, score, scoreArgs)
+		}
+	}
+	// 中文关键词不匹配拼音，较长的英文不为拼音放弃全文索引
+	SetSearchStrategy(SearchTitle)
+	for _, kw := range []string{"三体", "avengers", "xiyouji"} {
+		if where, _ := keywordCondition(kw); strings.Contains(where, "pinyin") {
+			t.Errorf("%q where = %s", kw, where)
+		}
+	}
+	SetSearchStrategy(SearchNgram)
+	if where, _ := keywordCondition("xiyouji"); strings.Contains(where, " OR ") {
+		t.Errorf("ngram where = %s", where)
+	}
+	SetSearchStrategy(SearchTitle)
+	if _, args := keywordCondition("XYJ"); args[len(args)-1] != "% xyj%" {
+		t.Errorf("pinyin prefix args = %v", args)
+	}
+}
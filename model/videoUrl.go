@@ -1,7 +1,6 @@
 package model
 
 import (
-	"fmt"
 	"time"
 	"video/core"
 
@@ -10,14 +9,16 @@ import (
 
 // VideoUrl  视频地址。
 type VideoUrl struct {
-	Id        int64           `gorm:"column:id;primaryKey" json:"Id"`     //type:int64             comment:            version:2025-9-29 09:01
-	CreatedAt *time.Time      `gorm:"column:created_at" json:"CreatedAt"` //type:*time.Time        comment:创建时间    version:2025-9-29 09:01
-	UpdatedAt *time.Time      `gorm:"column:updated_at" json:"UpdatedAt"` //type:*time.Time        comment:更新时间    version:2025-9-29 09:01
-	DeletedAt *gorm.DeletedAt `gorm:"column:deleted_at" json:"DeletedAt"` //type:*gorm.DeletedAt   comment:删除时间    version:2025-9-29 09:01
-	VideoId   int64           `gorm:"column:video_id" json:"VideoId"`     //type:int64             comment:视频id      version:2025-9-29 09:01
-	Url       string          `gorm:"column:url" json:"Url"`              //type:string            comment:地址        version:2025-9-29 09:01
-	Proxy     string          `gorm:"column:proxy" json:"Proxy"`          //type:string            comment:代理地址    version:2025-9-29 09:01
-	ProxyName string          `gorm:"column:proxy_name" json:"ProxyName"` //type:string            comment:代理名称    version:2025-9-29 09:56
+	Id          int64           `gorm:"column:id;primaryKey" json:"Id"`                 //type:int64             comment:            version:2025-9-29 09:01
+	CreatedAt   *time.Time      `gorm:"column:created_at" json:"CreatedAt"`             //type:*time.Time        comment:创建时间    version:2025-9-29 09:01
+	UpdatedAt   *time.Time      `gorm:"column:updated_at" json:"UpdatedAt"`             //type:*time.Time        comment:更新时间    version:2025-9-29 09:01
+	DeletedAt   *gorm.DeletedAt `gorm:"column:deleted_at" json:"DeletedAt"`             //type:*gorm.DeletedAt   comment:删除时间    version:2025-9-29 09:01
+	VideoId     int64           `gorm:"column:video_id" json:"VideoId"`                 //type:int64             comment:视频id      version:2025-9-29 09:01
+	Url         string          `gorm:"column:url" json:"Url"`                          //type:string            comment:地址        version:2025-9-29 09:01
+	Proxy       string          `gorm:"column:proxy" json:"Proxy"`                      //type:string            comment:代理地址    version:2025-9-29 09:01
+	ProxyName   string          `gorm:"column:proxy_name" json:"ProxyName"`             //type:string            comment:代理名称    version:2025-9-29 09:56
+	PlayFrom    string          `gorm:"column:play_from" json:"PlayFrom"`               //type:string            comment:播放线路，maccms vod_play_from
+	ContentHash string          `gorm:"column:content_hash;size:64" json:"ContentHash"` //type:string            comment:最近一次入库内容的摘要，内容不变时跳过入库
 }
 
 // TableName 表名:video_url，视频地址。
@@ -25,25 +26,32 @@ func (that *VideoUrl) TableName() string {
 	return "video_url"
 }
 
-// TableName 表名:video_url，视频地址。
+// Create 按 video_id + proxy_name 去重，已存在则更新
 func (that *VideoUrl) Create(tx *gorm.DB) (err error) {
 	if tx == nil {
 		tx = core.New().DB.DB.DB
 	}
-	if that.Proxy == "" || that.Url == "" {
-		fmt.Println("12312313123")
-		return
+	// Proxy 为空表示直接播放 Url，没有配置解析线路的来源不带 Proxy
+	if that.Url == "" {
+		return NewValidationError("VideoUrl requires Url")
+	}
+	if that.VideoId <= 0 {
+		return NewValidationError("VideoUrl requires VideoId")
 	}
 	var videoUrl VideoUrl
-	tx.Where("video_id = ?", that.VideoId).
+	if err = tx.Where("video_id = ?", that.VideoId).
 		Where("proxy_name = ?", that.ProxyName).
-		First(&videoUrl)
+		Limit(1).Find(&videoUrl).Error; err != nil {
+		return dbError("Failed to query video url", err)
+	}
 
 	if videoUrl.Id > 0 {
-		tx.Where("id = ?", videoUrl.Id).Updates(that)
-	} else {
-		err = tx.Create(that).Error
+		if err = tx.Where("id = ?", videoUrl.Id).Updates(that).Error; err != nil {
+			return dbError("Failed to update video url", err)
+		}
+		that.Id = videoUrl.Id
+	} else if err = tx.Create(that).Error; err != nil {
+		return dbError("Failed to create video url", err)
 	}
-
 	return
 }
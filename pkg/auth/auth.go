@@ -0,0 +1,368 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"video/config"
+	"video/core"
+	"video/model"
+	"video/pkg/cache"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// KeyPrefix API key 明文的前缀，格式为 vk_<前缀>_<密钥>
+const KeyPrefix = "vk_"
+
+var (
+	ErrBadCredentials = errors.New("invalid name or password")
+	ErrKeyRevoked     = errors.New("api key revoked")
+	ErrKeyNotFound    = errors.New("api key not found")
+	ErrTokenReused    = errors.New("refresh token reused")
+)
+
+// dummyHash 账号不存在时也做一次 bcrypt 比较，避免按响应时间枚举账号
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+	return hash
+})
+
+// Token 登录和刷新返回的 token
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	TokenType    string
+	ExpiresIn    int64 // access token 有效期(秒)
+}
+
+// KeyStore 读写 API key
+type KeyStore interface {
+	GetByPrefix(ctx context.Context, prefix string) (model.ApiKey, error)
+	Create(ctx context.Context, key *model.ApiKey) error
+	List(ctx context.Context) ([]model.ApiKey, error)
+	Revoke(ctx context.Context, id int64) (bool, error)
+	Touch(ctx context.Context, id int64) error
+}
+
+// DBKeyStore 使用 api_key 表
+type DBKeyStore struct{}
+
+func (DBKeyStore) GetByPrefix(ctx context.Context, prefix string) (model.ApiKey, error) {
+	var key model.ApiKey
+	return key.GetByPrefix(prefix)
+}
+
+func (DBKeyStore) Create(ctx context.Context, key *model.ApiKey) error {
+	return key.Create()
+}
+
+func (DBKeyStore) List(ctx context.Context) ([]model.ApiKey, error) {
+	var key model.ApiKey
+	return key.List()
+}
+
+func (DBKeyStore) Revoke(ctx context.Context, id int64) (bool, error) {
+	var key model.ApiKey
+	return key.Revoke(id)
+}
+
+func (DBKeyStore) Touch(ctx context.Context, id int64) error {
+	var key model.ApiKey
+	return key.Touch(id)
+}
+
+// Service 签发和校验 token、管理 API key
+type Service struct {
+	Secret        []byte
+	Expire        time.Duration
+	RefreshExpire time.Duration
+	SSO           bool
+	Users         []config.AuthUser
+	Keys          KeyStore
+	Sessions      SessionStore
+}
+
+var (
+	defaultService *Service
+	defaultOnce    sync.Once
+)
+
+// Default 使用 core 中的 Jwt 配置和账号，首次调用时创建；配置了 Redis 时会话保存在 Redis，多实例共享
+func Default() *Service {
+	defaultOnce.Do(func() {
+		defaultService = New(core.New().Jwt, core.New().ConfigGlobal.Users, DBKeyStore{})
+		if c := cache.Default(); c.Client != nil {
+			defaultService.Sessions = NewRedisSessions(c.Client, c.Prefix)
+		} else {
+			log.Println("未配置 Redis，登录会话保存在进程内：重启后需要重新登录，多实例部署时 refresh token 不能跨实例使用")
+		}
+	})
+	return defaultService
+}
+
+func New(cfg config.UserJwt, users []config.AuthUser, keys KeyStore) *Service {
+	if cfg.Expire <= 0 {
+		cfg.Expire = 7200
+	}
+	if cfg.RefreshExpire <= 0 {
+		cfg.RefreshExpire = 7 * 86400
+	}
+	if cfg.Secret == "" {
+		log.Println("UserJwt.Secret 为空，只能使用 API key 访问写接口")
+	}
+	return &Service{
+		Secret:        []byte(cfg.Secret),
+		Expire:        time.Duration(cfg.Expire) * time.Second,
+		RefreshExpire: time.Duration(cfg.RefreshExpire) * time.Second,
+		SSO:           cfg.SSO,
+		Users:         users,
+		Keys:          keys,
+		Sessions:      NewMemorySessions(),
+	}
+}
+
+// Login 校验账号密码并签发 token，开启 SSO 时该账号之前签发的 token 失效
+func (that *Service) Login(ctx context.Context, name string, password string) (Token, error) {
+	user, ok := that.user(name)
+	var hash []byte
+	if ok {
+		hash = []byte(user.Password)
+	} else {
+		hash = dummyHash()
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || !ok || !ValidRole(user.Role) {
+		return Token{}, ErrBadCredentials
+	}
+	sessionId, refreshId := randomHex(16), randomHex(16)
+	token, err := that.issue(user.Name, user.Role, sessionId, refreshId)
+	if err != nil {
+		return Token{}, err
+	}
+	if err = that.Sessions.Start(ctx, user.Name, sessionId, refreshId, time.Now().Add(that.RefreshExpire), that.SSO); err != nil {
+		return Token{}, err
+	}
+	return token, nil
+}
+
+// Refresh 使用 refresh token 换取新的 token，角色按当前配置重新读取，已删除的账号无法刷新。
+// 每次刷新都换发新的 refresh token，旧的立即失效；已用过的 refresh token 再次使用说明可能已泄露，吊销整个会话
+func (that *Service) Refresh(ctx context.Context, refreshToken string) (Token, error) {
+	claims, err := Parse(that.Secret, refreshToken)
+	if err != nil {
+		return Token{}, err
+	}
+	if claims.Type != TypeRefresh {
+		return Token{}, ErrInvalidToken
+	}
+	if err = that.checkSession(ctx, claims); err != nil {
+		return Token{}, err
+	}
+	user, ok := that.user(claims.Subject)
+	if !ok || !ValidRole(user.Role) {
+		return Token{}, ErrInvalidToken
+	}
+	refreshId := randomHex(16)
+	rotated := false
+	if claims.Id != "" {
+		if rotated, err = that.Sessions.Rotate(ctx, claims.Subject, claims.SessionId, claims.Id, refreshId, time.Now().Add(that.RefreshExpire)); err != nil {
+			return Token{}, err
+		}
+	}
+	if !rotated {
+		log.Printf("账号 %s 的 refresh token 被重复使用，吊销会话 %s", claims.Subject, claims.SessionId)
+		if err = that.Sessions.Revoke(ctx, claims.SessionId); err != nil {
+			return Token{}, err
+		}
+		return Token{}, ErrTokenReused
+	}
+	return that.issue(user.Name, user.Role, claims.SessionId, refreshId)
+}
+
+// Authenticate 校验 access token 或 API key
+func (that *Service) Authenticate(ctx context.Context, token string) (*Claims, error) {
+	if strings.HasPrefix(token, KeyPrefix) {
+		return that.authenticateKey(ctx, token)
+	}
+	claims, err := Parse(that.Secret, token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type != TypeAccess {
+		return nil, ErrInvalidToken
+	}
+	if err = that.checkSession(ctx, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (that *Service) authenticateKey(ctx context.Context, token string) (*Claims, error) {
+	prefix, _, ok := strings.Cut(strings.TrimPrefix(token, KeyPrefix), "_")
+	if !ok || prefix == "" {
+		return nil, ErrInvalidToken
+	}
+	key, err := that.Keys.GetByPrefix(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if key.Id == 0 || subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(hashKey(token))) != 1 {
+		return nil, ErrInvalidToken
+	}
+	now := time.Now()
+	if key.RevokedAt != nil {
+		return nil, ErrKeyRevoked
+	}
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(now) {
+		return nil, ErrTokenExpired
+	}
+	// 最近使用时间精确到分钟即可，避免每次请求都写库
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > time.Minute {
+		if err = that.Keys.Touch(ctx, key.Id); err != nil {
+			log.Printf("更新 api key %d 使用时间失败: %v", key.Id, err)
+		}
+	}
+	claims := &Claims{
+		Subject: KeyPrefix + key.Prefix,
+		Role:    key.Role,
+		Scopes:  splitScopes(key.Scopes),
+		Type:    TypeApiKey,
+		KeyId:   key.Id,
+	}
+	if key.CreatedAt != nil {
+		claims.IssuedAt = key.CreatedAt.Unix()
+	}
+	if key.ExpiresAt != nil {
+		claims.ExpiresAt = key.ExpiresAt.Unix()
+	}
+	return claims, nil
+}
+
+// CreateKey 创建 API key，scopes 为空时使用角色的全部权限。返回的明文只在此时可见
+func (that *Service) CreateKey(ctx context.Context, name string, role string, scopes []string, expiresAt *time.Time) (plain string, key model.ApiKey, err error) {
+	if name == "" {
+		return "", key, model.NewValidationError("Name is required")
+	}
+	if !ValidRole(role) {
+		return "", key, model.NewValidationError("Invalid Role")
+	}
+	if len(scopes) == 0 {
+		scopes = roleScopes[role]
+	}
+	for _, scope := range scopes {
+		if !RoleAllows(role, scope) {
+			return "", key, model.NewValidationError("Scope " + scope + " is not allowed for role " + role)
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", key, model.NewValidationError("ExpiresAt must be in the future")
+	}
+	prefix := randomHex(6)
+	plain = KeyPrefix + prefix + "_" + randomHex(32)
+	key = model.ApiKey{
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   hashKey(plain),
+		Role:      role,
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: expiresAt,
+	}
+	if err = that.Keys.Create(ctx, &key); err != nil {
+		return "", key, err
+	}
+	return plain, key, nil
+}
+
+func (that *Service) ListKeys(ctx context.Context) ([]model.ApiKey, error) {
+	return that.Keys.List(ctx)
+}
+
+// RevokeKey 吊销 API key，立即生效
+func (that *Service) RevokeKey(ctx context.Context, id int64) error {
+	revoked, err := that.Keys.Revoke(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+func (that *Service) issue(subject string, role string, sessionId string, refreshId string) (token Token, err error) {
+	now := time.Now()
+	claims := Claims{
+		Id:        randomHex(16),
+		Subject:   subject,
+		Role:      role,
+		Type:      TypeAccess,
+		SessionId: sessionId,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(that.Expire).Unix(),
+	}
+	if token.AccessToken, err = Sign(that.Secret, claims); err != nil {
+		return
+	}
+	claims.Id = refreshId
+	claims.Type = TypeRefresh
+	claims.ExpiresAt = now.Add(that.RefreshExpire).Unix()
+	if token.RefreshToken, err = Sign(that.Secret, claims); err != nil {
+		return
+	}
+	token.TokenType = "Bearer"
+	token.ExpiresIn = int64(that.Expire / time.Second)
+	return
+}
+
+// checkSession 只接受未吊销的会话，开启 SSO 时只有该账号最近一次登录的会话有效
+func (that *Service) checkSession(ctx context.Context, claims *Claims) error {
+	if claims.SessionId == "" {
+		return ErrInvalidToken
+	}
+	active, err := that.Sessions.Active(ctx, claims.Subject, claims.SessionId)
+	if err != nil {
+		return err
+	}
+	if !active {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+func (that *Service) user(name string) (config.AuthUser, bool) {
+	for _, user := range that.Users {
+		if user.Name == name {
+			return user, true
+		}
+	}
+	return config.AuthUser{}, false
+}
+
+func hashKey(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+func splitScopes(scopes string) []string {
+	var res []string
+	for _, scope := range strings.Split(scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			res = append(res, scope)
+		}
+	}
+	return res
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
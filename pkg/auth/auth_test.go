@@ -0,0 +1,333 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"video/config"
+	"video/model"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// memoryKeys 内存中的 KeyStore
+type memoryKeys struct {
+	keys    []model.ApiKey
+	touched int
+}
+
+func (that *memoryKeys) GetByPrefix(ctx context.Context, prefix string) (model.ApiKey, error) {
+	for _, key := range that.keys {
+		if key.Prefix == prefix {
+			return key, nil
+		}
+	}
+	return model.ApiKey{}, nil
+}
+
+func (that *memoryKeys) Create(ctx context.Context, key *model.ApiKey) error {
+	key.Id = int64(len(that.keys) + 1)
+	now := time.Now()
+	key.CreatedAt = &now
+	that.keys = append(that.keys, *key)
+	return nil
+}
+
+func (that *memoryKeys) List(ctx context.Context) ([]model.ApiKey, error) {
+	return that.keys, nil
+}
+
+func (that *memoryKeys) Revoke(ctx context.Context, id int64) (bool, error) {
+	for i := range that.keys {
+		if that.keys[i].Id == id && that.keys[i].RevokedAt == nil {
+			now := time.Now()
+			that.keys[i].RevokedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (that *memoryKeys) Touch(ctx context.Context, id int64) error {
+	that.touched++
+	for i := range that.keys {
+		if that.keys[i].Id == id {
+			now := time.Now()
+			that.keys[i].LastUsedAt = &now
+		}
+	}
+	return nil
+}
+
+func newTestService(t *testing.T, sso bool) (*Service, *memoryKeys) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := []config.AuthUser{
+		{Name: "admin", Password: string(hash), Role: RoleAdmin},
+		{Name: "viewer", Password: string(hash), Role: RoleViewer},
+	}
+	keys := &memoryKeys{}
+	return New(config.UserJwt{Secret: "test", SSO: sso}, users, keys), keys
+}
+
+func TestSignParse(t *testing.T) {
+	secret := []byte("test")
+	claims := Claims{Subject: "viewer", Role: RoleViewer, Type: TypeAccess, ExpiresAt: time.Now().Add(time.Minute).Unix()}
+	token, err := Sign(secret, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(secret, token)
+	if err != nil || parsed.Subject != "viewer" || parsed.Role != RoleViewer {
+		t.Fatalf("parse = %+v, %v", parsed, err)
+	}
+	if _, err = Parse([]byte("other"), token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("wrong secret err = %v", err)
+	}
+	// 篡改 payload 提升角色
+	parts := strings.Split(token, ".")
+	forged, _ := Sign([]byte("other"), Claims{Subject: "viewer", Role: RoleAdmin, Type: TypeAccess, ExpiresAt: claims.ExpiresAt})
+	if _, err = Parse(secret, parts[0]+"."+strings.Split(forged, ".")[1]+"."+parts[2]); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("forged payload err = %v", err)
+	}
+	noneHeader := "eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0"
+	if _, err = Parse(secret, noneHeader+"."+parts[1]+"."); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("alg none err = %v", err)
+	}
+	claims.ExpiresAt = time.Now().Add(-time.Second).Unix()
+	expired, _ := Sign(secret, claims)
+	if _, err = Parse(secret, expired); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("expired err = %v", err)
+	}
+}
+
+func TestLoginRefresh(t *testing.T) {
+	service, _ := newTestService(t, false)
+	ctx := context.Background()
+	if _, err := service.Login(ctx, "admin", "wrong"); !errors.Is(err, ErrBadCredentials) {
+		t.Fatalf("wrong password err = %v", err)
+	}
+	if _, err := service.Login(ctx, "nobody", "secret"); !errors.Is(err, ErrBadCredentials) {
+		t.Fatalf("unknown user err = %v", err)
+	}
+	token, err := service.Login(ctx, "admin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := service.Authenticate(ctx, token.AccessToken)
+	if err != nil || !claims.Allow(ScopeVideoDelete) || !claims.Allow(ScopeApiKey) {
+		t.Fatalf("admin claims = %+v, %v", claims, err)
+	}
+	// refresh token 不能访问接口，access token 不能刷新
+	if _, err = service.Authenticate(ctx, token.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("refresh token as access err = %v", err)
+	}
+	if _, err = service.Refresh(ctx, token.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("access token as refresh err = %v", err)
+	}
+	refreshed, err := service.Refresh(ctx, token.RefreshToken)
+	if err != nil || refreshed.AccessToken == "" || refreshed.AccessToken == token.AccessToken {
+		t.Fatalf("refresh = %+v, %v", refreshed, err)
+	}
+
+	token, err = service.Login(ctx, "viewer", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err = service.Authenticate(ctx, token.AccessToken)
+	if err != nil || claims.Allow(ScopeVideoWrite) {
+		t.Fatalf("viewer claims = %+v, %v", claims, err)
+	}
+	// 账号从配置删除后无法刷新
+	service.Users = service.Users[:1]
+	if _, err = service.Refresh(ctx, token.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("removed user refresh err = %v", err)
+	}
+}
+
+func TestRefreshRotation(t *testing.T) {
+	service, _ := newTestService(t, false)
+	ctx := context.Background()
+	token, err := service.Login(ctx, "admin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshed, err := service.Refresh(ctx, token.RefreshToken)
+	if err != nil || refreshed.RefreshToken == token.RefreshToken {
+		t.Fatalf("refresh = %+v, %v", refreshed, err)
+	}
+	// 另一次登录的会话不受影响
+	other, err := service.Login(ctx, "admin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 已轮换的 refresh token 再次使用时吊销整个会话
+	if _, err = service.Refresh(ctx, token.RefreshToken); !errors.Is(err, ErrTokenReused) {
+		t.Fatalf("reused refresh token err = %v", err)
+	}
+	if _, err = service.Refresh(ctx, refreshed.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("refresh after revoke err = %v", err)
+	}
+	if _, err = service.Authenticate(ctx, refreshed.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("access token after revoke err = %v", err)
+	}
+	if _, err = service.Authenticate(ctx, other.AccessToken); err != nil {
+		t.Errorf("other session access err = %v", err)
+	}
+	if _, err = service.Refresh(ctx, other.RefreshToken); err != nil {
+		t.Errorf("other session refresh err = %v", err)
+	}
+}
+
+func TestSSO(t *testing.T) {
+	service, _ := newTestService(t, true)
+	ctx := context.Background()
+	first, err := service.Login(ctx, "admin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = service.Authenticate(ctx, first.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+	second, err := service.Login(ctx, "admin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = service.Authenticate(ctx, first.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("old access token err = %v", err)
+	}
+	if _, err = service.Refresh(ctx, first.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("old refresh token err = %v", err)
+	}
+	refreshed, err := service.Refresh(ctx, second.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = service.Authenticate(ctx, refreshed.AccessToken); err != nil {
+		t.Errorf("refreshed access token err = %v", err)
+	}
+}
+
+func TestRedisSessions(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	t.Cleanup(func() { client.Close() })
+	// 两个实例共享 Redis 中的会话
+	first, _ := newTestService(t, true)
+	second, _ := newTestService(t, true)
+	first.Sessions = NewRedisSessions(client, "video:")
+	second.Sessions = NewRedisSessions(client, "video:")
+	ctx := context.Background()
+
+	token, err := first.Login(ctx, "admin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = second.Authenticate(ctx, token.AccessToken); err != nil {
+		t.Fatalf("access token on other instance err = %v", err)
+	}
+	refreshed, err := second.Refresh(ctx, token.RefreshToken)
+	if err != nil {
+		t.Fatalf("refresh on other instance err = %v", err)
+	}
+	if ttl := server.TTL("video:auth:session:" + mustParse(t, refreshed.RefreshToken).SessionId); ttl <= 0 || ttl > first.RefreshExpire {
+		t.Errorf("session ttl = %s", ttl)
+	}
+	// 在任一实例重复使用旧的 refresh token 都会吊销会话
+	if _, err = first.Refresh(ctx, token.RefreshToken); !errors.Is(err, ErrTokenReused) {
+		t.Fatalf("reused refresh token err = %v", err)
+	}
+	if _, err = second.Authenticate(ctx, refreshed.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("access token after revoke err = %v", err)
+	}
+
+	// SSO：重新登录后其它实例上的旧会话失效
+	old, err := first.Login(ctx, "admin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = second.Login(ctx, "admin", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = first.Authenticate(ctx, old.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("old session after sso login err = %v", err)
+	}
+
+	// Redis 不可用时不当作无效 token
+	server.Close()
+	if _, err = first.Login(ctx, "admin", "secret"); err == nil || errors.Is(err, ErrBadCredentials) {
+		t.Errorf("login with redis down err = %v", err)
+	}
+}
+
+func mustParse(t *testing.T, token string) *Claims {
+	t.Helper()
+	claims, err := Parse([]byte("test"), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+func TestApiKey(t *testing.T) {
+	service, keys := newTestService(t, false)
+	ctx := context.Background()
+	if _, _, err := service.CreateKey(ctx, "tiantang", RoleCollector, []string{ScopeVideoDelete}, nil); model.KindOf(err) != model.KindValidation {
+		t.Fatalf("scope outside role err = %v", err)
+	}
+	if _, _, err := service.CreateKey(ctx, "tiantang", "root", nil, nil); model.KindOf(err) != model.KindValidation {
+		t.Fatalf("unknown role err = %v", err)
+	}
+	plain, key, err := service.CreateKey(ctx, "tiantang", RoleCollector, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(plain, KeyPrefix+key.Prefix+"_") || key.KeyHash == "" || strings.Contains(key.KeyHash, plain) {
+		t.Fatalf("plain = %s, key = %+v", plain, key)
+	}
+	claims, err := service.Authenticate(ctx, plain)
+	if err != nil || !claims.Allow(ScopeVideoWrite) || claims.Allow(ScopeVideoDelete) || claims.KeyId != key.Id {
+		t.Fatalf("collector claims = %+v, %v", claims, err)
+	}
+	// 一分钟内重复使用不更新使用时间
+	service.Authenticate(ctx, plain)
+	if keys.touched != 1 {
+		t.Errorf("touched = %d, want 1", keys.touched)
+	}
+	if _, err = service.Authenticate(ctx, plain[:len(plain)-1]+"x"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("wrong secret err = %v", err)
+	}
+
+	// admin 的 key 只授予部分权限
+	plain2, _, err := service.CreateKey(ctx, "ops", RoleAdmin, []string{ScopeVideoWrite}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err = service.Authenticate(ctx, plain2)
+	if err != nil || !claims.Allow(ScopeVideoWrite) || claims.Allow(ScopeApiKey) {
+		t.Fatalf("scoped admin claims = %+v, %v", claims, err)
+	}
+
+	if err = service.RevokeKey(ctx, key.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = service.Authenticate(ctx, plain); !errors.Is(err, ErrKeyRevoked) {
+		t.Errorf("revoked key err = %v", err)
+	}
+	if err = service.RevokeKey(ctx, key.Id); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("revoke twice err = %v", err)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	keys.keys[1].ExpiresAt = &past
+	if _, err = service.Authenticate(ctx, plain2); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("expired key err = %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package auth
+
+// 角色
+const (
+	RoleAdmin     = "admin"     // 全部权限
+	RoleCollector = "collector" // 采集程序，只能写入视频
+	RoleViewer    = "viewer"    // 只读
+)
+
+// 权限范围，API key 可以指定角色权限的子集
+const (
+	ScopeVideoWrite  = "video:write"  // 新增、修改、批量入库
+	ScopeVideoDelete = "video:delete" // 删除、恢复
+	ScopeApiKey      = "apikey"       // 管理 API key
+)
+
+var roleScopes = map[string][]string{
+	RoleAdmin:     {ScopeVideoWrite, ScopeVideoDelete, ScopeApiKey},
+	RoleCollector: {ScopeVideoWrite},
+	RoleViewer:    {},
+}
+
+// ValidRole 判断角色是否存在
+func ValidRole(role string) bool {
+	_, ok := roleScopes[role]
+	return ok
+}
+
+// RoleAllows 判断角色是否拥有 scope
+func RoleAllows(role string, scope string) bool {
+	for _, s := range roleScopes[role] {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SessionStore 保存登录会话和会话当前可用的 refresh token id(jti)
+type SessionStore interface {
+	// Start 登录时新建会话，sso 为 true 时该账号之前的会话全部失效
+	Start(ctx context.Context, subject string, sessionId string, refreshId string, expiresAt time.Time, sso bool) error
+	// Active 会话存在、属于 subject 且未过期
+	Active(ctx context.Context, subject string, sessionId string) (bool, error)
+	// Rotate 会话属于 subject 且当前的 refresh token id 为 refreshId 时换成 next 并返回 true，否则返回 false
+	Rotate(ctx context.Context, subject string, sessionId string, refreshId string, next string, expiresAt time.Time) (bool, error)
+	Revoke(ctx context.Context, sessionId string) error
+}
+
+type session struct {
+	subject   string
+	refreshId string
+	expiresAt time.Time
+}
+
+// MemorySessions 进程内的会话，只适用于单实例部署：重启后需要重新登录，
+// 多实例时一个实例签发的 refresh token 在其它实例上无法使用
+type MemorySessions struct {
+	mu       sync.Mutex
+	sessions map[string]session
+}
+
+func NewMemorySessions() *MemorySessions {
+	return &MemorySessions{sessions: make(map[string]session)}
+}
+
+func (that *MemorySessions) Start(ctx context.Context, subject string, sessionId string, refreshId string, expiresAt time.Time, sso bool) error {
+	that.mu.Lock()
+	defer that.mu.Unlock()
+	now := time.Now()
+	// 登录时顺带清理过期会话
+	for id, s := range that.sessions {
+		if !s.expiresAt.After(now) || (sso && s.subject == subject) {
+			delete(that.sessions, id)
+		}
+	}
+	that.sessions[sessionId] = session{subject: subject, refreshId: refreshId, expiresAt: expiresAt}
+	return nil
+}
+
+func (that *MemorySessions) Active(ctx context.Context, subject string, sessionId string) (bool, error) {
+	that.mu.Lock()
+	defer that.mu.Unlock()
+	s, ok := that.sessions[sessionId]
+	return ok && s.subject == subject && s.expiresAt.After(time.Now()), nil
+}
+
+func (that *MemorySessions) Rotate(ctx context.Context, subject string, sessionId string, refreshId string, next string, expiresAt time.Time) (bool, error) {
+	that.mu.Lock()
+	defer that.mu.Unlock()
+	s, ok := that.sessions[sessionId]
+	if !ok || s.subject != subject || s.refreshId != refreshId {
+		return false, nil
+	}
+	s.refreshId = next
+	s.expiresAt = expiresAt
+	that.sessions[sessionId] = s
+	return true, nil
+}
+
+func (that *MemorySessions) Revoke(ctx context.Context, sessionId string) error {
+	that.mu.Lock()
+	defer that.mu.Unlock()
+	delete(that.sessions, sessionId)
+	return nil
+}
+
+// rotateScript 比较并替换会话的 refresh token id，多个实例同时使用同一个 refresh token 时只有一个成功
+var rotateScript = redis.NewScript(`
+local s = redis.call('HMGET', KEYS[1], 'sub', 'rt')
+if s[1] ~= ARGV[1] or s[2] ~= ARGV[2] then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'rt', ARGV[3])
+redis.call('PEXPIREAT', KEYS[1], ARGV[4])
+return 1
+`)
+
+// RedisSessions 会话保存在 Redis，多实例共享，重启后不需要重新登录。
+// 会话为 hash <Prefix>session:<id>，过期时间与 refresh token 一致；<Prefix>user:<账号> 记录账号的会话，开启 SSO 时据此吊销
+type RedisSessions struct {
+	Client redis.Cmdable
+	Prefix string
+}
+
+func NewRedisSessions(client redis.Cmdable, prefix string) *RedisSessions {
+	return &RedisSessions{Client: client, Prefix: prefix + "auth:"}
+}
+
+func (that *RedisSessions) sessionKey(sessionId string) string {
+	return that.Prefix + "session:" + sessionId
+}
+
+func (that *RedisSessions) userKey(subject string) string {
+	return that.Prefix + "user:" + subject
+}
+
+func (that *RedisSessions) Start(ctx context.Context, subject string, sessionId string, refreshId string, expiresAt time.Time, sso bool) error {
+	userKey := that.userKey(subject)
+	if sso {
+		sessionIds, err := that.Client.SMembers(ctx, userKey).Result()
+		if err != nil {
+			return err
+		}
+		// 集群中各会话的 key 不在同一个 slot，逐个删除
+		if _, err = that.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, id := range sessionIds {
+				pipe.Del(ctx, that.sessionKey(id))
+			}
+			pipe.Del(ctx, userKey)
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	sessionKey := that.sessionKey(sessionId)
+	_, err := that.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, sessionKey, "sub", subject, "rt", refreshId)
+		pipe.ExpireAt(ctx, sessionKey, expiresAt)
+		pipe.SAdd(ctx, userKey, sessionId)
+		pipe.ExpireAt(ctx, userKey, expiresAt)
+		return nil
+	})
+	return err
+}
+
+func (that *RedisSessions) Active(ctx context.Context, subject string, sessionId string) (bool, error) {
+	sub, err := that.Client.HGet(ctx, that.sessionKey(sessionId), "sub").Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return sub == subject, nil
+}
+
+func (that *RedisSessions) Rotate(ctx context.Context, subject string, sessionId string, refreshId string, next string, expiresAt time.Time) (bool, error) {
+	rotated, err := rotateScript.Run(ctx, that.Client, []string{that.sessionKey(sessionId)},
+		subject, refreshId, next, expiresAt.UnixMilli()).Int()
+	if err != nil || rotated == 0 {
+		return false, err
+	}
+	// 账号的会话列表不早于其中的会话过期，SSO 登录时才能找到全部会话
+	return true, that.Client.ExpireAt(ctx, that.userKey(subject), expiresAt).Err()
+}
+
+func (that *RedisSessions) Revoke(ctx context.Context, sessionId string) error {
+	return that.Client.Del(ctx, that.sessionKey(sessionId)).Err()
+}
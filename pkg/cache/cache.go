@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"time"
+
+	"video/config"
+	"video/core"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+)
+
+// Cache 以 JSON 缓存查询结果。同一进程内相同 key 的并发未命中只查询一次数据库；
+// Redis 不可用时直接查询，不影响接口。
+type Cache struct {
+	Client      redis.Cmdable // 为空时不缓存，只合并并发查询
+	Prefix      string
+	GetTTL      time.Duration
+	ListTTL     time.Duration
+	CategoryTTL time.Duration
+	CountTTL    time.Duration
+	MaxListPage int
+	group       singleflight.Group
+}
+
+var (
+	defaultCache *Cache
+	defaultOnce  sync.Once
+)
+
+// Default 使用 core 中的 Redis 和 Cache 配置，首次调用时创建
+func Default() *Cache {
+	defaultOnce.Do(func() {
+		defaultCache = New(Client(), core.New().ConfigGlobal.Cache)
+	})
+	return defaultCache
+}
+
+func New(client redis.Cmdable, cfg config.Cache) *Cache {
+	if cfg.Prefix == "" {
+		cfg.Prefix = "video:"
+	}
+	if cfg.GetTTL <= 0 {
+		cfg.GetTTL = 300
+	}
+	if cfg.ListTTL <= 0 {
+		cfg.ListTTL = 60
+	}
+	if cfg.CategoryTTL <= 0 {
+		cfg.CategoryTTL = 600
+	}
+	if cfg.CountTTL <= 0 {
+		cfg.CountTTL = 300
+	}
+	if cfg.MaxListPage <= 0 {
+		cfg.MaxListPage = 10
+	}
+	return &Cache{
+		Client:      client,
+		Prefix:      cfg.Prefix,
+		GetTTL:      time.Duration(cfg.GetTTL) * time.Second,
+		ListTTL:     time.Duration(cfg.ListTTL) * time.Second,
+		CategoryTTL: time.Duration(cfg.CategoryTTL) * time.Second,
+		CountTTL:    time.Duration(cfg.CountTTL) * time.Second,
+		MaxListPage: cfg.MaxListPage,
+	}
+}
+
+// Load 读取 key 的缓存，未命中时调用 load 并写入缓存，load 返回错误时不缓存
+func Load[T any](ctx context.Context, c *Cache, key string, ttl time.Duration, load func() (T, error)) (T, error) {
+	key = c.Prefix + key
+	var value T
+	if c.Client != nil {
+		data, err := c.Client.Get(ctx, key).Bytes()
+		if err == nil {
+			if err = json.Unmarshal(data, &value); err == nil {
+				return value, nil
+			}
+		}
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("读取缓存 %s 失败: %v", key, err)
+		}
+	}
+	v, err, _ := c.group.Do(key, func() (any, error) {
+		value, err := load()
+		if err != nil || c.Client == nil {
+			return value, err
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			log.Printf("序列化缓存 %s 失败: %v", key, err)
+			return value, nil
+		}
+		// 随机延长最多 10%，避免同时写入的缓存同时过期
+		ttl += rand.N(ttl/10 + 1)
+		if err = c.Client.Set(context.WithoutCancel(ctx), key, data, ttl).Err(); err != nil {
+			log.Printf("写入缓存 %s 失败: %v", key, err)
+		}
+		return value, nil
+	})
+	if err != nil {
+		return value, err
+	}
+	return v.(T), nil
+}
+
+// generation 返回 tag 当前的版本号，key 中带上版本号，Bump 后旧缓存不再被读取，等待过期
+func (that *Cache) generation(ctx context.Context, tag string) string {
+	if that.Client == nil {
+		return "0"
+	}
+	gen, err := that.Client.Get(ctx, that.Prefix+"gen:"+tag).Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("读取缓存版本 %s 失败: %v", tag, err)
+		}
+		return "0"
+	}
+	return gen
+}
+
+// Bump 使 tag 下的所有缓存失效
+func (that *Cache) Bump(ctx context.Context, tags ...string) {
+	if that.Client == nil {
+		return
+	}
+	for _, tag := range tags {
+		if err := that.Client.Incr(ctx, that.Prefix+"gen:"+tag).Err(); err != nil {
+			log.Printf("更新缓存版本 %s 失败: %v", tag, err)
+		}
+	}
+}
+
+// Delete 删除缓存。集群模式下多个 key 可能不在同一个 slot，逐个删除
+func (that *Cache) Delete(ctx context.Context, keys ...string) {
+	if that.Client == nil {
+		return
+	}
+	for _, key := range keys {
+		if err := that.Client.Del(ctx, that.Prefix+key).Err(); err != nil {
+			log.Printf("删除缓存 %s 失败: %v", key, err)
+		}
+	}
+}
+
+func formatId(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
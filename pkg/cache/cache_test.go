@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"video/config"
+	"video/pkg/event"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestCache(t *testing.T) (*Cache, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	t.Cleanup(func() { client.Close() })
+	return New(client, config.Cache{}), server
+}
+
+func TestLoad(t *testing.T) {
+	c, server := newTestCache(t)
+	ctx := context.Background()
+	var loads int
+	load := func() ([]int, error) {
+		loads++
+		return []int{1, 2}, nil
+	}
+	for i := 0; i < 3; i++ {
+		data, err := Load(ctx, c, "k", time.Minute, load)
+		if err != nil || len(data) != 2 {
+			t.Fatalf("Load = %v, %v", data, err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("loads = %d, want 1", loads)
+	}
+	if ttl := server.TTL("video:k"); ttl < time.Minute || ttl > time.Minute+6*time.Second {
+		t.Errorf("ttl = %s", ttl)
+	}
+
+	// 出错时不缓存
+	failed := errors.New("db down")
+	if _, err := Load(ctx, c, "e", time.Minute, func() (int, error) { return 0, failed }); !errors.Is(err, failed) {
+		t.Fatalf("err = %v", err)
+	}
+	if server.Exists("video:e") {
+		t.Error("error result cached")
+	}
+
+	server.FastForward(2 * time.Minute)
+	if _, err := Load(ctx, c, "k", time.Minute, load); err != nil || loads != 2 {
+		t.Errorf("after expire loads = %d, %v", loads, err)
+	}
+}
+
+func TestLoadSingleflight(t *testing.T) {
+	c, _ := newTestCache(t)
+	ctx := context.Background()
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func() (string, error) {
+		loads.Add(1)
+		<-release
+		return "v", nil
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := Load(ctx, c, "hot", time.Minute, load); err != nil || v != "v" {
+				t.Errorf("Load = %q, %v", v, err)
+			}
+		}()
+	}
+	// 等待所有请求进入 singleflight
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := loads.Load(); n != 1 {
+		t.Errorf("loads = %d, want 1", n)
+	}
+}
+
+func TestLoadWithoutRedis(t *testing.T) {
+	ctx := context.Background()
+	c := New(nil, config.Cache{})
+	var loads int
+	for i := 0; i < 2; i++ {
+		if v, err := Load(ctx, c, "k", time.Minute, func() (int, error) { loads++; return 7, nil }); err != nil || v != 7 {
+			t.Fatalf("Load = %d, %v", v, err)
+		}
+	}
+	if loads != 2 {
+		t.Errorf("loads = %d, want 2", loads)
+	}
+
+	// Redis 故障时直接查询
+	c, server := newTestCache(t)
+	server.Close()
+	if v, err := Load(ctx, c, "k", time.Minute, func() (int, error) { return 8, nil }); err != nil || v != 8 {
+		t.Errorf("Load with redis down = %d, %v", v, err)
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	c, server := newTestCache(t)
+	ctx := context.Background()
+	listKey := func() string { return "list:" + c.generation(ctx, TagVideoList) }
+	Load(ctx, c, listKey(), time.Minute, func() (int, error) { return 1, nil })
+	Load(ctx, c, "get:5", time.Minute, func() (int, error) { return 1, nil })
+	Load(ctx, c, "get:6", time.Minute, func() (int, error) { return 1, nil })
+
+	before := listKey()
+	c.HandleEvent(ctx, event.Event{Type: event.VideoViewed, VideoId: 5})
+	if !server.Exists("video:get:5") || listKey() != before {
+		t.Fatal("viewed event invalidated cache")
+	}
+	c.HandleEvent(ctx, event.Event{Type: event.VideoUpdated, VideoId: 5})
+	if server.Exists("video:get:5") || !server.Exists("video:get:6") {
+		t.Error("video.updated should delete only get:5")
+	}
+	if listKey() == before {
+		t.Error("video.updated should bump list generation")
+	}
+	var loads int
+	Load(ctx, c, listKey(), time.Minute, func() (int, error) { loads++; return 2, nil })
+	if loads != 1 {
+		t.Errorf("list not reloaded after invalidation")
+	}
+}
@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"video/config"
+	"video/core"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// InitRedis 按配置连接 Redis，RedisCluster.Addrs 不为空时使用集群，都未配置时不连接。
+// 缓存不可用时直接查询数据库，超时和重试设置得较短，避免 Redis 故障拖慢接口
+func InitRedis(cfg config.ConfigGlobal) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if len(cfg.RedisCluster.Addrs) > 0 {
+		client := redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        cfg.RedisCluster.Addrs,
+			Password:     cfg.RedisCluster.Password,
+			MaxRetries:   1,
+			DialTimeout:  time.Second,
+			ReadTimeout:  500 * time.Millisecond,
+			WriteTimeout: 500 * time.Millisecond,
+		})
+		if err := client.Ping(ctx).Err(); err != nil {
+			client.Close()
+			return fmt.Errorf("连接 Redis 集群失败: %w", err)
+		}
+		core.New().InitRedisCluster(client)
+		return nil
+	}
+	if cfg.RedisConfig.Addr == "" {
+		return nil
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr:         cfg.RedisConfig.Addr,
+		Password:     cfg.RedisConfig.Password,
+		DB:           cfg.RedisConfig.Db,
+		MaxRetries:   1,
+		DialTimeout:  time.Second,
+		ReadTimeout:  500 * time.Millisecond,
+		WriteTimeout: 500 * time.Millisecond,
+	})
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return fmt.Errorf("连接 Redis 失败: %w", err)
+	}
+	core.New().InitRedis(client)
+	return nil
+}
+
+// Client 返回已初始化的 Redis，优先使用集群，未初始化时返回 nil
+func Client() redis.Cmdable {
+	if core.New().RedisCluster != nil {
+		return core.New().RedisCluster
+	}
+	return core.New().Redis
+}
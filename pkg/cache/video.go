@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"video/model"
+	"video/pkg/event"
+)
+
+// 缓存 tag，视频变化时整体失效
+const (
+	TagVideoList = "video_list"
+	TagCategory  = "category"
+)
+
+// VideoPage 视频列表缓存的内容
+type VideoPage struct {
+	Data       []model.Video
+	NextCursor string
+}
+
+// HomeList 缓存 Category.HomeList，分类视频数随入库变化，按 TagCategory 失效
+func (that *Cache) HomeList(ctx context.Context, typeId int64) []model.Category {
+	key := "category:home:" + that.generation(ctx, TagCategory) + ":" + formatId(typeId)
+	data, _ := Load(ctx, that, key, that.CategoryTTL, func() ([]model.Category, error) {
+		var category model.Category
+		return category.HomeList(typeId), nil
+	})
+	return data
+}
+
+// VideoClassList 缓存 VideoClass.List，入库可能新增视频类型，按 TagCategory 失效
+func (that *Cache) VideoClassList(ctx context.Context) []model.VideoClass {
+	key := "video_class:list:" + that.generation(ctx, TagCategory)
+	data, _ := Load(ctx, that, key, that.CategoryTTL, func() ([]model.VideoClass, error) {
+		var videoClass model.VideoClass
+		return videoClass.List(), nil
+	})
+	return data
+}
+
+// GetVideo 缓存 Video.Get，视频修改、删除时按 id 删除
+func (that *Cache) GetVideo(ctx context.Context, id int64) (model.Video, error) {
+	return Load(ctx, that, "get:"+formatId(id), that.GetTTL, func() (model.Video, error) {
+		var video model.Video
+		return video.Get(id)
+	})
+}
+
+// ListVideos 缓存不带关键词的前 MaxListPage 页(按游标翻页时 Page 为 1)，其它查询直接读数据库
+func (that *Cache) ListVideos(ctx context.Context, q model.VideoQuery) ([]model.Video, string, error) {
+	load := func() (VideoPage, error) {
+		var video model.Video
+		data, nextCursor, err := video.List(q)
+		return VideoPage{Data: data, NextCursor: nextCursor}, err
+	}
+	if q.KeyWord != "" || q.Page > that.MaxListPage {
+		res, err := load()
+		return res.Data, res.NextCursor, err
+	}
+	key := "list:" + that.generation(ctx, TagVideoList) + ":" + queryKey(q)
+	res, err := Load(ctx, that, key, that.ListTTL, load)
+	return res.Data, res.NextCursor, err
+}
+
+// CountVideos 缓存列表总数，只按 CountTTL 过期，入库时不失效，总数允许短暂偏差
+func (that *Cache) CountVideos(ctx context.Context, q model.VideoQuery) (int64, error) {
+	q.Page, q.PageSize, q.Id, q.Cursor = 0, 0, 0, ""
+	return Load(ctx, that, "count:"+queryKey(q), that.CountTTL, func() (int64, error) {
+		var video model.Video
+		return video.Count(q)
+	})
+}
+
+// Facets 缓存分面统计，与 CountVideos 一样只按 CountTTL 过期
+func (that *Cache) Facets(ctx context.Context, q model.VideoQuery) ([]model.Facet, error) {
+	q.Page, q.PageSize, q.Id, q.Cursor = 0, 0, 0, ""
+	return Load(ctx, that, "facet:"+queryKey(q), that.CountTTL, func() ([]model.Facet, error) {
+		var video model.Video
+		return video.Facets(q)
+	})
+}
+
+func queryKey(q model.VideoQuery) string {
+	data, _ := json.Marshal(q)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// InvalidateVideos 视频新增、修改、删除后使详情、列表和分类缓存失效
+func (that *Cache) InvalidateVideos(ctx context.Context, ids ...int64) {
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, "get:"+formatId(id))
+	}
+	that.Delete(ctx, keys...)
+	that.Bump(ctx, TagVideoList, TagCategory)
+}
+
+// HandleEvent 按领域事件失效缓存，浏览事件只改变浏览数，等待缓存过期
+func (that *Cache) HandleEvent(ctx context.Context, e event.Event) {
+	switch e.Type {
+	case event.VideoCreated, event.VideoUpdated, event.VideoDeleted:
+		that.InvalidateVideos(ctx, e.VideoId)
+	}
+}
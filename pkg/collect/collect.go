@@ -0,0 +1,419 @@
+package collect
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"video/config"
+	"video/model"
+	"video/pkg/ingest"
+	"video/pkg/maccms"
+)
+
+// Submitter 将采集到的视频提交入库
+type Submitter interface {
+	Submit(ctx context.Context, video *model.Video) error
+}
+
+// IngestSubmitter 在进程内直接调用入库服务，省去每条视频一次 HTTP 请求
+type IngestSubmitter struct {
+	Service *ingest.Service
+}
+
+func NewIngestSubmitter(service *ingest.Service) *IngestSubmitter {
+	return &IngestSubmitter{Service: service}
+}
+
+func (that *IngestSubmitter) Submit(ctx context.Context, video *model.Video) error {
+	_, err := that.Service.Ingest(ctx, video)
+	return err
+}
+
+// HttpSubmitter 通过 /api/v1/video/create 接口提交视频，接口返回可重试的错误时重试 Retries 次
+type HttpSubmitter struct {
+	Url        string
+	ApiKey     string // 不为空时通过 X-Api-Key 认证
+	HttpClient *http.Client
+	Retries    int
+	Backoff    time.Duration
+}
+
+// SubmitError 接口返回的错误，Code 和 Retryable 来自响应体
+type SubmitError struct {
+	Status    int
+	Code      string
+	Message   string
+	Retryable bool
+}
+
+func (e *SubmitError) Error() string {
+	return fmt.Sprintf("提交数据失败，状态码: %d, 错误码: %s, 响应: %s", e.Status, e.Code, e.Message)
+}
+
+func NewHttpSubmitter(url string) *HttpSubmitter {
+	return &HttpSubmitter{
+		Url:        url,
+		HttpClient: &http.Client{Timeout: 15 * time.Second},
+		Retries:    2,
+		Backoff:    time.Second,
+	}
+}
+
+func (that *HttpSubmitter) Submit(ctx context.Context, video *model.Video) error {
+	jsonData, err := json.Marshal(video)
+	if err != nil {
+		return fmt.Errorf("JSON序列化失败: %w", err)
+	}
+	for attempt := 0; ; attempt++ {
+		err = that.submit(ctx, jsonData)
+		var submitErr *SubmitError
+		if err == nil || !errors.As(err, &submitErr) || !submitErr.Retryable || attempt >= that.Retries {
+			return err
+		}
+		select {
+		case <-time.After(that.Backoff << attempt):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (that *HttpSubmitter) submit(ctx context.Context, jsonData []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, that.Url, bytes.NewReader(jsonData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if that.ApiKey != "" {
+		req.Header.Set("X-Api-Key", that.ApiKey)
+	}
+	resp, err := that.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		submitErr := &SubmitError{Status: resp.StatusCode, Message: string(bodyBytes)}
+		var body struct {
+			Error     string `json:"error"`
+			Code      string `json:"code"`
+			Retryable *bool  `json:"retryable"`
+		}
+		if json.Unmarshal(bodyBytes, &body) == nil && body.Error != "" {
+			submitErr.Code = body.Code
+			submitErr.Message = body.Error
+		}
+		if body.Retryable != nil {
+			submitErr.Retryable = *body.Retryable
+		} else {
+			// 旧版本接口没有 retryable，按状态码判断
+			submitErr.Retryable = resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusConflict
+		}
+		return submitErr
+	}
+	return nil
+}
+
+// Stats 一次采集的统计
+type Stats struct {
+	Pages     int64
+	Submitted int64
+	Skipped   int64
+	Failed    int64
+	Hours     int // 本次采集使用的 h 参数，0 表示全量
+	FromPage  int // 本次采集的起始页，断点续采时大于 1
+}
+
+// CheckpointStore 采集断点存储
+type CheckpointStore interface {
+	Load(ctx context.Context, source string) (model.CollectCheckpoint, error)
+	Save(ctx context.Context, checkpoint *model.CollectCheckpoint) error
+}
+
+// DBCheckpointStore 将断点保存在 MySQL 的 collect_checkpoint 表
+type DBCheckpointStore struct{}
+
+func (DBCheckpointStore) Load(ctx context.Context, source string) (model.CollectCheckpoint, error) {
+	var checkpoint model.CollectCheckpoint
+	return checkpoint.GetBySource(source)
+}
+
+func (DBCheckpointStore) Save(ctx context.Context, checkpoint *model.CollectCheckpoint) error {
+	return checkpoint.Save()
+}
+
+// Collector 按 maccms 接口分页采集并提交视频
+type Collector struct {
+	Source      config.Source
+	Client      *maccms.Client
+	Submitter   Submitter
+	Checkpoints CheckpointStore // 为空时每次都全量采集且不记录断点
+	Full        bool            // 强制全量采集，忽略上次采集时间和未完成的断点
+
+	checkpointMu sync.Mutex
+}
+
+func New(source config.Source, submitter Submitter) *Collector {
+	if source.Workers <= 0 {
+		source.Workers = 10
+	}
+	return &Collector{
+		Source:    source,
+		Client:    maccms.NewClient(source.BaseUrl),
+		Submitter: submitter,
+	}
+}
+
+// Run 先获取总页数，再由 Workers 个协程并发处理每一页(ac=list + ac=detail)。
+// 有断点时：存在未完成的采集则从断点页继续，否则使用 h=距上次成功采集的小时数 做增量采集。
+func (that *Collector) Run(ctx context.Context) (stats Stats, err error) {
+	checkpoint, hours, err := that.startCheckpoint(ctx)
+	if err != nil {
+		return stats, fmt.Errorf("读取采集断点失败: %w", err)
+	}
+	stats.Hours = hours
+	stats.FromPage = checkpoint.LastPage + 1
+
+	firstPage, err := that.Client.List(ctx, 1, stats.Hours)
+	if err != nil {
+		return stats, fmt.Errorf("获取第一页数据失败: %w", err)
+	}
+	log.Printf("[%s] 总共有 %d 页数据, h=%d, 从第 %d 页开始", that.Source.Name, firstPage.PageCount, stats.Hours, stats.FromPage)
+
+	tracker := newPageTracker(checkpoint.LastPage)
+	var failed int64
+	pages := make(chan int)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < that.Source.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range pages {
+				if err := that.collectPage(ctx, page, stats.Hours, &stats); err != nil {
+					atomic.AddInt64(&failed, 1)
+					log.Printf("[%s] 处理第 %d 页失败: %v", that.Source.Name, page, err)
+					continue
+				}
+				if lastPage, ok := tracker.complete(page); ok {
+					that.saveProgress(ctx, checkpoint, lastPage)
+				}
+			}
+		}()
+	}
+	for page := stats.FromPage; page <= firstPage.PageCount; page++ {
+		select {
+		case pages <- page:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if err != nil {
+			break
+		}
+	}
+	close(pages)
+	wg.Wait()
+	if err == nil && failed == 0 {
+		that.finishCheckpoint(ctx, checkpoint)
+	}
+	return
+}
+
+// startCheckpoint 读取断点并确定本次采集的 h 参数和起始页
+func (that *Collector) startCheckpoint(ctx context.Context) (*model.CollectCheckpoint, int, error) {
+	if that.Checkpoints == nil {
+		return &model.CollectCheckpoint{Source: that.Source.Name}, 0, nil
+	}
+	checkpoint, err := that.Checkpoints.Load(ctx, that.Source.Name)
+	if err != nil {
+		return nil, 0, err
+	}
+	if checkpoint.RunStartedAt != nil && !that.Full {
+		// 上次采集被中断，从断点页继续
+		return &checkpoint, resumeHours(&checkpoint, time.Now()), nil
+	}
+	now := time.Now()
+	checkpoint.RunStartedAt = &now
+	checkpoint.LastPage = 0
+	checkpoint.RunHours = 0
+	if checkpoint.LastRunAt != nil && !that.Full {
+		// 多取 1 小时，避免遗漏上次采集期间更新的视频
+		checkpoint.RunHours = int(math.Ceil(now.Sub(*checkpoint.LastRunAt).Hours())) + 1
+	}
+	return &checkpoint, checkpoint.RunHours, that.Checkpoints.Save(ctx, &checkpoint)
+}
+
+// resumeHours 继续中断的采集时使用的 h 参数。maccms 的 h 为距当前时间的小时数，
+// 加上距该次采集开始已过去的小时数，时间窗口才能覆盖到上次成功采集的时间；全量采集为 0。
+// 断点中的 RunHours 不变，再次中断后仍从 RunStartedAt 计算
+func resumeHours(checkpoint *model.CollectCheckpoint, now time.Time) int {
+	if checkpoint.RunHours == 0 {
+		return 0
+	}
+	return checkpoint.RunHours + int(math.Ceil(now.Sub(*checkpoint.RunStartedAt).Hours()))
+}
+
+func (that *Collector) saveProgress(ctx context.Context, checkpoint *model.CollectCheckpoint, lastPage int) {
+	if that.Checkpoints == nil {
+		return
+	}
+	that.checkpointMu.Lock()
+	defer that.checkpointMu.Unlock()
+	if lastPage <= checkpoint.LastPage {
+		return
+	}
+	checkpoint.LastPage = lastPage
+	if err := that.Checkpoints.Save(ctx, checkpoint); err != nil {
+		log.Printf("[%s] 保存采集断点失败: %v", that.Source.Name, err)
+	}
+}
+
+// finishCheckpoint 采集完成，记录本次开始时间作为下次增量采集的起点
+func (that *Collector) finishCheckpoint(ctx context.Context, checkpoint *model.CollectCheckpoint) {
+	if that.Checkpoints == nil {
+		return
+	}
+	that.checkpointMu.Lock()
+	defer that.checkpointMu.Unlock()
+	checkpoint.LastRunAt = checkpoint.RunStartedAt
+	checkpoint.RunStartedAt = nil
+	checkpoint.RunHours = 0
+	checkpoint.LastPage = 0
+	if err := that.Checkpoints.Save(ctx, checkpoint); err != nil {
+		log.Printf("[%s] 保存采集断点失败: %v", that.Source.Name, err)
+	}
+}
+
+// pageTracker 记录并发处理下已连续完成的最后一页，只有它之前的页都成功才推进断点
+type pageTracker struct {
+	mu       sync.Mutex
+	last     int
+	finished map[int]bool
+}
+
+func newPageTracker(last int) *pageTracker {
+	return &pageTracker{last: last, finished: make(map[int]bool)}
+}
+
+func (that *pageTracker) complete(page int) (last int, advanced bool) {
+	that.mu.Lock()
+	defer that.mu.Unlock()
+	that.finished[page] = true
+	for that.finished[that.last+1] {
+		delete(that.finished, that.last+1)
+		that.last++
+		advanced = true
+	}
+	return that.last, advanced
+}
+
+func (that *Collector) collectPage(ctx context.Context, page int, hours int, stats *Stats) error {
+	listResp, err := that.Client.List(ctx, page, hours)
+	if err != nil {
+		return err
+	}
+	ids := make([]int64, 0, len(listResp.List))
+	for _, vod := range listResp.List {
+		ids = append(ids, vod.VodID)
+	}
+	detailResp, err := that.Client.Detail(ctx, ids)
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&stats.Pages, 1)
+	var failed int
+	for _, vod := range detailResp.List {
+		video, ok := Transform(that.Source, vod)
+		if !ok {
+			atomic.AddInt64(&stats.Skipped, 1)
+			continue
+		}
+		if err := that.Submitter.Submit(ctx, video); err != nil {
+			failed++
+			atomic.AddInt64(&stats.Failed, 1)
+			log.Printf("[%s] 提交失败: %s (ID: %d): %v", that.Source.Name, vod.VodName, vod.VodID, err)
+			continue
+		}
+		atomic.AddInt64(&stats.Submitted, 1)
+		if that.Source.Interval > 0 {
+			time.Sleep(time.Duration(that.Source.Interval) * time.Millisecond)
+		}
+	}
+	// 被取消时本页可能未提交完整，不能计入断点
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// 有视频提交失败时本页不计入断点，下次从这一页重新采集
+	if failed > 0 {
+		return fmt.Errorf("%d 个视频提交失败", failed)
+	}
+	return nil
+}
+
+// Transform 将 maccms 数据转换为 /api/v1/video/create 的请求体，分类被映射为 0 时返回 false
+func Transform(source config.Source, vod maccms.VodInfo) (*model.Video, bool) {
+	typeId, typePid := vod.TypeID, vod.TypeID1
+	if source.TypeMap != nil {
+		if mapped, ok := source.TypeMap[typeId]; ok {
+			if mapped == 0 {
+				return nil, false
+			}
+			typeId = mapped
+		}
+		if mapped, ok := source.TypeMap[typePid]; ok {
+			typePid = mapped
+		}
+	}
+	videoType := model.CategoryTypeMovie
+	connection := 2
+	describe := vod.VodContent
+	if describe == "" {
+		describe = vod.VodBlurb
+	}
+	return &model.Video{
+		Title:      vod.VodName,
+		Alias:      vod.VodSub,
+		Type:       &videoType,
+		Connection: &connection,
+		Cover:      vod.VodPic,
+		Describe:   describe,
+		VideoClass: model.VideoClass{
+			TypeId:   typeId,
+			TypeName: vod.TypeName,
+			TypePid:  typePid,
+		},
+		VideoUrl: model.VideoUrl{
+			Url:       vod.VodPlayURL,
+			PlayFrom:  vod.VodPlayFrom,
+			ProxyName: source.ProxyName,
+			Proxy:     source.ProxyUrl,
+		},
+		Category: []*model.Category{
+			categoryGroup("类型", &model.Category{Name: vod.TypeName, TypeId: typeId, TypePid: typePid}),
+			categoryGroup("导演", &model.Category{Name: vod.VodDirector}),
+			categoryGroup("演员", &model.Category{Name: vod.VodActor}),
+			categoryGroup("年代", &model.Category{Name: vod.VodYear}),
+			categoryGroup("地区", &model.Category{Name: vod.VodArea}),
+			categoryGroup("语言", &model.Category{Name: vod.VodLang}),
+		},
+	}, true
+}
+
+func categoryGroup(name string, son *model.Category) *model.Category {
+	cType := model.CategoryTypeMovie
+	return &model.Category{
+		Type:     &cType,
+		Name:     name,
+		Category: []model.Category{*son},
+	}
+}
@@ -0,0 +1,272 @@
+package collect
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"video/config"
+	"video/model"
+	"video/pkg/maccms"
+)
+
+// fakeMaccms 模拟 maccms 资源站，每页 pageSize 条数据，listQueries 记录收到的 ac=list 请求
+func fakeMaccms(t *testing.T, vods []maccms.VodInfo, pageSize int, listQueries chan<- url.Values) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if listQueries != nil && query.Get("ac") == "list" {
+			listQueries <- query
+		}
+		var res maccms.ListResponse
+		res.Code = 1
+		res.Total = len(vods)
+		res.PageCount = (len(vods) + pageSize - 1) / pageSize
+		switch query.Get("ac") {
+		case "list":
+			page, _ := strconv.Atoi(query.Get("pg"))
+			start := (page - 1) * pageSize
+			for i := start; i < start+pageSize && i < len(vods); i++ {
+				res.List = append(res.List, maccms.VodInfo{VodID: vods[i].VodID, VodName: vods[i].VodName})
+			}
+		case "detail":
+			for _, idStr := range strings.Split(query.Get("ids"), ",") {
+				id, _ := strconv.ParseInt(idStr, 10, 64)
+				for _, vod := range vods {
+					if vod.VodID == id {
+						res.List = append(res.List, vod)
+					}
+				}
+			}
+		default:
+			t.Errorf("unexpected ac: %s", query.Get("ac"))
+		}
+		json.NewEncoder(w).Encode(res)
+	}))
+}
+
+type memorySubmitter struct {
+	mu     sync.Mutex
+	videos []*model.Video
+}
+
+func (that *memorySubmitter) Submit(ctx context.Context, video *model.Video) error {
+	that.mu.Lock()
+	defer that.mu.Unlock()
+	that.videos = append(that.videos, video)
+	return nil
+}
+
+func TestCollectorRun(t *testing.T) {
+	var vods []maccms.VodInfo
+	for i := 1; i <= 7; i++ {
+		vods = append(vods, maccms.VodInfo{
+			VodID:      int64(i),
+			VodName:    "video" + strconv.Itoa(i),
+			TypeID:     6,
+			TypeName:   "动作片",
+			TypeID1:    1,
+			VodPlayURL: "第1集$https://a.com/1.m3u8",
+		})
+	}
+	vods[6].TypeID = 99
+	server := fakeMaccms(t, vods, 3, nil)
+	defer server.Close()
+
+	submitter := &memorySubmitter{}
+	collector := New(config.Source{
+		Name:      "fake",
+		BaseUrl:   server.URL,
+		ProxyName: "代理",
+		Workers:   2,
+		TypeMap:   map[int64]int64{6: 16, 99: 0},
+	}, submitter)
+	stats, err := collector.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Pages != 3 || stats.Submitted != 6 || stats.Skipped != 1 || stats.Failed != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	for _, video := range submitter.videos {
+		if video.VideoClass.TypeId != 16 || video.VideoClass.TypePid != 1 {
+			t.Errorf("type map not applied: %+v", video.VideoClass)
+		}
+		if video.VideoUrl.ProxyName != "代理" || video.VideoUrl.Url == "" {
+			t.Errorf("unexpected video url: %+v", video.VideoUrl)
+		}
+		if video.Category[0].Name != "类型" || video.Category[0].Category[0].TypeId != 16 {
+			t.Errorf("unexpected category: %+v", video.Category[0])
+		}
+	}
+}
+
+// failingSubmitter 提交 failIds 中的视频时返回错误
+type failingSubmitter struct {
+	memorySubmitter
+	failIds map[string]bool
+}
+
+func (that *failingSubmitter) Submit(ctx context.Context, video *model.Video) error {
+	if that.failIds[video.Title] {
+		return errors.New("submit failed")
+	}
+	return that.memorySubmitter.Submit(ctx, video)
+}
+
+type memoryCheckpointStore struct {
+	mu         sync.Mutex
+	checkpoint model.CollectCheckpoint
+}
+
+func (that *memoryCheckpointStore) Load(ctx context.Context, source string) (model.CollectCheckpoint, error) {
+	that.mu.Lock()
+	defer that.mu.Unlock()
+	checkpoint := that.checkpoint
+	checkpoint.Source = source
+	return checkpoint, nil
+}
+
+func (that *memoryCheckpointStore) Save(ctx context.Context, checkpoint *model.CollectCheckpoint) error {
+	that.mu.Lock()
+	defer that.mu.Unlock()
+	that.checkpoint = *checkpoint
+	return nil
+}
+
+func TestCollectorCheckpoint(t *testing.T) {
+	var vods []maccms.VodInfo
+	for i := 1; i <= 10; i++ {
+		vods = append(vods, maccms.VodInfo{VodID: int64(i), VodName: "video" + strconv.Itoa(i)})
+	}
+	listQueries := make(chan url.Values, 100)
+	server := fakeMaccms(t, vods, 2, listQueries)
+	defer server.Close()
+	drain := func() (queries []url.Values) {
+		for {
+			select {
+			case query := <-listQueries:
+				queries = append(queries, query)
+			default:
+				return
+			}
+		}
+	}
+
+	store := &memoryCheckpointStore{}
+	source := config.Source{Name: "fake", BaseUrl: server.URL, Workers: 1}
+	newCollector := func(full bool) *Collector {
+		collector := New(source, &memorySubmitter{})
+		collector.Checkpoints = store
+		collector.Full = full
+		return collector
+	}
+
+	// 中断的采集：从断点页继续，h 加上中断后已过去的小时数
+	startedAt := time.Now().Add(-150 * time.Minute)
+	store.checkpoint = model.CollectCheckpoint{RunStartedAt: &startedAt, RunHours: 5, LastPage: 3}
+	stats, err := newCollector(false).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.FromPage != 4 || stats.Hours != 8 || stats.Pages != 2 {
+		t.Fatalf("unexpected resume stats: %+v", stats)
+	}
+	for _, query := range drain() {
+		if query.Get("h") != "8" {
+			t.Errorf("resume should extend h to 8, got %v", query)
+		}
+	}
+	if store.checkpoint.RunStartedAt != nil || store.checkpoint.LastRunAt == nil || !store.checkpoint.LastRunAt.Equal(startedAt) {
+		t.Fatalf("checkpoint not finished: %+v", store.checkpoint)
+	}
+
+	// 增量采集：h 为距上次成功采集的小时数
+	stats, err = newCollector(false).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.FromPage != 1 || stats.Hours != 4 || stats.Pages != 5 {
+		t.Fatalf("unexpected incremental stats: %+v", stats)
+	}
+	drain()
+
+	// --full 强制全量采集
+	stats, err = newCollector(true).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Hours != 0 || stats.Pages != 5 {
+		t.Fatalf("unexpected full stats: %+v", stats)
+	}
+	for _, query := range drain() {
+		if query.Has("h") {
+			t.Errorf("full crawl should not send h, got %v", query)
+		}
+	}
+}
+
+func TestHttpSubmitterRetry(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		var video model.Video
+		json.NewDecoder(r.Body).Decode(&video)
+		switch {
+		case video.Title == "":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"Title is required","code":"VALIDATION_FAILED","retryable":false}`))
+		case calls < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":"Failed to create video","code":"DATABASE_ERROR","retryable":true}`))
+		default:
+			w.Write([]byte(`{"VideoId":1}`))
+		}
+	}))
+	defer server.Close()
+
+	submitter := NewHttpSubmitter(server.URL)
+	submitter.Backoff = time.Millisecond
+	if err := submitter.Submit(context.Background(), &model.Video{Title: "a"}); err != nil || calls != 3 {
+		t.Fatalf("expected success after 2 retries, calls=%d err=%v", calls, err)
+	}
+
+	calls = 0
+	err := submitter.Submit(context.Background(), &model.Video{})
+	submitErr, ok := err.(*SubmitError)
+	if !ok || submitErr.Code != "VALIDATION_FAILED" || submitErr.Retryable || calls != 1 {
+		t.Fatalf("expected permanent failure without retry, calls=%d err=%v", calls, err)
+	}
+}
+
+func TestCollectorSubmitFailure(t *testing.T) {
+	var vods []maccms.VodInfo
+	for i := 1; i <= 6; i++ {
+		vods = append(vods, maccms.VodInfo{VodID: int64(i), VodName: "video" + strconv.Itoa(i)})
+	}
+	server := fakeMaccms(t, vods, 2, nil)
+	defer server.Close()
+
+	store := &memoryCheckpointStore{}
+	collector := New(config.Source{Name: "fake", BaseUrl: server.URL, Workers: 1},
+		&failingSubmitter{failIds: map[string]bool{"video3": true}})
+	collector.Checkpoints = store
+	stats, err := collector.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Failed != 1 || stats.Submitted != 5 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	// 第 2 页有视频提交失败：断点停在第 1 页，采集未完成，下次从第 2 页继续
+	if store.checkpoint.LastPage != 1 || store.checkpoint.RunStartedAt == nil || store.checkpoint.LastRunAt != nil {
+		t.Fatalf("checkpoint should not pass failed page: %+v", store.checkpoint)
+	}
+}
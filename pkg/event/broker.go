@@ -0,0 +1,59 @@
+package event
+
+import (
+	"context"
+	"sync"
+)
+
+// Message 发布到消息队列的一条消息
+type Message struct {
+	Topic   string
+	Key     string
+	Value   []byte
+	Headers map[string]string
+}
+
+// Broker 消息发布，生产环境为 kafka.Producer，测试使用 MemoryBroker
+type Broker interface {
+	Publish(ctx context.Context, message Message) error
+}
+
+// MemoryBroker 进程内 Broker，保存所有已发布的消息，Err 不为空时发布失败
+type MemoryBroker struct {
+	mu       sync.Mutex
+	messages []Message
+	Err      error
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+func (that *MemoryBroker) Publish(ctx context.Context, message Message) error {
+	that.mu.Lock()
+	defer that.mu.Unlock()
+	if that.Err != nil {
+		return that.Err
+	}
+	that.messages = append(that.messages, message)
+	return nil
+}
+
+// Messages 返回已发布到 topic 的消息，topic 为空时返回全部
+func (that *MemoryBroker) Messages(topic string) []Message {
+	that.mu.Lock()
+	defer that.mu.Unlock()
+	var data []Message
+	for _, message := range that.messages {
+		if topic == "" || message.Topic == topic {
+			data = append(data, message)
+		}
+	}
+	return data
+}
+
+func (that *MemoryBroker) SetErr(err error) {
+	that.mu.Lock()
+	defer that.mu.Unlock()
+	that.Err = err
+}
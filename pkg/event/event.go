@@ -0,0 +1,110 @@
+package event
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"video/model"
+
+	"gorm.io/gorm"
+)
+
+// Version 事件 JSON 的版本号，不兼容的字段变更时递增
+const Version = 1
+
+const (
+	VideoCreated = "video.created"
+	VideoUpdated = "video.updated"
+	VideoDeleted = "video.deleted"
+	VideoViewed  = "video.viewed"
+)
+
+// 消息 header
+const (
+	HeaderId      = "event-id"
+	HeaderType    = "event-type"
+	HeaderVersion = "event-version"
+)
+
+// Event 领域事件，序列化后作为消息体发布
+type Event struct {
+	Id         string
+	Type       string
+	Version    int
+	OccurredAt time.Time
+	VideoId    int64
+	Data       json.RawMessage
+}
+
+// Video video.created / video.updated / video.deleted 的 Data
+type Video struct {
+	Id           int64
+	Title        string
+	TypeId       int64
+	TypePid      int64
+	VideoGroupId int64
+	CategoryIds  []int64
+}
+
+// Viewed video.viewed 的 Data，浏览数批量写入，一个事件对应一段时间内的 Count 次浏览
+type Viewed struct {
+	Id    int64
+	Count int64
+}
+
+// New 创建事件，data 序列化为 Data
+func New(eventType string, videoId int64, data any) (event Event, err error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	return Event{
+		Id:         newId(),
+		Type:       eventType,
+		Version:    Version,
+		OccurredAt: time.Now(),
+		VideoId:    videoId,
+		Data:       body,
+	}, nil
+}
+
+// VideoEvent 根据视频创建 created/updated/deleted 事件
+func VideoEvent(eventType string, video *model.Video, categoryIds []int64) (Event, error) {
+	return New(eventType, video.Id, Video{
+		Id:           video.Id,
+		Title:        video.Title,
+		TypeId:       video.TypeId,
+		TypePid:      video.TypePid,
+		VideoGroupId: video.VideoGroupId,
+		CategoryIds:  categoryIds,
+	})
+}
+
+func newId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Enqueue 把事件写入 outbox 表，tx 为业务事务时与业务数据一起提交或回滚
+func Enqueue(tx *gorm.DB, events ...Event) error {
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		outbox := model.Outbox{
+			EventId:    event.Id,
+			EventType:  event.Type,
+			MessageKey: strconv.FormatInt(event.VideoId, 10),
+			Payload:    string(payload),
+		}
+		if err = outbox.Create(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"video/model"
+)
+
+// Store 读取待发布的 outbox 事件并记录发布结果
+type Store interface {
+	Pending(ctx context.Context, limit int) ([]model.Outbox, error)
+	MarkPublished(ctx context.Context, id int64) error
+	// MarkSent 事件已发送到 Broker 但 OnPublished 尚未成功，重试时只重新调用 OnPublished
+	MarkSent(ctx context.Context, id int64) error
+	MarkFailed(ctx context.Context, id int64, err error) error
+	// MarkDead 多次发布失败后放弃该事件，不再返回给 Pending
+	MarkDead(ctx context.Context, id int64, err error) error
+	// DeletePublished 删除 before 之前发布的事件，每次最多 limit 条，返回删除数量
+	DeletePublished(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+// DBStore 使用 outbox 表
+type DBStore struct{}
+
+func (DBStore) Pending(ctx context.Context, limit int) ([]model.Outbox, error) {
+	var outbox model.Outbox
+	return outbox.ListPending(limit)
+}
+
+func (DBStore) MarkPublished(ctx context.Context, id int64) error {
+	var outbox model.Outbox
+	return outbox.MarkPublished(id)
+}
+
+func (DBStore) MarkSent(ctx context.Context, id int64) error {
+	var outbox model.Outbox
+	return outbox.MarkSent(id)
+}
+
+func (DBStore) MarkFailed(ctx context.Context, id int64, err error) error {
+	var outbox model.Outbox
+	return outbox.MarkFailed(id, err.Error())
+}
+
+func (DBStore) MarkDead(ctx context.Context, id int64, err error) error {
+	var outbox model.Outbox
+	return outbox.MarkDead(id, err.Error())
+}
+
+func (DBStore) DeletePublished(ctx context.Context, before time.Time, limit int) (int64, error) {
+	var outbox model.Outbox
+	return outbox.DeletePublished(before, limit)
+}
+
+// Relay 按写入顺序把 outbox 中的事件发布到 Topic，发布失败时停止本轮，保证同一视频的事件有序。
+// 发布或 OnPublished 处理失败都计入失败次数，同一事件累计失败 MaxAttempts 次后放弃(记录 dead_at)并继续后面的事件，
+// 避免一条坏数据阻塞全部事件。已发送的事件记录 sent_at，处理失败重试时不再重复发送；
+// 发布成功但标记失败时事件会被重复发布，消费方按 event-id 去重。
+type Relay struct {
+	Store       Store
+	Broker      Broker
+	Topic       string
+	BatchSize   int
+	Interval    time.Duration
+	MaxAttempts int // 同一事件最多发布失败的次数，<= 0 时一直重试
+	// Retention 已发布事件的保留时间，Run 每隔 PurgeInterval 删除更早发布的事件，<= 0 时不删除
+	Retention     time.Duration
+	PurgeInterval time.Duration
+	// OnPublished 事件发布后调用，如使接口缓存失效、更新搜索索引；返回错误时按失败处理，
+	// 事件留在 outbox 中下一轮只重新调用 OnPublished
+	OnPublished func(ctx context.Context, event Event) error
+}
+
+func NewRelay(store Store, broker Broker, topic string) *Relay {
+	return &Relay{
+		Store:         store,
+		Broker:        broker,
+		Topic:         topic,
+		BatchSize:     100,
+		Interval:      time.Second,
+		MaxAttempts:   10,
+		Retention:     7 * 24 * time.Hour,
+		PurgeInterval: time.Hour,
+	}
+}
+
+// Flush 发布所有待发布事件，返回发布数量
+func (that *Relay) Flush(ctx context.Context) (published int, err error) {
+	for {
+		var pending []model.Outbox
+		if pending, err = that.Store.Pending(ctx, that.BatchSize); err != nil || len(pending) == 0 {
+			return
+		}
+		for _, item := range pending {
+			if err = that.deliver(ctx, item); err != nil {
+				if ctx.Err() == nil && that.MaxAttempts > 0 && item.Attempts+1 >= that.MaxAttempts {
+					log.Printf("outbox %d 失败 %d 次，放弃: %v", item.Id, item.Attempts+1, err)
+					if err = that.Store.MarkDead(ctx, item.Id, err); err != nil {
+						return
+					}
+					continue
+				}
+				if markErr := that.Store.MarkFailed(ctx, item.Id, err); markErr != nil {
+					log.Printf("记录 outbox %d 失败出错: %v", item.Id, markErr)
+				}
+				return
+			}
+			if err = that.Store.MarkPublished(ctx, item.Id); err != nil {
+				return
+			}
+			published++
+		}
+		if len(pending) < that.BatchSize {
+			return
+		}
+	}
+}
+
+// deliver 发送未发送过的事件，再调用 OnPublished
+func (that *Relay) deliver(ctx context.Context, item model.Outbox) error {
+	var event Event
+	if err := json.Unmarshal([]byte(item.Payload), &event); err != nil {
+		return err
+	}
+	if item.SentAt == nil {
+		if err := that.publish(ctx, item, event); err != nil {
+			return err
+		}
+		if that.OnPublished != nil {
+			if err := that.Store.MarkSent(ctx, item.Id); err != nil {
+				return err
+			}
+		}
+	}
+	if that.OnPublished == nil {
+		return nil
+	}
+	return that.OnPublished(ctx, event)
+}
+
+func (that *Relay) publish(ctx context.Context, item model.Outbox, event Event) error {
+	return that.Broker.Publish(ctx, Message{
+		Topic: that.Topic,
+		Key:   item.MessageKey,
+		Value: []byte(item.Payload),
+		Headers: map[string]string{
+			HeaderId:      event.Id,
+			HeaderType:    event.Type,
+			HeaderVersion: strconv.Itoa(event.Version),
+		},
+	})
+}
+
+// Purge 分批删除发布时间早于 now - Retention 的事件，返回删除数量
+func (that *Relay) Purge(ctx context.Context, now time.Time) (deleted int64, err error) {
+	if that.Retention <= 0 {
+		return
+	}
+	before := now.Add(-that.Retention)
+	for ctx.Err() == nil {
+		var n int64
+		if n, err = that.Store.DeletePublished(ctx, before, that.BatchSize); err != nil {
+			return
+		}
+		deleted += n
+		if n < int64(that.BatchSize) {
+			return
+		}
+	}
+	return deleted, ctx.Err()
+}
+
+// Run 每隔 Interval 发布一次，每隔 PurgeInterval 删除过期的已发布事件，直到 ctx 取消
+func (that *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(that.Interval)
+	defer ticker.Stop()
+	var purgedAt time.Time
+	for {
+		if now := time.Now(); now.Sub(purgedAt) >= that.PurgeInterval {
+			purgedAt = now
+			deleted, err := that.Purge(ctx, now)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("清理 outbox 事件失败: %v", err)
+			}
+			if deleted > 0 {
+				log.Printf("清理已发布的 outbox 事件 %d 条", deleted)
+			}
+		}
+		published, err := that.Flush(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("发布 outbox 事件失败: %v", err)
+		}
+		if published > 0 {
+			log.Printf("发布 outbox 事件 %d 条", published)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"video/model"
+)
+
+type memoryStore struct {
+	rows []model.Outbox
+}
+
+func (that *memoryStore) add(t *testing.T, events ...Event) {
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		that.rows = append(that.rows, model.Outbox{
+			Id:         int64(len(that.rows) + 1),
+			EventId:    event.Id,
+			EventType:  event.Type,
+			MessageKey: strconv.FormatInt(event.VideoId, 10),
+			Payload:    string(payload),
+		})
+	}
+}
+
+func (that *memoryStore) Pending(ctx context.Context, limit int) (data []model.Outbox, err error) {
+	for _, row := range that.rows {
+		if row.PublishedAt == nil && row.DeadAt == nil && len(data) < limit {
+			data = append(data, row)
+		}
+	}
+	return
+}
+
+func (that *memoryStore) MarkPublished(ctx context.Context, id int64) error {
+	now := time.Now()
+	that.rows[id-1].PublishedAt = &now
+	return nil
+}
+
+func (that *memoryStore) MarkSent(ctx context.Context, id int64) error {
+	now := time.Now()
+	that.rows[id-1].SentAt = &now
+	return nil
+}
+
+func (that *memoryStore) MarkFailed(ctx context.Context, id int64, err error) error {
+	that.rows[id-1].Attempts++
+	that.rows[id-1].LastError = err.Error()
+	return nil
+}
+
+func (that *memoryStore) MarkDead(ctx context.Context, id int64, err error) error {
+	now := time.Now()
+	that.rows[id-1].Attempts++
+	that.rows[id-1].LastError = err.Error()
+	that.rows[id-1].DeadAt = &now
+	return nil
+}
+
+func (that *memoryStore) DeletePublished(ctx context.Context, before time.Time, limit int) (deleted int64, err error) {
+	kept := that.rows[:0]
+	for _, row := range that.rows {
+		if row.PublishedAt != nil && row.PublishedAt.Before(before) && deleted < int64(limit) {
+			deleted++
+			continue
+		}
+		kept = append(kept, row)
+	}
+	that.rows = kept
+	return
+}
+
+func newEvent(t *testing.T, eventType string, videoId int64) Event {
+	e, err := New(eventType, videoId, Video{Id: videoId, Title: "t" + strconv.FormatInt(videoId, 10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestRelayFlush(t *testing.T) {
+	store := &memoryStore{}
+	store.add(t,
+		newEvent(t, VideoCreated, 1),
+		newEvent(t, VideoUpdated, 1),
+		newEvent(t, VideoCreated, 2),
+	)
+	broker := NewMemoryBroker()
+	relay := NewRelay(store, broker, "video-events")
+	relay.BatchSize = 2
+
+	published, err := relay.Flush(context.Background())
+	if err != nil || published != 3 {
+		t.Fatalf("expected 3 published, got %d: %v", published, err)
+	}
+	messages := broker.Messages("video-events")
+	if len(messages) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(messages))
+	}
+	for i, want := range []string{VideoCreated, VideoUpdated, VideoCreated} {
+		if messages[i].Headers[HeaderType] != want || messages[i].Headers[HeaderVersion] != "1" {
+			t.Errorf("message %d: unexpected headers %v", i, messages[i].Headers)
+		}
+	}
+	var decoded Event
+	if err := json.Unmarshal(messages[2].Value, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	var data Video
+	json.Unmarshal(decoded.Data, &data)
+	if messages[2].Key != "2" || decoded.Version != Version || decoded.VideoId != 2 || data.Title != "t2" {
+		t.Errorf("unexpected message %s: %+v %+v", messages[2].Key, decoded, data)
+	}
+}
+
+func TestRelayStopsOnFailure(t *testing.T) {
+	store := &memoryStore{}
+	store.add(t, newEvent(t, VideoCreated, 1), newEvent(t, VideoViewed, 1))
+	broker := NewMemoryBroker()
+	broker.SetErr(errors.New("broker down"))
+	relay := NewRelay(store, broker, "video-events")
+	var handled []string
+	relay.OnPublished = func(ctx context.Context, event Event) error {
+		handled = append(handled, event.Type)
+		return nil
+	}
+
+	published, err := relay.Flush(context.Background())
+	if err == nil || published != 0 {
+		t.Fatalf("expected failure, got %d: %v", published, err)
+	}
+	if store.rows[0].Attempts != 1 || store.rows[0].LastError != "broker down" || store.rows[1].Attempts != 0 {
+		t.Fatalf("expected only first event attempted, got %+v", store.rows)
+	}
+	if len(handled) != 0 {
+		t.Fatalf("OnPublished called for failed event: %v", handled)
+	}
+
+	broker.SetErr(nil)
+	if published, err = relay.Flush(context.Background()); err != nil || published != 2 {
+		t.Fatalf("expected 2 published after recovery, got %d: %v", published, err)
+	}
+	if messages := broker.Messages(""); messages[0].Headers[HeaderType] != VideoCreated || messages[1].Headers[HeaderType] != VideoViewed {
+		t.Errorf("events published out of order: %v", messages)
+	}
+	if len(handled) != 2 || handled[0] != VideoCreated || handled[1] != VideoViewed {
+		t.Errorf("OnPublished = %v", handled)
+	}
+}
+
+func TestRelaySkipsDeadEvent(t *testing.T) {
+	store := &memoryStore{}
+	store.add(t, newEvent(t, VideoCreated, 1), newEvent(t, VideoCreated, 2))
+	// 无法解析的事件每次都会失败
+	store.rows[0].Payload = "{"
+	broker := NewMemoryBroker()
+	relay := NewRelay(store, broker, "video-events")
+	relay.MaxAttempts = 2
+
+	if published, err := relay.Flush(context.Background()); err == nil || published != 0 {
+		t.Fatalf("expected first attempt to block, got %d: %v", published, err)
+	}
+	if published, err := relay.Flush(context.Background()); err != nil || published != 1 {
+		t.Fatalf("expected dead event skipped, got %d: %v", published, err)
+	}
+	if store.rows[0].DeadAt == nil || store.rows[0].Attempts != 2 || store.rows[1].PublishedAt == nil {
+		t.Errorf("unexpected rows: %+v", store.rows)
+	}
+	if messages := broker.Messages(""); len(messages) != 1 || messages[0].Key != "2" {
+		t.Errorf("unexpected messages: %v", messages)
+	}
+}
+
+func TestRelayPurge(t *testing.T) {
+	store := &memoryStore{}
+	for i := int64(1); i <= 5; i++ {
+		store.add(t, newEvent(t, VideoCreated, i))
+	}
+	now := time.Now()
+	for i, age := range []time.Duration{10 * time.Hour, 9 * time.Hour, 8 * time.Hour, time.Hour} {
+		publishedAt := now.Add(-age)
+		store.rows[i].PublishedAt = &publishedAt
+	}
+	relay := NewRelay(store, NewMemoryBroker(), "video-events")
+	relay.BatchSize = 2
+	relay.Retention = 2 * time.Hour
+
+	// 只删除超过保留时间的已发布事件，未发布的保留
+	deleted, err := relay.Purge(context.Background(), now)
+	if err != nil || deleted != 3 || len(store.rows) != 2 || store.rows[0].Id != 4 || store.rows[1].Id != 5 {
+		t.Errorf("expected 3 purged, got %d: %v, rows %+v", deleted, err, store.rows)
+	}
+	relay.Retention = 0
+	if deleted, err = relay.Purge(context.Background(), now.Add(time.Hour)); deleted != 0 || len(store.rows) != 2 {
+		t.Errorf("expected retention 0 to keep events, got %d: %v", deleted, err)
+	}
+}
+
+func TestRelayRetriesFailedHandler(t *testing.T) {
+	store := &memoryStore{}
+	store.add(t, newEvent(t, VideoCreated, 1), newEvent(t, VideoCreated, 2))
+	broker := NewMemoryBroker()
+	relay := NewRelay(store, broker, "video-events")
+	handlerErr := errors.New("index down")
+	relay.OnPublished = func(ctx context.Context, event Event) error {
+		return handlerErr
+	}
+
+	// 处理失败的事件不标记为已发布，后面的事件不处理
+	if published, err := relay.Flush(context.Background()); !errors.Is(err, handlerErr) || published != 0 {
+		t.Fatalf("expected handler error, got %d: %v", published, err)
+	}
+	if store.rows[0].PublishedAt != nil || store.rows[0].Attempts != 1 || store.rows[1].Attempts != 0 {
+		t.Fatalf("unexpected rows: %+v", store.rows)
+	}
+	handlerErr = nil
+	if published, err := relay.Flush(context.Background()); err != nil || published != 2 {
+		t.Fatalf("expected 2 published after recovery, got %d: %v", published, err)
+	}
+	// 已发送的事件重试时只重新处理，不重复发送
+	if messages := broker.Messages(""); len(messages) != 2 || messages[0].Key != "1" || messages[1].Key != "2" {
+		t.Errorf("unexpected messages: %v", messages)
+	}
+}
+
+func TestRelayGivesUpFailingHandler(t *testing.T) {
+	store := &memoryStore{}
+	store.add(t, newEvent(t, VideoCreated, 1), newEvent(t, VideoCreated, 2))
+	broker := NewMemoryBroker()
+	relay := NewRelay(store, broker, "video-events")
+	relay.MaxAttempts = 3
+	var handled []int64
+	relay.OnPublished = func(ctx context.Context, event Event) error {
+		handled = append(handled, event.VideoId)
+		if event.VideoId == 1 {
+			return errors.New("index down")
+		}
+		return nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if published, err := relay.Flush(context.Background()); err == nil || published != 0 {
+			t.Fatalf("flush %d: expected handler error, got %d: %v", i, published, err)
+		}
+	}
+	// 第 3 次失败后放弃第一个事件，后面的事件继续发布
+	if published, err := relay.Flush(context.Background()); err != nil || published != 1 {
+		t.Fatalf("expected failing event skipped, got %d: %v", published, err)
+	}
+	if store.rows[0].DeadAt == nil || store.rows[0].Attempts != 3 || store.rows[0].PublishedAt != nil || store.rows[1].PublishedAt == nil {
+		t.Errorf("unexpected rows: %+v", store.rows)
+	}
+	if messages := broker.Messages(""); len(messages) != 2 || messages[0].Key != "1" || messages[1].Key != "2" {
+		t.Errorf("expected each event sent once, got %v", messages)
+	}
+	if len(handled) != 4 {
+		t.Errorf("OnPublished = %v", handled)
+	}
+	if published, err := relay.Flush(context.Background()); err != nil || published != 0 {
+		t.Errorf("expected nothing pending, got %d: %v", published, err)
+	}
+}
@@ -0,0 +1,271 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"video/config"
+	"video/model"
+	"video/pkg/hls"
+	"video/pkg/playurl"
+)
+
+const userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/108.0.0.0 Safari/537.36"
+
+// Result 一次检测结果
+type Result struct {
+	OK         bool
+	HttpStatus int
+	Latency    time.Duration
+	Err        error
+}
+
+// Store 读写线路健康状态
+type Store interface {
+	// Samples 按 (VideoUrlId, Line) 升序返回 after 之后每条线路的样本分集
+	Samples(ctx context.Context, after model.LineKey, limit int) ([]model.VideoEpisode, error)
+	Load(ctx context.Context, videoUrlId int64, line string) (model.LineHealth, error)
+	Save(ctx context.Context, health *model.LineHealth) error
+}
+
+// DBStore 使用 video_episode 和 line_health 表
+type DBStore struct{}
+
+func (DBStore) Samples(ctx context.Context, after model.LineKey, limit int) ([]model.VideoEpisode, error) {
+	return model.ListLineSamples(after, limit)
+}
+
+func (DBStore) Load(ctx context.Context, videoUrlId int64, line string) (model.LineHealth, error) {
+	var health model.LineHealth
+	return health.GetByLine(videoUrlId, line)
+}
+
+func (DBStore) Save(ctx context.Context, health *model.LineHealth) error {
+	return health.Save()
+}
+
+// Checker 检测播放线路：拉取播放列表并请求第一个分片，连续失败 DeadAfter 次后标记线路失效
+type Checker struct {
+	Concurrency int
+	DeadAfter   int
+	Store       Store
+	HttpClient  *http.Client
+	hlsClient   *hls.Client
+	limiter     *hostLimiter
+}
+
+func New(cfg config.HealthCheck, store Store) *Checker {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 10
+	}
+	if cfg.DeadAfter <= 0 {
+		cfg.DeadAfter = 3
+	}
+	if cfg.HostRate <= 0 {
+		cfg.HostRate = 2
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 15
+	}
+	httpClient := &http.Client{Timeout: time.Duration(cfg.Timeout) * time.Second}
+	return &Checker{
+		Concurrency: cfg.Concurrency,
+		DeadAfter:   cfg.DeadAfter,
+		Store:       store,
+		HttpClient:  httpClient,
+		hlsClient:   &hls.Client{HttpClient: httpClient},
+		limiter:     newHostLimiter(time.Duration(float64(time.Second) / cfg.HostRate)),
+	}
+}
+
+// Sweep 检测所有线路，limit > 0 时最多检测 limit 条
+func (that *Checker) Sweep(ctx context.Context, limit int) (checked, dead int, err error) {
+	const batchSize = 500
+	samples := make(chan model.VideoEpisode)
+	var mu sync.Mutex
+	wg := &sync.WaitGroup{}
+	for i := 0; i < that.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sample := range samples {
+				health, err := that.checkLine(ctx, sample)
+				if err != nil {
+					log.Printf("保存线路状态失败 video_url_id=%d line=%s: %v", sample.VideoUrlId, sample.Line, err)
+					continue
+				}
+				mu.Lock()
+				checked++
+				if health.Status == model.LineStatusDead {
+					dead++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	var after model.LineKey
+	sent := 0
+loop:
+	for {
+		size := batchSize
+		if limit > 0 && limit-sent < size {
+			size = limit - sent
+		}
+		if size <= 0 {
+			break
+		}
+		var batch []model.VideoEpisode
+		batch, err = that.Store.Samples(ctx, after, size)
+		if err != nil || len(batch) == 0 {
+			break
+		}
+		for _, sample := range batch {
+			select {
+			case samples <- sample:
+				sent++
+			case <-ctx.Done():
+				err = ctx.Err()
+				break loop
+			}
+		}
+		last := batch[len(batch)-1]
+		after = model.LineKey{VideoUrlId: last.VideoUrlId, Line: last.Line}
+	}
+	close(samples)
+	wg.Wait()
+	return
+}
+
+func (that *Checker) checkLine(ctx context.Context, sample model.VideoEpisode) (health model.LineHealth, err error) {
+	result := that.Check(ctx, sample.Url, sample.Format)
+	if ctx.Err() != nil {
+		// 被取消导致的失败不计入
+		return health, ctx.Err()
+	}
+	health, err = that.Store.Load(ctx, sample.VideoUrlId, sample.Line)
+	if err != nil {
+		return
+	}
+	health.VideoId = sample.VideoId
+	health = Apply(health, result, that.DeadAfter)
+	err = that.Store.Save(ctx, &health)
+	return
+}
+
+// Apply 根据检测结果更新线路状态：成功即恢复可播放，连续失败 deadAfter 次标记失效
+func Apply(health model.LineHealth, result Result, deadAfter int) model.LineHealth {
+	now := time.Now()
+	health.CheckedAt = &now
+	health.HttpStatus = result.HttpStatus
+	health.LatencyMs = result.Latency.Milliseconds()
+	if result.OK {
+		health.Status = model.LineStatusLive
+		health.FailCount = 0
+		health.LastError = ""
+		return health
+	}
+	health.FailCount++
+	if result.Err != nil {
+		health.LastError = result.Err.Error()
+		if len(health.LastError) > 255 {
+			health.LastError = health.LastError[:255]
+		}
+	}
+	if health.FailCount >= deadAfter {
+		health.Status = model.LineStatusDead
+	}
+	return health
+}
+
+// Check 检测单个地址：m3u8 拉取媒体播放列表后再请求第一个分片，其它格式直接请求地址
+func (that *Checker) Check(ctx context.Context, link string, format string) (result Result) {
+	start := time.Now()
+	defer func() {
+		result.Latency = time.Since(start)
+	}()
+	if format == playurl.FormatM3u8 {
+		if err := that.limiter.Wait(ctx, link); err != nil {
+			result.Err = err
+			return
+		}
+		playlist, err := that.hlsClient.FetchMedia(ctx, link)
+		if err != nil {
+			result.Err = err
+			return
+		}
+		if len(playlist.Segments) == 0 {
+			result.Err = fmt.Errorf("播放列表没有分片")
+			return
+		}
+		link = playlist.Segments[0].Uri
+	}
+	if err := that.limiter.Wait(ctx, link); err != nil {
+		result.Err = err
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Range", "bytes=0-1023")
+	resp, err := that.HttpClient.Do(req)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1024))
+	result.HttpStatus = resp.StatusCode
+	result.OK = resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent
+	if !result.OK {
+		result.Err = fmt.Errorf("上游返回错误状态码: %d", resp.StatusCode)
+	}
+	return
+}
+
+// hostLimiter 按 host 限速，同一 host 两次请求至少间隔 interval
+type hostLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     map[string]time.Time
+}
+
+func newHostLimiter(interval time.Duration) *hostLimiter {
+	return &hostLimiter{interval: interval, next: make(map[string]time.Time)}
+}
+
+func (that *hostLimiter) Wait(ctx context.Context, link string) error {
+	host := link
+	if u, err := url.Parse(link); err == nil {
+		host = u.Host
+	}
+	that.mu.Lock()
+	now := time.Now()
+	at := that.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	that.next[host] = at.Add(that.interval)
+	that.mu.Unlock()
+
+	wait := time.Until(at)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,160 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"video/config"
+	"video/model"
+)
+
+func newTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/live/index.m3u8":
+			w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\n0.ts\n#EXT-X-ENDLIST\n"))
+		case "/broken/index.m3u8":
+			w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\nmissing.ts\n#EXT-X-ENDLIST\n"))
+		case "/live/0.ts", "/movie.mp4":
+			if r.Header.Get("Range") == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(make([]byte, 1024))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestCheck(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	checker := New(config.HealthCheck{HostRate: 1000}, nil)
+
+	cases := []struct {
+		link   string
+		format string
+		ok     bool
+		status int
+	}{
+		{server.URL + "/live/index.m3u8", "m3u8", true, http.StatusPartialContent},
+		{server.URL + "/broken/index.m3u8", "m3u8", false, http.StatusNotFound},
+		{server.URL + "/gone/index.m3u8", "m3u8", false, 0},
+		{server.URL + "/movie.mp4", "mp4", true, http.StatusPartialContent},
+	}
+	for _, c := range cases {
+		result := checker.Check(context.Background(), c.link, c.format)
+		if result.OK != c.ok || result.HttpStatus != c.status {
+			t.Errorf("%s: expected ok=%v status=%d, got %+v", c.link, c.ok, c.status, result)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	health := model.LineHealth{VideoUrlId: 1, Line: "a"}
+	fail := Result{Err: errors.New("timeout")}
+	for i := 1; i <= 3; i++ {
+		health = Apply(health, fail, 3)
+		if health.FailCount != i {
+			t.Fatalf("expected fail count %d, got %d", i, health.FailCount)
+		}
+	}
+	if health.Status != model.LineStatusDead || health.LastError != "timeout" || health.CheckedAt == nil {
+		t.Fatalf("expected line dead after 3 failures, got %+v", health)
+	}
+	health = Apply(health, Result{OK: true, HttpStatus: 200, Latency: 120 * time.Millisecond}, 3)
+	if health.Status != model.LineStatusLive || health.FailCount != 0 || health.LatencyMs != 120 || health.LastError != "" {
+		t.Fatalf("expected line live after success, got %+v", health)
+	}
+}
+
+func TestHostLimiter(t *testing.T) {
+	limiter := newHostLimiter(50 * time.Millisecond)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := limiter.Wait(context.Background(), "https://a.com/1.ts"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected same host throttled, took %s", elapsed)
+	}
+	start = time.Now()
+	limiter.Wait(context.Background(), "https://b.com/1.ts")
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("expected other host not throttled, took %s", elapsed)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	limiter.Wait(ctx, "https://a.com/1.ts")
+	if err := limiter.Wait(ctx, "https://a.com/1.ts"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected canceled wait, got %v", err)
+	}
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	samples []model.VideoEpisode
+	health  map[model.LineKey]model.LineHealth
+}
+
+func (that *memoryStore) Samples(ctx context.Context, after model.LineKey, limit int) (data []model.VideoEpisode, err error) {
+	for _, sample := range that.samples {
+		if (sample.VideoUrlId > after.VideoUrlId || (sample.VideoUrlId == after.VideoUrlId && sample.Line > after.Line)) && len(data) < limit {
+			data = append(data, sample)
+		}
+	}
+	return
+}
+
+func (that *memoryStore) Load(ctx context.Context, videoUrlId int64, line string) (model.LineHealth, error) {
+	that.mu.Lock()
+	defer that.mu.Unlock()
+	health, ok := that.health[model.LineKey{VideoUrlId: videoUrlId, Line: line}]
+	if !ok {
+		health = model.LineHealth{VideoUrlId: videoUrlId, Line: line}
+	}
+	return health, nil
+}
+
+func (that *memoryStore) Save(ctx context.Context, health *model.LineHealth) error {
+	that.mu.Lock()
+	defer that.mu.Unlock()
+	that.health[model.LineKey{VideoUrlId: health.VideoUrlId, Line: health.Line}] = *health
+	return nil
+}
+
+func TestSweep(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	store := &memoryStore{
+		samples: []model.VideoEpisode{
+			{Id: 1, VideoId: 9, VideoUrlId: 1, Line: "a", Url: server.URL + "/live/index.m3u8", Format: "m3u8"},
+			{Id: 5, VideoId: 9, VideoUrlId: 1, Line: "b", Url: server.URL + "/gone/index.m3u8", Format: "m3u8"},
+		},
+		health: make(map[model.LineKey]model.LineHealth),
+	}
+	checker := New(config.HealthCheck{HostRate: 1000, DeadAfter: 2}, store)
+	for round := 1; round <= 2; round++ {
+		checked, dead, err := checker.Sweep(context.Background(), 0)
+		if err != nil || checked != 2 {
+			t.Fatalf("round %d: checked=%d err=%v", round, checked, err)
+		}
+		if want := round - 1; dead != want {
+			t.Fatalf("round %d: expected %d dead, got %d", round, want, dead)
+		}
+	}
+	if health := store.health[model.LineKey{VideoUrlId: 1, Line: "a"}]; health.Status != model.LineStatusLive || health.VideoId != 9 {
+		t.Errorf("unexpected health for line a: %+v", health)
+	}
+	if health := store.health[model.LineKey{VideoUrlId: 1, Line: "b"}]; health.Status != model.LineStatusDead || health.FailCount != 2 {
+		t.Errorf("unexpected health for line b: %+v", health)
+	}
+}
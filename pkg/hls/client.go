@@ -0,0 +1,80 @@
+package hls
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/108.0.0.0 Safari/537.36"
+
+// maxPlaylistSize 单个 m3u8 最大字节数，防止上游返回异常大文件
+const maxPlaylistSize = 8 << 20
+
+// Getter 拉取上游内容，返回内容和重定向后的地址，可替换为带缓存的实现
+type Getter interface {
+	Get(ctx context.Context, url string) (body []byte, finalUrl string, err error)
+}
+
+// Client 拉取上游 m3u8，设置 Getter 时通过它拉取
+type Client struct {
+	HttpClient *http.Client
+	Getter     Getter
+}
+
+func NewClient() *Client {
+	return &Client{HttpClient: &http.Client{Timeout: 15 * time.Second}}
+}
+
+// FetchMedia 拉取播放列表，遇到主播放列表时选择码率最高的子列表继续拉取，返回媒体播放列表
+func (that *Client) FetchMedia(ctx context.Context, playlistUrl string) (*Playlist, error) {
+	for depth := 0; depth < 3; depth++ {
+		playlist, err := that.Fetch(ctx, playlistUrl)
+		if err != nil {
+			return nil, err
+		}
+		if len(playlist.Variants) == 0 {
+			return playlist, nil
+		}
+		best := playlist.Variants[0]
+		for _, variant := range playlist.Variants[1:] {
+			if variant.Bandwidth > best.Bandwidth {
+				best = variant
+			}
+		}
+		playlistUrl = best.Uri
+	}
+	return nil, fmt.Errorf("主播放列表嵌套层级过深: %s", playlistUrl)
+}
+
+// Fetch 拉取并解析单个 m3u8
+func (that *Client) Fetch(ctx context.Context, playlistUrl string) (*Playlist, error) {
+	if that.Getter != nil {
+		body, finalUrl, err := that.Getter.Get(ctx, playlistUrl)
+		if err != nil {
+			return nil, err
+		}
+		return Parse(string(body), finalUrl)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, playlistUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := that.HttpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("上游返回错误状态码: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPlaylistSize))
+	if err != nil {
+		return nil, err
+	}
+	// 以重定向后的地址作为相对路径的基准
+	return Parse(string(body), resp.Request.URL.String())
+}
@@ -0,0 +1,171 @@
+package hls
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Segment 媒体播放列表中的一个分片
+type Segment struct {
+	Duration      float64
+	Title         string   // #EXTINF 逗号后的标题
+	Uri           string   // 绝对地址
+	Tags          []string // 分片前的其它标签，如 #EXT-X-KEY、#EXT-X-BYTERANGE
+	Discontinuity bool     // 分片前有 #EXT-X-DISCONTINUITY
+}
+
+// Variant 主播放列表中的一个码率
+type Variant struct {
+	Bandwidth int
+	Uri       string
+}
+
+// Playlist 解析后的 m3u8，Variants 非空表示主播放列表
+type Playlist struct {
+	Header   []string // 第一个分片之前的标签
+	Segments []Segment
+	Variants []Variant
+	EndList  bool
+}
+
+var uriAttrRegexp = regexp.MustCompile(`URI="([^"]*)"`)
+var bandwidthRegexp = regexp.MustCompile(`(?:^|,)BANDWIDTH=(\d+)`)
+
+// Parse 解析 m3u8 文本，所有地址(含 #EXT-X-KEY/#EXT-X-MAP 的 URI)按 base 转为绝对地址
+func Parse(body string, base string) (*Playlist, error) {
+	baseUrl, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	if !scanner.Scan() || !strings.HasPrefix(strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff")), "#EXTM3U") {
+		return nil, fmt.Errorf("不是有效的 m3u8: 缺少 #EXTM3U")
+	}
+	playlist := &Playlist{Header: []string{"#EXTM3U"}}
+	var (
+		pending       Segment
+		inSegment     bool
+		pendingStream *Variant
+	)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			variant := Variant{}
+			if m := bandwidthRegexp.FindStringSubmatch(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:")); m != nil {
+				variant.Bandwidth, _ = strconv.Atoi(m[1])
+			}
+			pendingStream = &variant
+		case strings.HasPrefix(line, "#EXTINF:"):
+			inSegment = true
+			value := strings.TrimPrefix(line, "#EXTINF:")
+			durationStr, title, _ := strings.Cut(value, ",")
+			pending.Duration, _ = strconv.ParseFloat(strings.TrimSpace(durationStr), 64)
+			pending.Title = title
+		case line == "#EXT-X-DISCONTINUITY":
+			pending.Discontinuity = true
+		case line == "#EXT-X-ENDLIST":
+			playlist.EndList = true
+		case strings.HasPrefix(line, "#"):
+			line = resolveUriAttr(line, baseUrl)
+			if len(playlist.Segments) == 0 && !inSegment && !pending.Discontinuity && len(pending.Tags) == 0 && !isSegmentTag(line) {
+				playlist.Header = append(playlist.Header, line)
+			} else {
+				pending.Tags = append(pending.Tags, line)
+			}
+		default:
+			uri := resolve(baseUrl, line)
+			if pendingStream != nil {
+				pendingStream.Uri = uri
+				playlist.Variants = append(playlist.Variants, *pendingStream)
+				pendingStream = nil
+				continue
+			}
+			pending.Uri = uri
+			playlist.Segments = append(playlist.Segments, pending)
+			pending = Segment{}
+			inSegment = false
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return playlist, nil
+}
+
+// isSegmentTag 只作用于下一个分片的标签，即使出现在第一个分片之前也不能放进 Header
+func isSegmentTag(line string) bool {
+	return strings.HasPrefix(line, "#EXT-X-BYTERANGE") ||
+		strings.HasPrefix(line, "#EXT-X-PROGRAM-DATE-TIME") ||
+		strings.HasPrefix(line, "#EXT-X-GAP")
+}
+
+func resolve(base *url.URL, ref string) string {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(u).String()
+}
+
+func resolveUriAttr(line string, base *url.URL) string {
+	return uriAttrRegexp.ReplaceAllStringFunc(line, func(attr string) string {
+		m := uriAttrRegexp.FindStringSubmatch(attr)
+		return `URI="` + resolve(base, m[1]) + `"`
+	})
+}
+
+// RewriteUris 用 fn 替换所有分片、子列表以及标签 URI 属性中的地址
+func (that *Playlist) RewriteUris(fn func(uri string) string) {
+	rewriteAttr := func(line string) string {
+		return uriAttrRegexp.ReplaceAllStringFunc(line, func(attr string) string {
+			m := uriAttrRegexp.FindStringSubmatch(attr)
+			return `URI="` + fn(m[1]) + `"`
+		})
+	}
+	for i := range that.Header {
+		that.Header[i] = rewriteAttr(that.Header[i])
+	}
+	for i := range that.Variants {
+		that.Variants[i].Uri = fn(that.Variants[i].Uri)
+	}
+	for i := range that.Segments {
+		that.Segments[i].Uri = fn(that.Segments[i].Uri)
+		for j := range that.Segments[i].Tags {
+			that.Segments[i].Tags[j] = rewriteAttr(that.Segments[i].Tags[j])
+		}
+	}
+}
+
+// String 输出 m3u8 文本
+func (that *Playlist) String() string {
+	var b strings.Builder
+	for _, line := range that.Header {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	for _, variant := range that.Variants {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d\n%s\n", variant.Bandwidth, variant.Uri)
+	}
+	for _, segment := range that.Segments {
+		if segment.Discontinuity {
+			b.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		for _, tag := range segment.Tags {
+			b.WriteString(tag)
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "#EXTINF:%s,%s\n%s\n", strconv.FormatFloat(segment.Duration, 'f', -1, 64), segment.Title, segment.Uri)
+	}
+	if that.EndList {
+		b.WriteString("#EXT-X-ENDLIST\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,176 @@
+package hls
+
+import (
+	"math"
+	"net/url"
+	"path"
+
+	"video/config"
+)
+
+const (
+	RuleDiscontinuity = "discontinuity" // #EXT-X-DISCONTINUITY 分隔出的较短非主体段
+	RuleDuration      = "duration"      // 分片常见时长与主体不一致的非主体段
+	RulePrefix        = "prefix"        // host 或目录与主体分片不同的分片，轮换 CDN 或分目录存放的播放列表会误删，需显式启用
+)
+
+// Rules 插播检测规则
+type Rules struct {
+	Discontinuity     bool
+	Duration          bool
+	Prefix            bool
+	MaxAdDuration     float64
+	DurationTolerance float64
+}
+
+// RulesFromConfig 未配置 Rules 时启用 discontinuity 和 duration，prefix 需要显式配置
+func RulesFromConfig(cfg config.Hls) Rules {
+	rules := Rules{
+		MaxAdDuration:     cfg.MaxAdDuration,
+		DurationTolerance: cfg.DurationTolerance,
+	}
+	if rules.MaxAdDuration <= 0 {
+		rules.MaxAdDuration = 120
+	}
+	if rules.DurationTolerance <= 0 {
+		rules.DurationTolerance = 0.5
+	}
+	if len(cfg.Rules) == 0 {
+		rules.Discontinuity, rules.Duration = true, true
+	}
+	for _, rule := range cfg.Rules {
+		switch rule {
+		case RuleDiscontinuity:
+			rules.Discontinuity = true
+		case RuleDuration:
+			rules.Duration = true
+		case RulePrefix:
+			rules.Prefix = true
+		}
+	}
+	return rules
+}
+
+// block 两个 #EXT-X-DISCONTINUITY 之间的连续分片
+type block struct {
+	start, end int // Segments[start:end]
+	duration   float64
+}
+
+// StripAds 返回去除插播分片后的播放列表，removed 为去除的分片数
+func StripAds(playlist *Playlist, rules Rules) (out *Playlist, removed int) {
+	segments := playlist.Segments
+	ads := make([]bool, len(segments))
+
+	blocks := splitBlocks(segments)
+	main := 0
+	for i := range blocks {
+		if blocks[i].duration > blocks[main].duration {
+			main = i
+		}
+	}
+	if len(blocks) > 1 {
+		mainMode := modeDuration(segments[blocks[main].start:blocks[main].end])
+		for i, b := range blocks {
+			if i == main {
+				continue
+			}
+			isAd := rules.Discontinuity && b.duration <= rules.MaxAdDuration
+			if !isAd && rules.Duration {
+				isAd = math.Abs(modeDuration(segments[b.start:b.end])-mainMode) > rules.DurationTolerance
+			}
+			if isAd {
+				for j := b.start; j < b.end; j++ {
+					ads[j] = true
+				}
+			}
+		}
+	}
+	if rules.Prefix && len(segments) > 0 {
+		mainPrefix := dominantPrefix(segments[blocks[main].start:blocks[main].end])
+		for i := range segments {
+			if segmentPrefix(segments[i].Uri) != mainPrefix {
+				ads[i] = true
+			}
+		}
+	}
+
+	out = &Playlist{
+		Header:  playlist.Header,
+		EndList: playlist.EndList,
+	}
+	lastKept := -1
+	for i, segment := range segments {
+		if ads[i] {
+			removed++
+			continue
+		}
+		// 去掉插播后，保留段之间若原本隔着 DISCONTINUITY 仍需保留，时间戳可能不连续
+		segment.Discontinuity = lastKept >= 0 && hasDiscontinuityBetween(segments, lastKept, i)
+		out.Segments = append(out.Segments, segment)
+		lastKept = i
+	}
+	return
+}
+
+func splitBlocks(segments []Segment) (blocks []block) {
+	if len(segments) == 0 {
+		return []block{{}}
+	}
+	current := block{}
+	for i, segment := range segments {
+		if segment.Discontinuity && i > current.start {
+			current.end = i
+			blocks = append(blocks, current)
+			current = block{start: i}
+		}
+		current.duration += segment.Duration
+	}
+	current.end = len(segments)
+	return append(blocks, current)
+}
+
+func hasDiscontinuityBetween(segments []Segment, from, to int) bool {
+	for i := from + 1; i <= to; i++ {
+		if segments[i].Discontinuity {
+			return true
+		}
+	}
+	return false
+}
+
+// modeDuration 出现次数最多的分片时长(按 0.1 秒取整统计)
+func modeDuration(segments []Segment) float64 {
+	counts := make(map[int64]int)
+	var best int64
+	for _, segment := range segments {
+		key := int64(math.Round(segment.Duration * 10))
+		counts[key]++
+		if counts[key] > counts[best] || (counts[key] == counts[best] && key > best) {
+			best = key
+		}
+	}
+	return float64(best) / 10
+}
+
+func dominantPrefix(segments []Segment) string {
+	counts := make(map[string]int)
+	var best string
+	for _, segment := range segments {
+		prefix := segmentPrefix(segment.Uri)
+		counts[prefix]++
+		if counts[prefix] > counts[best] {
+			best = prefix
+		}
+	}
+	return best
+}
+
+// segmentPrefix 分片的 host + 目录
+func segmentPrefix(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	return u.Host + path.Dir(u.Path)
+}
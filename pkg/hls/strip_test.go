@@ -0,0 +1,101 @@
+package hls
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"video/config"
+)
+
+func loadFixture(t *testing.T, name string, base string) *Playlist {
+	t.Helper()
+	body, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	playlist, err := Parse(string(body), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return playlist
+}
+
+func TestStripAds(t *testing.T) {
+	const base = "https://v.example.com/20240101/abc/index.m3u8"
+	tests := []struct {
+		fixture string
+		rules   []string
+		total   int
+		removed int
+	}{
+		{"discontinuity_ad.m3u8", []string{RuleDiscontinuity}, 83, 3},
+		{"discontinuity_ad.m3u8", []string{RulePrefix}, 83, 3},
+		{"host_ad.m3u8", nil, 12, 0},
+		{"host_ad.m3u8", []string{RulePrefix}, 12, 2},
+		{"multi_host.m3u8", nil, 12, 0},
+		{"host_ad.m3u8", []string{RuleDiscontinuity, RuleDuration}, 12, 0},
+		{"duration_ad.m3u8", []string{RuleDiscontinuity}, 180, 0},
+		{"duration_ad.m3u8", []string{RuleDuration}, 180, 60},
+		{"clean.m3u8", nil, 11, 0},
+	}
+	for _, tt := range tests {
+		playlist := loadFixture(t, tt.fixture, base)
+		if len(playlist.Segments) != tt.total {
+			t.Fatalf("%s: expected %d segments, got %d", tt.fixture, tt.total, len(playlist.Segments))
+		}
+		out, removed := StripAds(playlist, RulesFromConfig(config.Hls{Rules: tt.rules}))
+		if removed != tt.removed || len(out.Segments) != tt.total-tt.removed {
+			t.Errorf("%s %v: expected %d removed, got %d", tt.fixture, tt.rules, tt.removed, removed)
+		}
+	}
+}
+
+func TestStripAdsRewrite(t *testing.T) {
+	playlist := loadFixture(t, "discontinuity_ad.m3u8", "https://v.example.com/20240101/abc/index.m3u8")
+	out, _ := StripAds(playlist, RulesFromConfig(config.Hls{}))
+	text := out.String()
+	if strings.Contains(text, "/ad/") {
+		t.Errorf("ad segments not removed:\n%s", text)
+	}
+	if !strings.Contains(text, `#EXT-X-KEY:METHOD=AES-128,URI="https://v.example.com/20240101/abc/key.key"`) {
+		t.Errorf("key uri not absolute:\n%s", text)
+	}
+	if !strings.Contains(text, "\nhttps://v.example.com/20240101/abc/a000.ts\n") {
+		t.Errorf("segment uri not absolute:\n%s", text)
+	}
+	// 去掉插播后两段主体之间仍保留一个 DISCONTINUITY
+	if n := strings.Count(text, "#EXT-X-DISCONTINUITY"); n != 1 {
+		t.Errorf("expected 1 discontinuity, got %d:\n%s", n, text)
+	}
+	if !strings.HasSuffix(text, "#EXT-X-ENDLIST\n") {
+		t.Errorf("missing endlist:\n%s", text)
+	}
+	reparsed, err := Parse(text, "https://other.example.com/")
+	if err != nil || len(reparsed.Segments) != 80 {
+		t.Errorf("rewritten playlist not parseable: %v", err)
+	}
+}
+
+func TestFetchMediaResolvesMaster(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/master.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/master.m3u8")
+	})
+	mux.HandleFunc("/1080/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/clean.m3u8")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	playlist, err := NewClient().FetchMedia(context.Background(), server.URL+"/master.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(playlist.Segments) != 11 || playlist.Segments[0].Uri != server.URL+"/1080/s0.ts" {
+		t.Fatalf("unexpected media playlist: %+v", playlist.Segments[0])
+	}
+}
@@ -0,0 +1,361 @@
+package hlscache
+
+import (
+	"container/list"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"video/config"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/108.0.0.0 Safari/537.36"
+
+// ErrTooLarge 上游内容超过 MaxObject，不缓存
+var ErrTooLarge = errors.New("上游内容过大")
+
+const (
+	KindPlaylist = "playlist"
+	KindSegment  = "segment"
+)
+
+// Entry 缓存条目，数据文件为 Dir/<key>.data，元数据为 Dir/<key>.meta
+type Entry struct {
+	Key         string
+	Url         string
+	FinalUrl    string // 重定向后的地址，播放列表据此解析相对路径
+	ContentType string
+	Kind        string
+	Size        int64
+	FetchedAt   time.Time
+}
+
+// Stats 缓存命中统计
+type Stats struct {
+	Hits      int64
+	Misses    int64
+	Coalesced int64 // 未命中但与其它请求合并，共用一次上游请求
+	Evictions int64
+	Errors    int64
+	Entries   int
+	Bytes     int64
+	MaxBytes  int64
+}
+
+// Cache 本地磁盘 LRU 缓存，同一地址的并发未命中只请求一次上游
+type Cache struct {
+	Dir         string
+	MaxBytes    int64
+	PlaylistTTL time.Duration
+	SegmentTTL  time.Duration
+	MaxObject   int64 // 单个对象的最大字节数
+	HttpClient  *http.Client
+	secret      []byte
+
+	mu      sync.Mutex
+	lru     *list.List // 队首为最近使用
+	entries map[string]*list.Element
+	size    int64
+	group   singleflight.Group
+
+	hits, misses, coalesced, evictions, errors atomic.Int64
+}
+
+// New 创建缓存并加载磁盘上已有的条目
+func New(cfg config.HlsCache) (*Cache, error) {
+	cache := &Cache{
+		Dir:         cfg.Dir,
+		MaxBytes:    cfg.MaxSize << 20,
+		PlaylistTTL: time.Duration(cfg.PlaylistTTL) * time.Second,
+		SegmentTTL:  time.Duration(cfg.SegmentTTL) * time.Second,
+		MaxObject:   cfg.MaxObjectSize << 20,
+		HttpClient:  &http.Client{Timeout: 60 * time.Second},
+		secret:      []byte(cfg.Secret),
+		lru:         list.New(),
+		entries:     make(map[string]*list.Element),
+	}
+	// 随机密钥在重启或多实例时不一致，已下发的分片地址会全部失效，必须配置
+	if len(cache.secret) == 0 {
+		return nil, errors.New("HlsCache.Secret 未配置")
+	}
+	if cache.MaxBytes <= 0 {
+		cache.MaxBytes = 10 << 30
+	}
+	if cache.MaxObject <= 0 {
+		cache.MaxObject = 64 << 20
+	}
+	if cache.PlaylistTTL <= 0 {
+		cache.PlaylistTTL = 10 * time.Minute
+	}
+	if cache.SegmentTTL <= 0 {
+		cache.SegmentTTL = 7 * 24 * time.Hour
+	}
+	if err := os.MkdirAll(cache.Dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return cache, cache.load()
+}
+
+// load 按修改时间从旧到新加载已有条目，最近写入的排在 LRU 队首
+func (that *Cache) load() error {
+	metaFiles, err := filepath.Glob(filepath.Join(that.Dir, "*.meta"))
+	if err != nil {
+		return err
+	}
+	var loaded []Entry
+	for _, metaFile := range metaFiles {
+		body, err := os.ReadFile(metaFile)
+		if err != nil {
+			continue
+		}
+		var entry Entry
+		if json.Unmarshal(body, &entry) != nil || entry.Key == "" {
+			os.Remove(metaFile)
+			continue
+		}
+		if _, err := os.Stat(that.dataPath(entry.Key)); err != nil {
+			os.Remove(metaFile)
+			continue
+		}
+		loaded = append(loaded, entry)
+	}
+	sort.Slice(loaded, func(i, j int) bool {
+		return loaded[i].FetchedAt.Before(loaded[j].FetchedAt)
+	})
+	that.mu.Lock()
+	defer that.mu.Unlock()
+	for i := range loaded {
+		that.entries[loaded[i].Key] = that.lru.PushFront(&loaded[i])
+		that.size += loaded[i].Size
+	}
+	that.evictLocked()
+	return nil
+}
+
+// Sign 对上游地址签名，分片接口只代理签过名的地址，避免成为开放代理
+func (that *Cache) Sign(url string) string {
+	mac := hmac.New(sha256.New, that.secret)
+	mac.Write([]byte(url))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func (that *Cache) Verify(url string, sig string) bool {
+	return hmac.Equal([]byte(that.Sign(url)), []byte(sig))
+}
+
+func Key(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])
+}
+
+func (that *Cache) dataPath(key string) string {
+	return filepath.Join(that.Dir, key+".data")
+}
+
+func (that *Cache) metaPath(key string) string {
+	return filepath.Join(that.Dir, key+".meta")
+}
+
+func (that *Cache) ttl(kind string) time.Duration {
+	if kind == KindPlaylist {
+		return that.PlaylistTTL
+	}
+	return that.SegmentTTL
+}
+
+// Fetch 返回地址对应的缓存条目，未命中或过期时拉取上游，hit 表示直接命中缓存
+func (that *Cache) Fetch(ctx context.Context, url string) (entry Entry, hit bool, err error) {
+	key := Key(url)
+	that.mu.Lock()
+	if elem, ok := that.entries[key]; ok {
+		cached := elem.Value.(*Entry)
+		if time.Since(cached.FetchedAt) < that.ttl(cached.Kind) {
+			that.lru.MoveToFront(elem)
+			entry = *cached
+			that.mu.Unlock()
+			that.hits.Add(1)
+			return entry, true, nil
+		}
+	}
+	that.mu.Unlock()
+
+	that.misses.Add(1)
+	// 合并的请求共用第一个请求的上游拉取，不能因为第一个客户端断开而全部失败
+	value, err, shared := that.group.Do(key, func() (any, error) {
+		return that.download(context.WithoutCancel(ctx), key, url)
+	})
+	if shared {
+		that.coalesced.Add(1)
+	}
+	if err != nil {
+		that.errors.Add(1)
+		return
+	}
+	return value.(Entry), false, nil
+}
+
+func (that *Cache) download(ctx context.Context, key string, url string) (entry Entry, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := that.HttpClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return entry, fmt.Errorf("上游返回错误状态码: %d", resp.StatusCode)
+	}
+	if resp.ContentLength > that.MaxObject {
+		return entry, fmt.Errorf("%w: %d > %d", ErrTooLarge, resp.ContentLength, that.MaxObject)
+	}
+	tmp, err := os.CreateTemp(that.Dir, key+".*.tmp")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	// 多读一个字节判断是否超出上限，Content-Length 缺失或不准时也不会写满磁盘
+	size, err := io.Copy(tmp, io.LimitReader(resp.Body, that.MaxObject+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size > that.MaxObject {
+		err = fmt.Errorf("%w: 超过 %d", ErrTooLarge, that.MaxObject)
+	}
+	if err != nil {
+		return
+	}
+	entry = Entry{
+		Key:       key,
+		Url:       url,
+		FinalUrl:  resp.Request.URL.String(),
+		Size:      size,
+		FetchedAt: time.Now(),
+	}
+	entry.Kind, entry.ContentType = detectKind(entry.FinalUrl, resp.Header.Get("Content-Type"))
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	that.mu.Lock()
+	defer that.mu.Unlock()
+	if err = os.Rename(tmp.Name(), that.dataPath(key)); err != nil {
+		return
+	}
+	if err = os.WriteFile(that.metaPath(key), meta, 0644); err != nil {
+		return
+	}
+	if elem, ok := that.entries[key]; ok {
+		that.size -= elem.Value.(*Entry).Size
+		that.lru.Remove(elem)
+	}
+	stored := entry
+	that.entries[key] = that.lru.PushFront(&stored)
+	that.size += size
+	that.evictLocked()
+	return
+}
+
+// evictLocked 超出容量时从队尾淘汰，调用方需持有锁
+func (that *Cache) evictLocked() {
+	for that.size > that.MaxBytes && that.lru.Len() > 0 {
+		elem := that.lru.Back()
+		entry := elem.Value.(*Entry)
+		that.lru.Remove(elem)
+		delete(that.entries, entry.Key)
+		that.size -= entry.Size
+		os.Remove(that.dataPath(entry.Key))
+		os.Remove(that.metaPath(entry.Key))
+		that.evictions.Add(1)
+	}
+}
+
+// Get 返回地址的内容和重定向后的地址，供 hls.Client 拉取播放列表
+func (that *Cache) Get(ctx context.Context, url string) (body []byte, finalUrl string, err error) {
+	entry, _, err := that.Fetch(ctx, url)
+	if err != nil {
+		return
+	}
+	body, err = os.ReadFile(that.dataPath(entry.Key))
+	return body, entry.FinalUrl, err
+}
+
+// Serve 输出地址对应的缓存内容，支持 Range 请求
+func (that *Cache) Serve(w http.ResponseWriter, r *http.Request, url string) {
+	entry, hit, err := that.Fetch(r.Context(), url)
+	if err != nil {
+		http.Error(w, "Failed to fetch upstream", http.StatusBadGateway)
+		return
+	}
+	// 淘汰只删除目录项，已打开的文件仍可读完
+	file, err := os.Open(that.dataPath(entry.Key))
+	if err != nil {
+		http.Error(w, "Cache file missing", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	if hit {
+		w.Header().Set("X-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
+	}
+	w.Header().Set("Content-Type", entry.ContentType)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(that.ttl(entry.Kind).Seconds())))
+	http.ServeContent(w, r, "", entry.FetchedAt, file)
+}
+
+func (that *Cache) Stats() Stats {
+	that.mu.Lock()
+	defer that.mu.Unlock()
+	return Stats{
+		Hits:      that.hits.Load(),
+		Misses:    that.misses.Load(),
+		Coalesced: that.coalesced.Load(),
+		Evictions: that.evictions.Load(),
+		Errors:    that.errors.Load(),
+		Entries:   that.lru.Len(),
+		Bytes:     that.size,
+		MaxBytes:  that.MaxBytes,
+	}
+}
+
+// detectKind 根据地址后缀和 Content-Type 判断是播放列表还是分片
+func detectKind(url string, contentType string) (kind string, ct string) {
+	p := url
+	if i := strings.IndexAny(p, "?#"); i >= 0 {
+		p = p[:i]
+	}
+	lowerType := strings.ToLower(contentType)
+	switch ext := strings.ToLower(path.Ext(p)); {
+	case ext == ".m3u8" || strings.Contains(lowerType, "mpegurl"):
+		return KindPlaylist, "application/vnd.apple.mpegurl"
+	case ext == ".ts":
+		return KindSegment, "video/mp2t"
+	case ext == ".m4s" || ext == ".mp4":
+		return KindSegment, "video/mp4"
+	case contentType != "":
+		return KindSegment, contentType
+	default:
+		return KindSegment, "application/octet-stream"
+	}
+}
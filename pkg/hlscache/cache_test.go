@@ -0,0 +1,155 @@
+package hlscache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"video/config"
+)
+
+func TestCacheCoalescingAndHits(t *testing.T) {
+	var upstream atomic.Int64
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream.Add(1)
+		<-release
+		w.Write([]byte(strings.Repeat("x", 1024)))
+	}))
+	defer server.Close()
+
+	cache, err := New(config.HlsCache{Secret: "test", Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := cache.Fetch(context.Background(), server.URL+"/a.ts"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := upstream.Load(); n != 1 {
+		t.Fatalf("expected 1 upstream request, got %d", n)
+	}
+
+	entry, hit, err := cache.Fetch(context.Background(), server.URL+"/a.ts")
+	if err != nil || !hit || entry.Size != 1024 || entry.ContentType != "video/mp2t" {
+		t.Fatalf("expected cache hit, got %+v hit=%v err=%v", entry, hit, err)
+	}
+	stats := cache.Stats()
+	if stats.Hits != 1 || stats.Misses != 10 || stats.Entries != 1 || stats.Bytes != 1024 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestCacheEvictionAndReload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 400<<10)))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	cache, err := New(config.HlsCache{Secret: "test", Dir: dir, MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/1.ts", "/2.ts", "/1.ts", "/3.ts"} {
+		if _, _, err := cache.Fetch(context.Background(), server.URL+name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 1MB 只能放下两个 400KB 分片，最久未使用的 /2.ts 被淘汰
+	stats := cache.Stats()
+	if stats.Entries != 2 || stats.Evictions != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if _, hit, _ := cache.Fetch(context.Background(), server.URL+"/1.ts"); !hit {
+		t.Errorf("/1.ts should still be cached")
+	}
+
+	reloaded, err := New(config.HlsCache{Secret: "test", Dir: dir, MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Stats().Entries != 2 {
+		t.Fatalf("expected entries reloaded from disk, got %+v", reloaded.Stats())
+	}
+	if _, hit, _ := reloaded.Fetch(context.Background(), server.URL+"/3.ts"); !hit {
+		t.Errorf("/3.ts should be served from disk after reload")
+	}
+}
+
+func TestCachePlaylistTTL(t *testing.T) {
+	var upstream atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream.Add(1)
+		w.Write([]byte("#EXTM3U\n"))
+	}))
+	defer server.Close()
+
+	cache, err := New(config.HlsCache{Secret: "test", Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.PlaylistTTL = 20 * time.Millisecond
+	body, _, err := cache.Get(context.Background(), server.URL+"/index.m3u8")
+	if err != nil || string(body) != "#EXTM3U\n" {
+		t.Fatalf("unexpected body %q: %v", body, err)
+	}
+	cache.Get(context.Background(), server.URL+"/index.m3u8")
+	time.Sleep(30 * time.Millisecond)
+	cache.Get(context.Background(), server.URL+"/index.m3u8")
+	if n := upstream.Load(); n != 2 {
+		t.Fatalf("expected playlist refetched after ttl, got %d upstream requests", n)
+	}
+	if !cache.Verify("https://a.com/1.ts", cache.Sign("https://a.com/1.ts")) || cache.Verify("https://a.com/2.ts", cache.Sign("https://a.com/1.ts")) {
+		t.Errorf("signature verification mismatch")
+	}
+}
+
+func TestCacheMaxObject(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 不设置 Content-Length，只能边读边判断
+		w.(http.Flusher).Flush()
+		w.Write([]byte(strings.Repeat("x", 2048)))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	cache, err := New(config.HlsCache{Secret: "test", Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.MaxObject = 1024
+	if _, _, err = cache.Fetch(context.Background(), server.URL+"/big.ts"); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("expected ErrTooLarge, got %v", err)
+	}
+	files, _ := os.ReadDir(dir)
+	if stats := cache.Stats(); stats.Entries != 0 || stats.Errors != 1 || len(files) != 0 {
+		t.Errorf("expected nothing cached, stats = %+v, files = %d", stats, len(files))
+	}
+	cache.MaxObject = 2048
+	if entry, _, err := cache.Fetch(context.Background(), server.URL+"/big.ts"); err != nil || entry.Size != 2048 {
+		t.Errorf("expected object at the limit cached, got %+v: %v", entry, err)
+	}
+}
+
+func TestCacheRequiresSecret(t *testing.T) {
+	if _, err := New(config.HlsCache{Dir: t.TempDir()}); err == nil {
+		t.Error("expected error without secret")
+	}
+}
@@ -0,0 +1,49 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+
+	"video/model"
+
+	"gorm.io/gorm"
+)
+
+// BatchItem 批量入库中一个视频的结果，Err 不为空表示该视频失败，不影响同批其它视频
+type BatchItem struct {
+	Result
+	Err error
+}
+
+// IngestBatch 在一个事务内写入一批视频，每个视频使用独立的保存点，失败时只回滚该视频。
+// 事务提交失败时整批都返回该错误。
+func (that *Service) IngestBatch(ctx context.Context, videos []*model.Video) []BatchItem {
+	items := make([]BatchItem, len(videos))
+	err := that.db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i, video := range videos {
+			if err := tx.SavePoint("item").Error; err != nil {
+				return err
+			}
+			res, err := that.ingestOne(tx, video)
+			if err != nil {
+				if rollbackErr := tx.RollbackTo("item").Error; rollbackErr != nil {
+					return rollbackErr
+				}
+				items[i].Err = err
+				continue
+			}
+			items[i].Result = res
+		}
+		return nil
+	})
+	if err != nil {
+		var ingestErr *Error
+		if !errors.As(err, &ingestErr) {
+			err = stepError("Transaction Commit Failed", err)
+		}
+		for i := range items {
+			items[i] = BatchItem{Err: err}
+		}
+	}
+	return items
+}
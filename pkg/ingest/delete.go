@@ -0,0 +1,146 @@
+package ingest
+
+import (
+	"context"
+	"time"
+
+	"video/model"
+	"video/pkg/event"
+
+	"gorm.io/gorm"
+)
+
+// MaxBatch 一次删除或恢复的最大视频数
+const MaxBatch = 500
+
+// cascade 随视频一起软删除和恢复的关联表
+var cascade = []any{&model.VideoUrl{}, &model.VideoEpisode{}, &model.VideoCategory{}}
+
+// Delete 软删除视频及其播放地址、分集、分类关联，并减少分类的视频数，返回实际删除的视频 id。
+// 关联行与视频使用同一个 deleted_at，恢复时只恢复这次一起删除的行。
+func (that *Service) Delete(ctx context.Context, ids []int64) (deleted []int64, err error) {
+	err = that.db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		deleted, err = that.delete(tx, ids)
+		return err
+	})
+	return
+}
+
+func (that *Service) delete(tx *gorm.DB, ids []int64) (deleted []int64, err error) {
+	var videos []model.Video
+	if err = tx.Where("id IN ?", ids).Find(&videos).Error; err != nil {
+		return nil, stepError("Failed to query videos", err)
+	}
+	if len(videos) == 0 {
+		return
+	}
+	for _, video := range videos {
+		deleted = append(deleted, video.Id)
+	}
+	// 精确到秒，不同精度的 datetime 列保存的值一致，恢复时可以按相等匹配
+	now := time.Now().Truncate(time.Second)
+
+	var links []model.VideoCategory
+	if err = tx.Where("video_id IN ?", deleted).Find(&links).Error; err != nil {
+		return nil, stepError("Failed to query video categories", err)
+	}
+	for _, table := range cascade {
+		if err = tx.Model(table).Where("video_id IN ?", deleted).
+			UpdateColumn("deleted_at", now).Error; err != nil {
+			return nil, stepError("Failed to delete video relations", err)
+		}
+	}
+	if err = tx.Model(&model.Video{}).Where("id IN ?", deleted).
+		UpdateColumn("deleted_at", now).Error; err != nil {
+		return nil, stepError("Failed to delete videos", err)
+	}
+	if err = adjustVideoCount(tx, links, -1); err != nil {
+		return
+	}
+	events := make([]event.Event, 0, len(videos))
+	for i := range videos {
+		e, err := event.VideoEvent(event.VideoDeleted, &videos[i], nil)
+		if err != nil {
+			return nil, stepError("Failed to enqueue video event", err)
+		}
+		events = append(events, e)
+	}
+	if err = event.Enqueue(tx, events...); err != nil {
+		return nil, stepError("Failed to enqueue video event", err)
+	}
+	return
+}
+
+// Restore 恢复 Delete 删除的视频及关联，并加回分类的视频数，返回实际恢复的视频 id
+func (that *Service) Restore(ctx context.Context, ids []int64) (restored []int64, err error) {
+	err = that.db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		restored, err = that.restore(tx, ids)
+		return err
+	})
+	return
+}
+
+func (that *Service) restore(tx *gorm.DB, ids []int64) (restored []int64, err error) {
+	var videos []model.Video
+	if err = tx.Unscoped().Where("id IN ?", ids).Where("deleted_at IS NOT NULL").
+		Find(&videos).Error; err != nil {
+		return nil, stepError("Failed to query videos", err)
+	}
+	events := make([]event.Event, 0, len(videos))
+	for i := range videos {
+		video := &videos[i]
+		deletedAt := video.DeletedAt.Time
+		var links []model.VideoCategory
+		if err = tx.Unscoped().Where("video_id = ? AND deleted_at = ?", video.Id, deletedAt).
+			Find(&links).Error; err != nil {
+			return nil, stepError("Failed to query video categories", err)
+		}
+		for _, table := range cascade {
+			if err = tx.Unscoped().Model(table).Where("video_id = ? AND deleted_at = ?", video.Id, deletedAt).
+				UpdateColumn("deleted_at", nil).Error; err != nil {
+				return nil, stepError("Failed to restore video relations", err)
+			}
+		}
+		if err = tx.Unscoped().Model(&model.Video{}).Where("id = ?", video.Id).
+			UpdateColumn("deleted_at", nil).Error; err != nil {
+			return nil, stepError("Failed to restore videos", err)
+		}
+		if err = adjustVideoCount(tx, links, 1); err != nil {
+			return
+		}
+		categoryIds := make([]int64, 0, len(links))
+		for _, link := range links {
+			categoryIds = append(categoryIds, link.CategoryId)
+		}
+		e, err := event.VideoEvent(event.VideoUpdated, video, categoryIds)
+		if err != nil {
+			return nil, stepError("Failed to enqueue video event", err)
+		}
+		events = append(events, e)
+		restored = append(restored, video.Id)
+	}
+	if err = event.Enqueue(tx, events...); err != nil {
+		return nil, stepError("Failed to enqueue video event", err)
+	}
+	return
+}
+
+// adjustVideoCount 按关联行调整分类视频数，sign 为 1 增加、-1 减少
+func adjustVideoCount(tx *gorm.DB, links []model.VideoCategory, sign int) error {
+	counts := make(map[int64]int)
+	for _, link := range links {
+		counts[link.CategoryId]++
+	}
+	// 相同变化量的分类合并为一条 UPDATE
+	byDelta := make(map[int][]int64)
+	for categoryId, n := range counts {
+		byDelta[n*sign] = append(byDelta[n*sign], categoryId)
+	}
+	var category model.Category
+	for delta, categoryIds := range byDelta {
+		if err := category.IncrVideoCount(tx, categoryIds, delta); err != nil {
+			return stepError("Failed to update category video count", err)
+		}
+	}
+	return nil
+}
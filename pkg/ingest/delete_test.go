@@ -0,0 +1,124 @@
+package ingest
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// softDeleted 按语句中的 deleted_at 条件和 key 列是否在参数中过滤行，行的最后一列为 deleted_at
+func softDeleted(query string, args []any, rows [][]driver.Value, key int) (matched [][]driver.Value) {
+	for _, row := range rows {
+		deletedAt := row[len(row)-1]
+		switch {
+		case strings.Contains(query, "`deleted_at` IS NULL") && deletedAt != nil:
+			continue
+		case strings.Contains(query, "deleted_at IS NOT NULL") && deletedAt == nil:
+			continue
+		case strings.Contains(query, "deleted_at = ?") && deletedAt != args[len(args)-1]:
+			continue
+		}
+		if slices.Contains(args, any(row[key])) {
+			matched = append(matched, row)
+		}
+	}
+	return
+}
+
+// deleteFixture 视频 1 未删除，关联分类 10、11；视频 2 在 deletedAt 删除，同时删除的关联分类 12，另有更早单独删除的关联分类 13
+func deleteFixture(deletedAt time.Time) *fakeDB {
+	earlier := deletedAt.Add(-time.Hour)
+	videos := [][]driver.Value{{int64(1), "甲", nil}, {int64(2), "乙", deletedAt}}
+	links := [][]driver.Value{
+		{int64(1), int64(1), int64(10), nil},
+		{int64(2), int64(1), int64(11), nil},
+		{int64(3), int64(2), int64(12), deletedAt},
+		{int64(4), int64(2), int64(13), earlier},
+	}
+	return &fakeDB{nextId: 1000, query: func(query string, args []any) ([]string, [][]driver.Value) {
+		switch {
+		case strings.HasPrefix(query, "SELECT * FROM `video` WHERE id IN"):
+			return []string{"id", "title", "deleted_at"}, softDeleted(query, args, videos, 0)
+		case strings.HasPrefix(query, "SELECT * FROM `video_category` WHERE video_id"):
+			return []string{"id", "video_id", "category_id", "deleted_at"}, softDeleted(query, args, links, 1)
+		}
+		return nil, nil
+	}}
+}
+
+// sortedIds 返回 video_count 语句中按升序排列的分类 id，调整时分类顺序不固定
+func sortedIds(args []any) []any {
+	ids := slices.Clone(args[1:])
+	slices.SortFunc(ids, func(a, b any) int { return int(a.(int64) - b.(int64)) })
+	return ids
+}
+
+func TestDelete(t *testing.T) {
+	fake := deleteFixture(time.Now().Truncate(time.Second))
+	// 视频 2 已删除，只删除视频 1
+	deleted, err := New(fake.open(t)).Delete(context.Background(), []int64{1, 2})
+	if err != nil || !reflect.DeepEqual(deleted, []int64{1}) {
+		t.Fatalf("deleted = %v, %v", deleted, err)
+	}
+	video := fake.find(t, "^UPDATE `video` SET `deleted_at`=\\? WHERE id IN")
+	if !reflect.DeepEqual(video.Args[1:], []any{int64(1)}) {
+		t.Errorf("delete video args = %v", video.Args)
+	}
+	// 关联表与视频使用同一个 deleted_at，恢复时据此匹配
+	for _, table := range []string{"video_url", "video_episode", "video_category"} {
+		stmt := fake.find(t, "^UPDATE `"+table+"` SET `deleted_at`=\\? WHERE video_id IN")
+		if !reflect.DeepEqual(stmt.Args, []any{video.Args[0], int64(1)}) || !strings.Contains(stmt.SQL, "`deleted_at` IS NULL") {
+			t.Errorf("delete %s: %s %v", table, stmt.SQL, stmt.Args)
+		}
+	}
+	stmt := fake.find(t, "^UPDATE `category` SET `video_count`=GREATEST")
+	if stmt.Args[0] != int64(1) || !reflect.DeepEqual(sortedIds(stmt.Args), []any{int64(10), int64(11)}) {
+		t.Errorf("decrease video_count args = %v", stmt.Args)
+	}
+	if n := fake.count("^INSERT INTO `outbox`"); n != 1 {
+		t.Errorf("expected 1 outbox insert, got %d", n)
+	}
+}
+
+func TestDeleteTwice(t *testing.T) {
+	fake := deleteFixture(time.Now().Truncate(time.Second))
+	// 已删除的视频再次删除时不修改任何数据，分类视频数不重复减少
+	deleted, err := New(fake.open(t)).Delete(context.Background(), []int64{2})
+	if err != nil || len(deleted) != 0 {
+		t.Fatalf("deleted = %v, %v", deleted, err)
+	}
+	if len(fake.execs) != 0 {
+		t.Errorf("expected no statements, got %v", fake.execs)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	deletedAt := time.Now().Truncate(time.Second)
+	fake := deleteFixture(deletedAt)
+	// 视频 1 未删除，只恢复视频 2
+	restored, err := New(fake.open(t)).Restore(context.Background(), []int64{1, 2})
+	if err != nil || !reflect.DeepEqual(restored, []int64{2}) {
+		t.Fatalf("restored = %v, %v", restored, err)
+	}
+	// 只恢复与视频同时删除的关联
+	for _, table := range []string{"video_url", "video_episode", "video_category"} {
+		stmt := fake.find(t, "^UPDATE `"+table+"` SET `deleted_at`=\\? WHERE video_id = \\? AND deleted_at = \\?")
+		if !reflect.DeepEqual(stmt.Args, []any{nil, int64(2), deletedAt}) {
+			t.Errorf("restore %s args = %v", table, stmt.Args)
+		}
+	}
+	if stmt := fake.find(t, "^UPDATE `video` SET `deleted_at`=\\? WHERE id = \\?"); !reflect.DeepEqual(stmt.Args, []any{nil, int64(2)}) {
+		t.Errorf("restore video args = %v", stmt.Args)
+	}
+	// 单独删除的关联 13 不恢复，视频数不增加
+	if stmt := fake.find(t, "^UPDATE `category` SET `video_count`=video_count \\+ \\?"); !reflect.DeepEqual(stmt.Args, []any{int64(1), int64(12)}) {
+		t.Errorf("increase video_count args = %v", stmt.Args)
+	}
+	if n := fake.count("^INSERT INTO `outbox`"); n != 1 {
+		t.Errorf("expected 1 outbox insert, got %d", n)
+	}
+}
@@ -0,0 +1,272 @@
+package ingest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+
+	"video/core"
+	"video/model"
+	"video/pkg/event"
+
+	"gorm.io/gorm"
+)
+
+// Result 一次入库的结果
+type Result struct {
+	VideoId     int64
+	Created     bool // true 新建，false 更新已有视频(按 title + type_pid 去重)
+	Skipped     bool // 内容与上次入库相同，未做任何修改
+	CategoryIds []int64
+}
+
+// Error 入库某一步骤失败，Message 可直接返回给调用方，Err 为原始错误
+type Error struct {
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func stepError(message string, err error) error {
+	return &Error{Message: message, Err: err}
+}
+
+// Retryable 数据不合法或视频不存在时重试也不会成功，其它错误(数据库、唯一索引冲突等)可以重试
+func Retryable(err error) bool {
+	if errors.Is(err, ErrNotFound) {
+		return false
+	}
+	return model.KindOf(err) != model.KindValidation
+}
+
+// Service 视频入库流程：VideoClass -> Category -> VideoGroup -> Video -> VideoUrl -> VideoEpisode -> VideoCategory -> Outbox，
+// 供 /api/v1/video/create 和采集程序共用
+type Service struct {
+	DB *gorm.DB
+}
+
+// New db 为空时使用 core.New().DB
+func New(db *gorm.DB) *Service {
+	return &Service{DB: db}
+}
+
+func (that *Service) db() *gorm.DB {
+	if that.DB != nil {
+		return that.DB
+	}
+	return core.New().DB.DB.DB
+}
+
+// Ingest 在一个事务内写入视频及其分类、分组、播放地址；
+// 同一视频同一播放来源(ProxyName)的内容与上次入库相同时直接返回，不修改数据
+func (that *Service) Ingest(ctx context.Context, video *model.Video) (res Result, err error) {
+	err = that.db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res, err = that.ingestOne(tx, video)
+		return err
+	})
+	if err != nil {
+		var ingestErr *Error
+		if !errors.As(err, &ingestErr) {
+			err = stepError("Transaction Commit Failed", err)
+		}
+	}
+	return
+}
+
+// ContentHash 入库内容的摘要，只包含请求中的内容，不包含 Id、时间等数据库字段
+func ContentHash(video *model.Video) string {
+	payload := *video
+	payload.Id = 0
+	payload.CreatedAt = nil
+	payload.UpdatedAt = nil
+	payload.DeletedAt = nil
+	payload.VideoUrl.Id = 0
+	payload.VideoUrl.VideoId = 0
+	payload.VideoUrl.ContentHash = ""
+	body, _ := json.Marshal(payload)
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// ingestOne 内容未变化时跳过，否则写入视频并记录内容摘要
+func (that *Service) ingestOne(tx *gorm.DB, video *model.Video) (res Result, err error) {
+	hash := ContentHash(video)
+	var unchanged bool
+	if res, unchanged, err = that.unchanged(tx, video, hash); err != nil {
+		return res, stepError("Failed to query video", err)
+	}
+	if unchanged {
+		return
+	}
+	video.VideoUrl.ContentHash = hash
+	return that.ingest(tx, video)
+}
+
+// unchanged 视频已存在(与 Video.Create 相同按标题的检索形式查找)且该播放来源上次入库的摘要相同时返回 true
+func (that *Service) unchanged(tx *gorm.DB, video *model.Video, hash string) (res Result, unchanged bool, err error) {
+	if video.Title == "" || video.VideoUrl.Url == "" {
+		return
+	}
+	var existing model.Video
+	err = tx.Where("search_title = ?", model.SearchText(video.Title)).
+		Where("type_pid = ?", video.VideoClass.TypePid).
+		Limit(1).Find(&existing).Error
+	if err != nil || existing.Id == 0 {
+		return res, false, err
+	}
+	var count int64
+	if err = tx.Model(&model.VideoUrl{}).
+		Where("video_id = ? AND proxy_name = ? AND content_hash = ?", existing.Id, video.VideoUrl.ProxyName, hash).
+		Count(&count).Error; err != nil || count == 0 {
+		return res, false, err
+	}
+	var links []model.VideoCategory
+	if err = tx.Where("video_id = ?", existing.Id).Find(&links).Error; err != nil {
+		return
+	}
+	res = Result{VideoId: existing.Id, Skipped: true}
+	for _, link := range links {
+		res.CategoryIds = append(res.CategoryIds, link.CategoryId)
+	}
+	return res, true, nil
+}
+
+func (that *Service) ingest(tx *gorm.DB, video *model.Video) (res Result, err error) {
+	if err = video.VideoClass.Create(tx); err != nil {
+		return res, stepError("Failed to create video class", err)
+	}
+
+	video.TypeId = video.VideoClass.TypeId
+	video.TypePid = video.VideoClass.TypePid
+	cc := model.Category{}
+	if len(video.Category) > 0 && video.Category[0].Type != nil {
+		if res.CategoryIds, err = cc.Create(tx, *video.Category[0].Type, video.Category, video.VideoClass); err != nil {
+			return res, stepError("Failed to create categories", err)
+		}
+	}
+
+	if err = video.VideoGroup.Edit(tx); err != nil {
+		return res, stepError("Failed to create video group", err)
+	}
+	if video.VideoGroup.Id > 0 {
+		video.VideoGroupId = video.VideoGroup.Id
+	}
+	res.Created, err = video.Create(tx)
+	if err != nil {
+		return res, stepError("Failed to create video", err)
+	}
+	res.VideoId = video.Id
+	// 没有播放地址的视频只写入视频信息
+	if video.VideoUrl.Url != "" {
+		video.VideoUrl.VideoId = video.Id
+		if err = video.VideoUrl.Create(tx); err != nil {
+			return res, stepError("Failed to create video url", err)
+		}
+		var episode model.VideoEpisode
+		if err = episode.SyncByVideoUrl(tx, video.VideoUrl); err != nil {
+			return res, stepError("Failed to create video episodes", err)
+		}
+	}
+	if err = syncVideoCategory(tx, video.Id, res.CategoryIds); err != nil {
+		return res, err
+	}
+	if err = video.UpdatePinyin(tx, res.CategoryIds); err != nil {
+		return res, stepError("Failed to update pinyin", err)
+	}
+	eventType := event.VideoUpdated
+	if res.Created {
+		eventType = event.VideoCreated
+	}
+	var e event.Event
+	if e, err = event.VideoEvent(eventType, video, res.CategoryIds); err == nil {
+		err = event.Enqueue(tx, e)
+	}
+	if err != nil {
+		return res, stepError("Failed to enqueue video event", err)
+	}
+	return
+}
+
+// syncVideoCategory 同步 Video-Category 关联：已存在不创建、缺失则新增、多余则删除，并相应调整 Category.VideoCount
+func syncVideoCategory(tx *gorm.DB, videoId int64, categoryIds []int64) error {
+	// 查询当前的关联，包括已软删除的，避免重新关联时违反 uk_vc 唯一索引
+	var existing []model.VideoCategory
+	if err := tx.Unscoped().Where("video_id = ?", videoId).Find(&existing).Error; err != nil {
+		return stepError("Failed to query existing categories", err)
+	}
+	wanted := make(map[int64]bool, len(categoryIds))
+	for _, categoryId := range categoryIds {
+		if categoryId > 0 {
+			wanted[categoryId] = true
+		}
+	}
+	current := make(map[int64]model.VideoCategory, len(existing))
+	for _, vc := range existing {
+		current[vc.CategoryId] = vc
+	}
+	var toCreate []model.VideoCategory
+	var toRestoreIds, addedIds, removedIds []int64
+	for _, categoryId := range categoryIds {
+		if !wanted[categoryId] {
+			continue
+		}
+		delete(wanted, categoryId) // 请求中重复的分类只处理一次
+		vc, ok := current[categoryId]
+		switch {
+		case !ok: // 缺失，需创建
+			toCreate = append(toCreate, model.VideoCategory{
+				CategoryId: categoryId,
+				VideoId:    videoId,
+			})
+			addedIds = append(addedIds, categoryId)
+		case vc.DeletedAt != nil && vc.DeletedAt.Valid: // 曾经删除，恢复
+			toRestoreIds = append(toRestoreIds, vc.Id)
+			addedIds = append(addedIds, categoryId)
+		}
+		delete(current, categoryId)
+	}
+	// current 中剩下的是数据库多出来的
+	var toDeleteIds []int64
+	for categoryId, vc := range current {
+		toDeleteIds = append(toDeleteIds, vc.Id)
+		if vc.DeletedAt == nil || !vc.DeletedAt.Valid {
+			removedIds = append(removedIds, categoryId)
+		}
+	}
+	if len(toCreate) > 0 {
+		if err := tx.Create(&toCreate).Error; err != nil {
+			return stepError("Failed to create video categories", err)
+		}
+	}
+	if len(toRestoreIds) > 0 {
+		if err := tx.Unscoped().Model(&model.VideoCategory{}).Where("id IN ?", toRestoreIds).
+			UpdateColumn("deleted_at", nil).Error; err != nil {
+			return stepError("Failed to restore video categories", err)
+		}
+	}
+	if len(toDeleteIds) > 0 {
+		if err := tx.Unscoped().Where("id IN ?", toDeleteIds).Delete(&model.VideoCategory{}).Error; err != nil {
+			return stepError("Failed to delete old categories", err)
+		}
+	}
+	var category model.Category
+	if err := category.IncrVideoCount(tx, addedIds, 1); err != nil {
+		return stepError("Failed to update category video count", err)
+	}
+	if err := category.IncrVideoCount(tx, removedIds, -1); err != nil {
+		return stepError("Failed to update category video count", err)
+	}
+	return nil
+}
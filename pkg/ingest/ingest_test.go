@@ -0,0 +1,36 @@
+package ingest
+
+import (
+	"testing"
+	"time"
+
+	"video/model"
+)
+
+func TestContentHash(t *testing.T) {
+	newVideo := func() *model.Video {
+		movie := model.CategoryTypeMovie
+		return &model.Video{
+			Title:      "流浪地球",
+			VideoClass: model.VideoClass{TypeId: 6, TypePid: 1, TypeName: "科幻片"},
+			Category:   []*model.Category{{Name: "类型", Type: &movie, Category: []model.Category{{Name: "科幻"}}}},
+			VideoUrl:   model.VideoUrl{ProxyName: "tiantang", Proxy: "p", Url: "第1集$https://a.com/1.m3u8"},
+		}
+	}
+	a, b := newVideo(), newVideo()
+	now := time.Now()
+	b.Id = 9
+	b.CreatedAt = &now
+	b.VideoUrl.Id = 3
+	b.VideoUrl.ContentHash = "old"
+	if ContentHash(a) != ContentHash(b) {
+		t.Fatal("expected database fields to be ignored")
+	}
+	if b.Id != 9 || b.VideoUrl.ContentHash != "old" {
+		t.Fatal("ContentHash must not modify the video")
+	}
+	b.VideoUrl.Url = "第1集$https://b.com/1.m3u8"
+	if ContentHash(a) == ContentHash(b) {
+		t.Fatal("expected changed play url to change the hash")
+	}
+}
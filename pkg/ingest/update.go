@@ -0,0 +1,223 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+
+	"video/model"
+	"video/pkg/event"
+
+	"gorm.io/gorm"
+)
+
+// ErrNotFound 要修改的视频不存在
+var ErrNotFound = errors.New("video not found")
+
+// Update /api/v1/video/update 的请求，按 Id 修改，字段为 nil 表示不修改。
+// Category 和 VideoUrlArr 不为 nil 时整体替换，传空数组表示清空。
+type Update struct {
+	Id          int64
+	Title       *string
+	Alias       *string
+	Describe    *string
+	Connection  *int
+	Url         *string
+	Cover       *string
+	Type        *int
+	Keywords    *string
+	VideoClass  *model.VideoClass
+	VideoGroup  *model.VideoGroup // Title 为空表示移出分组
+	Category    []*model.Category
+	VideoUrlArr []model.VideoUrl // 按 ProxyName 匹配已有线路，未出现的线路删除
+}
+
+// Validate 校验请求，错误信息可直接返回给调用方
+func (that *Update) Validate() error {
+	if that.Id <= 0 {
+		return model.NewValidationError("Invalid Id")
+	}
+	if that.Title != nil && *that.Title == "" {
+		return model.NewValidationError("Title cannot be empty")
+	}
+	proxyNames := make(map[string]bool, len(that.VideoUrlArr))
+	for _, videoUrl := range that.VideoUrlArr {
+		if videoUrl.Url == "" {
+			return model.NewValidationError("VideoUrlArr requires Url")
+		}
+		if proxyNames[videoUrl.ProxyName] {
+			return model.NewValidationError("Duplicate ProxyName in VideoUrlArr")
+		}
+		proxyNames[videoUrl.ProxyName] = true
+	}
+	return nil
+}
+
+// columns 返回需要修改的字段，标题、别名同时修改检索形式
+func (that *Update) columns() map[string]any {
+	columns := map[string]any{}
+	if that.Title != nil {
+		columns["title"] = *that.Title
+		columns["search_title"] = model.SearchText(*that.Title)
+	}
+	if that.Alias != nil {
+		columns["alias"] = *that.Alias
+		columns["search_alias"] = model.SearchText(*that.Alias)
+	}
+	if that.Describe != nil {
+		columns["describe"] = *that.Describe
+	}
+	if that.Connection != nil {
+		columns["connection"] = *that.Connection
+	}
+	if that.Url != nil {
+		columns["url"] = *that.Url
+	}
+	if that.Cover != nil {
+		columns["cover"] = *that.Cover
+	}
+	if that.Type != nil {
+		columns["type"] = *that.Type
+	}
+	if that.Keywords != nil {
+		columns["keywords"] = *that.Keywords
+	}
+	return columns
+}
+
+// Update 在一个事务内修改视频及其分类、分组、播放地址，返回修改后的视频和分类 id
+func (that *Service) Update(ctx context.Context, req *Update) (video model.Video, categoryIds []int64, err error) {
+	err = that.db().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		video, categoryIds, err = that.update(tx, req)
+		return err
+	})
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		var ingestErr *Error
+		if !errors.As(err, &ingestErr) {
+			err = stepError("Transaction Commit Failed", err)
+		}
+	}
+	return
+}
+
+func (that *Service) update(tx *gorm.DB, req *Update) (video model.Video, categoryIds []int64, err error) {
+	if err = tx.Where("id = ?", req.Id).First(&video).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return video, nil, ErrNotFound
+		}
+		return video, nil, stepError("Failed to query video", err)
+	}
+	columns := req.columns()
+
+	if req.VideoClass != nil {
+		if err = req.VideoClass.Create(tx); err != nil {
+			return video, nil, stepError("Failed to create video class", err)
+		}
+		columns["type_id"] = req.VideoClass.TypeId
+		columns["type_pid"] = req.VideoClass.TypePid
+	}
+	if req.VideoGroup != nil {
+		if req.VideoGroup.Title == "" {
+			req.VideoGroup.Id = 0
+		}
+		if err = req.VideoGroup.Edit(tx); err != nil {
+			return video, nil, stepError("Failed to create video group", err)
+		}
+		columns["video_group_id"] = req.VideoGroup.Id
+	}
+	if len(columns) > 0 {
+		if err = tx.Model(&model.Video{}).Where("id = ?", video.Id).Updates(columns).Error; err != nil {
+			return video, nil, stepError("Failed to update video", err)
+		}
+	}
+	if err = tx.Where("id = ?", video.Id).First(&video).Error; err != nil {
+		return video, nil, stepError("Failed to query video", err)
+	}
+
+	if req.Category != nil {
+		if len(req.Category) > 0 {
+			cType := model.CategoryTypeMovie
+			if req.Category[0].Type != nil {
+				cType = *req.Category[0].Type
+			} else if video.Type != nil {
+				cType = *video.Type
+			}
+			cc := model.Category{}
+			videoClass := model.VideoClass{TypeId: video.TypeId, TypePid: video.TypePid}
+			if categoryIds, err = cc.Create(tx, cType, req.Category, videoClass); err != nil {
+				return video, nil, stepError("Failed to create categories", err)
+			}
+		}
+		if err = syncVideoCategory(tx, video.Id, categoryIds); err != nil {
+			return
+		}
+	} else {
+		var existing []model.VideoCategory
+		if err = tx.Where("video_id = ?", video.Id).Find(&existing).Error; err != nil {
+			return video, nil, stepError("Failed to query existing categories", err)
+		}
+		for _, vc := range existing {
+			categoryIds = append(categoryIds, vc.CategoryId)
+		}
+	}
+	if err = video.UpdatePinyin(tx, categoryIds); err != nil {
+		return video, nil, stepError("Failed to update pinyin", err)
+	}
+
+	if req.VideoUrlArr != nil {
+		if err = syncVideoUrls(tx, video.Id, req.VideoUrlArr); err != nil {
+			return
+		}
+	}
+	if err = tx.Where("video_id = ?", video.Id).Order("id ASC").Find(&video.VideoUrlArr).Error; err != nil {
+		return video, nil, stepError("Failed to query video urls", err)
+	}
+
+	var e event.Event
+	if e, err = event.VideoEvent(event.VideoUpdated, &video, categoryIds); err == nil {
+		err = event.Enqueue(tx, e)
+	}
+	if err != nil {
+		return video, nil, stepError("Failed to enqueue video event", err)
+	}
+	return
+}
+
+// syncVideoUrls 按 ProxyName 新增或修改播放地址并重建分集，删除请求中没有的播放地址及其分集
+func syncVideoUrls(tx *gorm.DB, videoId int64, videoUrls []model.VideoUrl) error {
+	keep := make([]int64, 0, len(videoUrls))
+	for i := range videoUrls {
+		videoUrl := videoUrls[i]
+		videoUrl.Id = 0
+		videoUrl.VideoId = videoId
+		if err := videoUrl.Create(tx); err != nil {
+			return stepError("Failed to create video url", err)
+		}
+		var episode model.VideoEpisode
+		if err := episode.SyncByVideoUrl(tx, videoUrl); err != nil {
+			return stepError("Failed to create video episodes", err)
+		}
+		keep = append(keep, videoUrl.Id)
+	}
+	stale := tx.Where("video_id = ?", videoId)
+	if len(keep) > 0 {
+		stale = stale.Where("id NOT IN ?", keep)
+	}
+	var staleUrls []model.VideoUrl
+	if err := stale.Find(&staleUrls).Error; err != nil {
+		return stepError("Failed to query old video urls", err)
+	}
+	if len(staleUrls) == 0 {
+		return nil
+	}
+	staleIds := make([]int64, 0, len(staleUrls))
+	for _, videoUrl := range staleUrls {
+		staleIds = append(staleIds, videoUrl.Id)
+	}
+	if err := tx.Unscoped().Where("video_url_id IN ?", staleIds).Delete(&model.VideoEpisode{}).Error; err != nil {
+		return stepError("Failed to delete old video episodes", err)
+	}
+	if err := tx.Where("id IN ?", staleIds).Delete(&model.VideoUrl{}).Error; err != nil {
+		return stepError("Failed to delete old video urls", err)
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"video/model"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestUpdateDecode(t *testing.T) {
+	var req Update
+	body := `{"Id":3,"Title":"新标题","Describe":"","Category":[],"VideoUrlArr":[{"ProxyName":"a","Proxy":"p","Url":"u"}]}`
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	if err := req.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	columns := req.columns()
+	if len(columns) != 3 || columns["title"] != "新标题" || columns["search_title"] != "新标题" || columns["describe"] != "" {
+		t.Errorf("expected only present fields updated, got %v", columns)
+	}
+	if req.Category == nil || len(req.Category) != 0 {
+		t.Errorf("expected empty category list to clear categories, got %v", req.Category)
+	}
+
+	alias := " 新標題 "
+	if columns = (&Update{Alias: &alias}).columns(); columns["alias"] != alias || columns["search_alias"] != "新标题" {
+		t.Errorf("expected simplified search alias, got %v", columns)
+	}
+
+	var partial Update
+	json.Unmarshal([]byte(`{"Id":3,"Cover":"c.jpg"}`), &partial)
+	if partial.Category != nil || partial.VideoUrlArr != nil || partial.VideoGroup != nil {
+		t.Errorf("expected absent relations untouched, got %+v", partial)
+	}
+}
+
+func TestUpdateValidate(t *testing.T) {
+	empty := ""
+	cases := map[string]Update{
+		"missing id":       {},
+		"empty title":      {Id: 1, Title: &empty},
+		"url without link": {Id: 1, VideoUrlArr: []model.VideoUrl{{ProxyName: "a", Proxy: "p"}}},
+	}
+	for name, req := range cases {
+		if err := req.Validate(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+	// 没有解析线路的来源直接播放 Url
+	direct := Update{Id: 1, VideoUrlArr: []model.VideoUrl{{ProxyName: "a", Url: "第1集$https://a.com/1.m3u8"}}}
+	if err := direct.Validate(); err != nil {
+		t.Errorf("url without proxy: %v", err)
+	}
+}
+
+// fakeDB database/sql 驱动的替身，gorm 使用 MySQL 方言生成 SQL：查询由 query 返回结果，其它语句只记录，
+// INSERT 按自增 id 返回 LastInsertId
+type fakeDB struct {
+	query  func(sql string, args []any) ([]string, [][]driver.Value)
+	execs  []fakeStmt
+	nextId int64
+}
+
+type fakeStmt struct {
+	SQL  string
+	Args []any
+}
+
+func (that *fakeDB) Connect(ctx context.Context) (driver.Conn, error) {
+	return &fakeConn{db: that}, nil
+}
+func (that *fakeDB) Driver() driver.Driver { return nil }
+
+// open 返回使用 fakeDB 的 gorm 连接
+func (that *fakeDB) open(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sql.OpenDB(that), SkipInitializeWithVersion: true}),
+		&gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// find 返回第一条匹配 pattern 的语句
+func (that *fakeDB) find(t *testing.T, pattern string) fakeStmt {
+	t.Helper()
+	re := regexp.MustCompile(pattern)
+	for _, stmt := range that.execs {
+		if re.MatchString(stmt.SQL) {
+			return stmt
+		}
+	}
+	var executed []string
+	for _, stmt := range that.execs {
+		executed = append(executed, stmt.SQL)
+	}
+	t.Fatalf("no statement matches %q, executed:\n%s", pattern, strings.Join(executed, "\n"))
+	return fakeStmt{}
+}
+
+func (that *fakeDB) count(pattern string) (n int) {
+	re := regexp.MustCompile(pattern)
+	for _, stmt := range that.execs {
+		if re.MatchString(stmt.SQL) {
+			n++
+		}
+	}
+	return
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (that *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+func (that *fakeConn) Close() error              { return nil }
+func (that *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+func namedArgs(args []driver.NamedValue) []any {
+	values := make([]any, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
+
+func (that *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	that.db.execs = append(that.db.execs, fakeStmt{SQL: query, Args: namedArgs(args)})
+	if !strings.HasPrefix(query, "INSERT") {
+		return driver.RowsAffected(1), nil
+	}
+	rows := int64(strings.Count(query, "),(") + 1)
+	first := that.db.nextId + 1
+	that.db.nextId += rows
+	return fakeResult{lastId: first, affected: rows}, nil
+}
+
+func (that *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	columns, rows := []string{"id"}, [][]driver.Value(nil)
+	if that.db.query != nil {
+		if c, r := that.db.query(query, namedArgs(args)); c != nil {
+			columns, rows = c, r
+		}
+	}
+	return &fakeRows{columns: columns, rows: rows}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeResult struct{ lastId, affected int64 }
+
+func (that fakeResult) LastInsertId() (int64, error) { return that.lastId, nil }
+func (that fakeResult) RowsAffected() (int64, error) { return that.affected, nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (that *fakeRows) Columns() []string { return that.columns }
+func (that *fakeRows) Close() error      { return nil }
+func (that *fakeRows) Next(dest []driver.Value) error {
+	if len(that.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, that.rows[0])
+	that.rows = that.rows[1:]
+	return nil
+}
+
+// updateFixture 视频 1 已关联分类 10、11，与分类 12 的关联已软删除；已有线路 a(id 5) 和 old(id 7)
+func updateFixture() *fakeDB {
+	deletedAt := time.Now()
+	categories := map[string]int64{"演员": 100, "甲": 10, "乙": 12}
+	return &fakeDB{nextId: 1000, query: func(query string, args []any) ([]string, [][]driver.Value) {
+		switch {
+		case strings.Contains(query, "FROM `video` WHERE id = ?"):
+			return []string{"id", "title", "type_id", "type_pid"}, [][]driver.Value{{int64(1), "旧标题", int64(3), int64(2)}}
+		case strings.Contains(query, "FROM `category` WHERE search_name = ?"):
+			if id, ok := categories[args[0].(string)]; ok {
+				return []string{"id", "name"}, [][]driver.Value{{id, args[0]}}
+			}
+		case strings.Contains(query, "FROM `video_category` WHERE video_id = ?"):
+			rows := [][]driver.Value{{int64(1), int64(1), int64(10), nil}, {int64(2), int64(1), int64(11), nil}}
+			if !strings.Contains(query, "`deleted_at` IS NULL") {
+				rows = append(rows, []driver.Value{int64(3), int64(1), int64(12), deletedAt})
+			}
+			return []string{"id", "video_id", "category_id", "deleted_at"}, rows
+		case strings.Contains(query, "FROM `video_url` WHERE video_id = ? AND proxy_name = ?"):
+			if args[1] == "a" {
+				return []string{"id", "video_id", "proxy_name"}, [][]driver.Value{{int64(5), int64(1), "a"}}
+			}
+		case strings.Contains(query, "FROM `video_url` WHERE video_id = ?"):
+			// 只有 id 不在保留列表中时才返回旧线路 old
+			if strings.Contains(query, "id IN") && (!strings.Contains(query, "NOT IN") || slices.Contains(args, any(int64(7)))) {
+				return nil, nil
+			}
+			return []string{"id", "video_id", "proxy_name"}, [][]driver.Value{{int64(7), int64(1), "old"}}
+		}
+		return nil, nil
+	}}
+}
+
+func TestUpdateResync(t *testing.T) {
+	fake := updateFixture()
+	title := "新标题"
+	req := &Update{
+		Id:    1,
+		Title: &title,
+		Category: []*model.Category{
+			{Name: "演员", Category: []model.Category{{Name: "甲,乙,丙"}}},
+		},
+		VideoUrlArr: []model.VideoUrl{
+			{ProxyName: "a", Url: "第1集$https://a.com/1.m3u8"},
+			{ProxyName: "b", Url: "第1集$https://b.com/1.m3u8#第2集$https://b.com/2.m3u8"},
+		},
+	}
+	video, categoryIds, err := New(fake.open(t)).Update(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.Id != 1 {
+		t.Errorf("video = %+v", video)
+	}
+
+	if stmt := fake.find(t, "^UPDATE `video` SET .*`title`=?"); !slices.Contains(stmt.Args, any("新标题")) {
+		t.Errorf("update video args = %v", stmt.Args)
+	}
+	// 新的分类 丙 创建后关联，已软删除的 乙 恢复关联，请求中没有的 11 删除关联
+	created := fake.find(t, "^INSERT INTO `category`")
+	newId := int64(1001)
+	if !slices.Contains(created.Args, any("丙")) || !reflect.DeepEqual(categoryIds, []int64{10, 12, newId}) {
+		t.Fatalf("category ids = %v, insert = %v", categoryIds, created.Args)
+	}
+	if stmt := fake.find(t, "^INSERT INTO `video_category`"); !slices.Contains(stmt.Args, any(newId)) || fake.count("^INSERT INTO `video_category`") != 1 {
+		t.Errorf("insert video_category args = %v", stmt.Args)
+	}
+	if stmt := fake.find(t, "^UPDATE `video_category` SET `deleted_at`=?"); !reflect.DeepEqual(stmt.Args, []any{nil, int64(3)}) {
+		t.Errorf("restore video_category args = %v", stmt.Args)
+	}
+	if stmt := fake.find(t, "^DELETE FROM `video_category`"); !reflect.DeepEqual(stmt.Args, []any{int64(2)}) {
+		t.Errorf("delete video_category args = %v", stmt.Args)
+	}
+	// 新增和恢复的关联视频数加 1，删除的减 1，已软删除的关联不重复减
+	if stmt := fake.find(t, "^UPDATE `category` SET `video_count`=video_count \\+ \\?"); !reflect.DeepEqual(stmt.Args, []any{int64(1), int64(12), newId}) {
+		t.Errorf("increase video_count args = %v", stmt.Args)
+	}
+	if stmt := fake.find(t, "^UPDATE `category` SET `video_count`=GREATEST"); !reflect.DeepEqual(stmt.Args, []any{int64(1), int64(11)}) {
+		t.Errorf("decrease video_count args = %v", stmt.Args)
+	}
+
+	// 线路 a 原地修改，b 新增，old 连同分集删除
+	if stmt := fake.find(t, "^UPDATE `video_url` SET .*WHERE id = \\?"); stmt.Args[len(stmt.Args)-1] != int64(5) {
+		t.Errorf("update video_url args = %v", stmt.Args)
+	}
+	if stmt := fake.find(t, "^INSERT INTO `video_url`"); !slices.Contains(stmt.Args, any("b")) {
+		t.Errorf("insert video_url args = %v", stmt.Args)
+	}
+	if stmt := fake.find(t, "^DELETE FROM `video_episode` WHERE video_url_id IN"); !reflect.DeepEqual(stmt.Args, []any{int64(7)}) {
+		t.Errorf("delete episodes args = %v", stmt.Args)
+	}
+	if stmt := fake.find(t, "^UPDATE `video_url` SET `deleted_at`=\\? WHERE id IN"); stmt.Args[1] != int64(7) {
+		t.Errorf("delete video_url args = %v", stmt.Args)
+	}
+	if n := fake.count("^INSERT INTO `video_episode`"); n != 2 {
+		t.Errorf("expected episodes inserted for both urls, got %d", n)
+	}
+	fake.find(t, "^INSERT INTO `outbox`")
+}
+
+func TestUpdateKeepsCategories(t *testing.T) {
+	fake := updateFixture()
+	cover := "c.jpg"
+	// 不传 Category 时保留已有关联，传空的 VideoUrlArr 时删除全部线路
+	_, categoryIds, err := New(fake.open(t)).Update(context.Background(), &Update{Id: 1, Cover: &cover, VideoUrlArr: []model.VideoUrl{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(categoryIds, []int64{10, 11}) {
+		t.Errorf("category ids = %v", categoryIds)
+	}
+	if n := fake.count("`video_category`|`video_count`"); n != 0 {
+		t.Errorf("expected categories untouched, got %d statements", n)
+	}
+	if stmt := fake.find(t, "^UPDATE `video_url` SET `deleted_at`=\\? WHERE id IN"); stmt.Args[1] != int64(7) {
+		t.Errorf("delete video_url args = %v", stmt.Args)
+	}
+}
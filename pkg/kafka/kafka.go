@@ -4,34 +4,45 @@ import (
 	"context"
 	"errors"
 	"log"
+	"video/config"
 	"video/core"
 
 	"github.com/IBM/sarama"
 )
 
-func ConsumerInit(ctx context.Context, consumer sarama.ConsumerGroupHandler) (err error) {
-	configGlobal := core.New().ConfigGlobal
+func newConfig(cfg config.Kafka) *sarama.Config {
 	config := sarama.NewConfig()
+	config.Net.SASL.Enable = true
+	config.Net.SASL.User = cfg.User
+	config.Net.SASL.Password = cfg.Password
+	config.Net.SASL.Mechanism = sarama.SASLTypePlaintext // 或 sarama.SASLTypeSCRAMSHA256, sarama.SASLTypeSCRAMSHA512
+	return config
+}
+
+// ConsumerInit 启动消费者组，ctx 取消后等待正在处理的消息完成并关闭消费者组，随后关闭 done
+func ConsumerInit(ctx context.Context, consumer sarama.ConsumerGroupHandler) (done <-chan struct{}, err error) {
+	configGlobal := core.New().ConfigGlobal
+	config := newConfig(configGlobal.Kafka)
 
 	config.Consumer.Offsets.Initial = sarama.OffsetOldest
 	config.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRoundRobin
+	// 位点由消费者在消息处理完成后手动提交
+	config.Consumer.Offsets.AutoCommit.Enable = false
 
-	config.Net.SASL.Enable = true
-	config.Net.SASL.User = configGlobal.Kafka.User
-	config.Net.SASL.Password = configGlobal.Kafka.Password
-	config.Net.SASL.Mechanism = sarama.SASLTypePlaintext // 或 sarama.SASLTypeSCRAMSHA256, sarama.SASLTypeSCRAMSHA512
 	consumerGroup, err := sarama.NewConsumerGroup(configGlobal.Kafka.Brokers, configGlobal.Kafka.GroupId, config)
 	if err != nil {
-		log.Fatalf("Failed to create consumer group: %v", err)
+		return
 	}
+	closed := make(chan struct{})
 	go func() {
+		defer close(closed)
 		defer func() {
 			if err := consumerGroup.Close(); err != nil {
 				log.Println("Failed to close consumer group:", err)
 			}
 		}()
 		for {
-			// `Consume` 应该在一个循环中调用
+			// `Consume` 应该在一个循环中调用，所有 ConsumeClaim 返回后才会返回
 			if err := consumerGroup.Consume(ctx, []string{configGlobal.Kafka.Topic}, consumer); err != nil {
 				if errors.Is(err, sarama.ErrClosedConsumerGroup) { // 正常关闭
 					log.Printf("正常关闭")
@@ -46,5 +57,14 @@ func ConsumerInit(ctx context.Context, consumer sarama.ConsumerGroupHandler) (er
 		}
 	}()
 
-	return
+	return closed, nil
+}
+
+// ProducerInit 创建同步生产者，用于发送死信
+func ProducerInit() (sarama.SyncProducer, error) {
+	configGlobal := core.New().ConfigGlobal
+	config := newConfig(configGlobal.Kafka)
+	config.Producer.Return.Successes = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	return sarama.NewSyncProducer(configGlobal.Kafka.Brokers, config)
 }
@@ -0,0 +1,175 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"video/config"
+	"video/model"
+	"video/pkg/ingest"
+
+	"github.com/IBM/sarama"
+)
+
+// 死信消息附带的 header
+const (
+	HeaderError             = "x-error"
+	HeaderAttempts          = "x-attempts"
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+)
+
+// IngestFunc 写入一个视频，默认为 ingest.Service.Ingest
+type IngestFunc func(ctx context.Context, video *model.Video) (ingest.Result, error)
+
+// Pipeline 消费视频消息并入库，实现 sarama.ConsumerGroupHandler。
+// 入库事务成功或消息转入死信后才提交位点；可重试的失败按指数退避重试，重试耗尽或不可重试时转发到死信 topic。
+type Pipeline struct {
+	Ingest          IngestFunc
+	DeadLetter      sarama.SyncProducer
+	DeadLetterTopic string
+	MaxRetries      int
+	Backoff         time.Duration
+	MaxBackoff      time.Duration
+}
+
+func NewPipeline(cfg config.Kafka, service *ingest.Service, deadLetter sarama.SyncProducer) *Pipeline {
+	pipeline := &Pipeline{
+		Ingest:          service.Ingest,
+		DeadLetter:      deadLetter,
+		DeadLetterTopic: cfg.DeadLetterTopic,
+		MaxRetries:      cfg.MaxRetries,
+		Backoff:         time.Duration(cfg.RetryBackoff) * time.Millisecond,
+		MaxBackoff:      time.Duration(cfg.MaxRetryBackoff) * time.Millisecond,
+	}
+	if pipeline.MaxRetries <= 0 {
+		pipeline.MaxRetries = 3
+	}
+	if pipeline.Backoff <= 0 {
+		pipeline.Backoff = 500 * time.Millisecond
+	}
+	if pipeline.MaxBackoff <= 0 {
+		pipeline.MaxBackoff = 30 * time.Second
+	}
+	return pipeline
+}
+
+// Decode 解析消息，格式与 /api/v1/video/create 的请求体相同
+func Decode(value []byte) (*model.Video, error) {
+	var video model.Video
+	if err := json.Unmarshal(value, &video); err != nil {
+		return nil, fmt.Errorf("消息格式错误: %w", err)
+	}
+	if video.Title == "" {
+		return nil, errors.New("消息缺少 Title")
+	}
+	return &video, nil
+}
+
+// Setup is run at the beginning of a new session, before ConsumeClaim
+func (that *Pipeline) Setup(session sarama.ConsumerGroupSession) error {
+	log.Printf("kafka session setup: member=%s generation=%d", session.MemberID(), session.GenerationID())
+	return nil
+}
+
+// Cleanup is run at the end of a session, once all ConsumeClaim goroutines have exited
+func (that *Pipeline) Cleanup(sarama.ConsumerGroupSession) error {
+	log.Println("kafka session cleanup")
+	return nil
+}
+
+// ConsumeClaim must start a consumer loop of ConsumerGroupClaim's Messages().
+func (that *Pipeline) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	// NOTE:
+	// Do not move the code below to a goroutine.
+	// The `ConsumeClaim` itself is called within a goroutine, see:
+	// https://github.com/IBM/sarama/blob/main/consumer_group.go#L27-L29
+	ctx := session.Context()
+	for {
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				log.Printf("message channel was closed")
+				return nil
+			}
+			if err := that.handle(ctx, message); err != nil {
+				// 未处理完成的消息不提交位点，重新分配分区后从该消息继续消费
+				if ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
+			session.MarkMessage(message, "")
+			session.Commit()
+		case <-ctx.Done(): // 如果 session context 被取消，则退出循环
+			return nil
+		}
+	}
+}
+
+// handle 处理一条消息，返回 nil 表示已入库或已转入死信，可以提交位点
+func (that *Pipeline) handle(ctx context.Context, message *sarama.ConsumerMessage) error {
+	backoff := that.Backoff
+	for attempt := 1; ; attempt++ {
+		// 每次重试重新解析，失败的事务可能已改写 video 的 Id 等字段
+		video, err := Decode(message.Value)
+		if err != nil {
+			return that.deadLetter(message, err, attempt)
+		}
+		// 事务不随会话取消中断，关闭时等待当前消息入库完成
+		if _, err = that.Ingest(context.WithoutCancel(ctx), video); err == nil {
+			return nil
+		}
+		// 数据不合法时重试也不会成功，直接转入死信
+		if attempt > that.MaxRetries || !ingest.Retryable(err) {
+			return that.deadLetter(message, err, attempt)
+		}
+		log.Printf("入库失败 %s/%d/%d 第 %d 次，%s 后重试: %v", message.Topic, message.Partition, message.Offset, attempt, backoff, err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		backoff = min(backoff*2, that.MaxBackoff)
+	}
+}
+
+// deadLetter 把消息连同错误原因转发到死信 topic，未配置时只记录日志
+func (that *Pipeline) deadLetter(message *sarama.ConsumerMessage, cause error, attempts int) error {
+	log.Printf("消息 %s/%d/%d 转入死信: %v", message.Topic, message.Partition, message.Offset, cause)
+	if that.DeadLetter == nil || that.DeadLetterTopic == "" {
+		log.Printf("未配置死信 topic，丢弃消息: %s", string(message.Value))
+		return nil
+	}
+	headers := make([]sarama.RecordHeader, 0, len(message.Headers)+5)
+	for _, header := range message.Headers {
+		headers = append(headers, *header)
+	}
+	headers = append(headers,
+		sarama.RecordHeader{Key: []byte(HeaderError), Value: []byte(cause.Error())},
+		sarama.RecordHeader{Key: []byte(HeaderAttempts), Value: []byte(strconv.Itoa(attempts))},
+		sarama.RecordHeader{Key: []byte(HeaderOriginalTopic), Value: []byte(message.Topic)},
+		sarama.RecordHeader{Key: []byte(HeaderOriginalPartition), Value: []byte(strconv.Itoa(int(message.Partition)))},
+		sarama.RecordHeader{Key: []byte(HeaderOriginalOffset), Value: []byte(strconv.FormatInt(message.Offset, 10))},
+	)
+	producerMessage := &sarama.ProducerMessage{
+		Topic:   that.DeadLetterTopic,
+		Value:   sarama.ByteEncoder(message.Value),
+		Headers: headers,
+	}
+	if message.Key != nil {
+		producerMessage.Key = sarama.ByteEncoder(message.Key)
+	}
+	if _, _, err := that.DeadLetter.SendMessage(producerMessage); err != nil {
+		return fmt.Errorf("发送死信失败: %w", err)
+	}
+	return nil
+}
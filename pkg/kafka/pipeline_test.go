@@ -0,0 +1,158 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"video/model"
+	"video/pkg/ingest"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+)
+
+type fakeSession struct {
+	ctx     context.Context
+	mu      sync.Mutex
+	marked  []int64
+	commits int
+}
+
+func (that *fakeSession) Claims() map[string][]int32 { return nil }
+func (that *fakeSession) MemberID() string           { return "test" }
+func (that *fakeSession) GenerationID() int32        { return 1 }
+func (that *fakeSession) MarkOffset(string, int32, int64, string) {
+}
+func (that *fakeSession) ResetOffset(string, int32, int64, string) {
+}
+func (that *fakeSession) Commit() {
+	that.mu.Lock()
+	defer that.mu.Unlock()
+	that.commits++
+}
+func (that *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	that.mu.Lock()
+	defer that.mu.Unlock()
+	that.marked = append(that.marked, msg.Offset)
+}
+func (that *fakeSession) Context() context.Context { return that.ctx }
+
+type fakeClaim struct {
+	messages chan *sarama.ConsumerMessage
+}
+
+func (that *fakeClaim) Topic() string                            { return "video" }
+func (that *fakeClaim) Partition() int32                         { return 0 }
+func (that *fakeClaim) InitialOffset() int64                     { return 0 }
+func (that *fakeClaim) HighWaterMarkOffset() int64               { return 0 }
+func (that *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return that.messages }
+
+func newClaim(values ...string) *fakeClaim {
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, len(values))}
+	for i, value := range values {
+		claim.messages <- &sarama.ConsumerMessage{Topic: "video", Offset: int64(i), Value: []byte(value)}
+	}
+	close(claim.messages)
+	return claim
+}
+
+func TestPipelineRetryAndDeadLetter(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	var deadLetters []*sarama.ProducerMessage
+	for i := 0; i < 3; i++ {
+		producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+			deadLetters = append(deadLetters, msg)
+			return nil
+		})
+	}
+	defer producer.Close()
+
+	calls := map[string]int{}
+	pipeline := &Pipeline{
+		Ingest: func(ctx context.Context, video *model.Video) (ingest.Result, error) {
+			calls[video.Title]++
+			switch {
+			case video.Title == "flaky" && calls[video.Title] < 3:
+				return ingest.Result{}, errors.New("deadlock")
+			case video.Title == "broken":
+				return ingest.Result{}, errors.New("constraint failed")
+			case video.Title == "invalid":
+				return ingest.Result{}, model.NewValidationError("VideoUrl requires Url")
+			}
+			return ingest.Result{VideoId: 1}, nil
+		},
+		DeadLetter:      producer,
+		DeadLetterTopic: "video-dlq",
+		MaxRetries:      3,
+		Backoff:         time.Millisecond,
+		MaxBackoff:      2 * time.Millisecond,
+	}
+	session := &fakeSession{ctx: context.Background()}
+	claim := newClaim(`{"Title":"ok"}`, `not json`, `{"Title":"flaky"}`, `{"Title":"broken"}`, `{"Title":"invalid"}`)
+	if err := pipeline.ConsumeClaim(session, claim); err != nil {
+		t.Fatal(err)
+	}
+	if len(session.marked) != 5 || session.commits != 5 {
+		t.Fatalf("expected every message committed, marked=%v commits=%d", session.marked, session.commits)
+	}
+	if calls["ok"] != 1 || calls["flaky"] != 3 || calls["broken"] != 4 || calls["invalid"] != 1 {
+		t.Fatalf("unexpected ingest calls: %v", calls)
+	}
+	if len(deadLetters) != 3 {
+		t.Fatalf("expected 3 dead letters, got %d", len(deadLetters))
+	}
+	headers := map[string]string{}
+	for _, header := range deadLetters[1].Headers {
+		headers[string(header.Key)] = string(header.Value)
+	}
+	if deadLetters[1].Topic != "video-dlq" || headers[HeaderError] != "constraint failed" ||
+		headers[HeaderAttempts] != "4" || headers[HeaderOriginalOffset] != "3" {
+		t.Fatalf("unexpected dead letter: topic=%s headers=%v", deadLetters[1].Topic, headers)
+	}
+}
+
+func TestPipelineShutdownDoesNotCommit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	pipeline := &Pipeline{
+		Ingest: func(ctx context.Context, video *model.Video) (ingest.Result, error) {
+			cancel()
+			return ingest.Result{}, errors.New("db down")
+		},
+		MaxRetries: 3,
+		Backoff:    time.Hour,
+		MaxBackoff: time.Hour,
+	}
+	session := &fakeSession{ctx: ctx}
+	done := make(chan error)
+	go func() {
+		done <- pipeline.ConsumeClaim(session, newClaim(`{"Title":"a"}`))
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("consumer did not stop on shutdown")
+	}
+	if len(session.marked) != 0 {
+		t.Fatalf("expected unfinished message not committed, marked=%v", session.marked)
+	}
+}
+
+func TestPipelineDeadLetterFailure(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+	defer producer.Close()
+	pipeline := &Pipeline{DeadLetter: producer, DeadLetterTopic: "video-dlq"}
+	session := &fakeSession{ctx: context.Background()}
+	if err := pipeline.ConsumeClaim(session, newClaim(`{}`)); err == nil {
+		t.Fatal("expected error when dead letter cannot be sent")
+	}
+	if len(session.marked) != 0 {
+		t.Fatalf("expected message not committed, marked=%v", session.marked)
+	}
+}
@@ -0,0 +1,32 @@
+package kafka
+
+import (
+	"context"
+
+	"video/pkg/event"
+
+	"github.com/IBM/sarama"
+)
+
+// Producer 把事件发布到 kafka，实现 event.Broker
+type Producer struct {
+	Producer sarama.SyncProducer
+}
+
+func NewProducer(producer sarama.SyncProducer) *Producer {
+	return &Producer{Producer: producer}
+}
+
+func (that *Producer) Publish(ctx context.Context, message event.Message) error {
+	headers := make([]sarama.RecordHeader, 0, len(message.Headers))
+	for key, value := range message.Headers {
+		headers = append(headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+	}
+	_, _, err := that.Producer.SendMessage(&sarama.ProducerMessage{
+		Topic:   message.Topic,
+		Key:     sarama.StringEncoder(message.Key),
+		Value:   sarama.ByteEncoder(message.Value),
+		Headers: headers,
+	})
+	return err
+}
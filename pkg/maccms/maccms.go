@@ -0,0 +1,119 @@
+package maccms
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/108.0.0.0 Safari/537.36"
+
+// ListResponse 对应 maccms ac=list / ac=detail 接口的响应
+type ListResponse struct {
+	Code      int       `json:"code"`
+	Msg       string    `json:"msg"`
+	PageCount int       `json:"pagecount"`
+	Total     int       `json:"total"`
+	List      []VodInfo `json:"list"`
+}
+
+// VodInfo 对应 maccms 返回的原始视频数据
+type VodInfo struct {
+	VodID       int64  `json:"vod_id"`
+	VodName     string `json:"vod_name"`
+	VodSub      string `json:"vod_sub"`
+	TypeID      int64  `json:"type_id"`
+	TypeName    string `json:"type_name"`
+	TypeID1     int64  `json:"type_id_1"`
+	VodPic      string `json:"vod_pic"`
+	VodPlayFrom string `json:"vod_play_from"`
+	VodPlayURL  string `json:"vod_play_url"`
+	VodContent  string `json:"vod_content"`
+	VodBlurb    string `json:"vod_blurb"`
+	VodRemarks  string `json:"vod_remarks"`
+	VodYear     string `json:"vod_year"`
+	VodArea     string `json:"vod_area"`
+	VodLang     string `json:"vod_lang"`
+	VodActor    string `json:"vod_actor"`
+	VodDirector string `json:"vod_director"`
+	VodTag      string `json:"vod_tag"`
+	VodClass    string `json:"vod_class"`
+	VodTime     string `json:"vod_time"`
+}
+
+// Client maccms 资源站接口客户端
+type Client struct {
+	BaseUrl    string
+	HttpClient *http.Client
+}
+
+func NewClient(baseUrl string) *Client {
+	return &Client{
+		BaseUrl:    baseUrl,
+		HttpClient: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// List 获取指定页码的视频列表(ac=list)，hours > 0 时只返回最近 hours 小时内更新的视频(h=hours)
+func (that *Client) List(ctx context.Context, page int, hours int) (res ListResponse, err error) {
+	query := url.Values{}
+	query.Set("ac", "list")
+	query.Set("pg", strconv.Itoa(page))
+	if hours > 0 {
+		query.Set("h", strconv.Itoa(hours))
+	}
+	err = that.get(ctx, query, &res)
+	return
+}
+
+// Detail 批量获取视频详情(ac=detail&ids=1,2,3)
+func (that *Client) Detail(ctx context.Context, ids []int64) (res ListResponse, err error) {
+	if len(ids) == 0 {
+		return
+	}
+	idArr := make([]string, 0, len(ids))
+	for _, id := range ids {
+		idArr = append(idArr, strconv.FormatInt(id, 10))
+	}
+	query := url.Values{}
+	query.Set("ac", "detail")
+	query.Set("ids", strings.Join(idArr, ","))
+	err = that.get(ctx, query, &res)
+	return
+}
+
+func (that *Client) get(ctx context.Context, query url.Values, res *ListResponse) (err error) {
+	reqUrl := that.BaseUrl
+	if strings.Contains(reqUrl, "?") {
+		reqUrl += "&" + query.Encode()
+	} else {
+		reqUrl += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqUrl, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := that.HttpClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("maccms 返回错误状态码: %d", resp.StatusCode)
+	}
+	if err = json.Unmarshal(body, res); err != nil {
+		return fmt.Errorf("maccms JSON解析失败: %w", err)
+	}
+	return
+}
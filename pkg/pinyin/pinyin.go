@@ -0,0 +1,104 @@
+// Package pinyin 汉字转拼音，用于拼音全拼和首字母搜索。
+//
+// pinyin.txt 每行为一个不带声调的拼音及其对应的汉字，覆盖 U+4E00 - U+9FFF，ü 写作 v。
+// 由 ICU 的 Han-Latin 转换逐字生成(uconv -x Han-Latin)，多音字只取一个读音。
+package pinyin
+
+import (
+	_ "embed"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+//go:embed pinyin.txt
+var data string
+
+// overrides 逐字转换时取到的读音在片名中不常用的多音字
+var overrides = map[rune]string{
+	'长': "chang",
+	'都': "du",
+	'地': "di",
+	'似': "si",
+	'厦': "xia",
+}
+
+var loadTable = sync.OnceValue(func() map[rune]string {
+	table := make(map[rune]string, 21000)
+	for _, line := range strings.Split(data, "\n") {
+		syllable, chars, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		for _, r := range chars {
+			table[r] = syllable
+		}
+	}
+	for r, syllable := range overrides {
+		table[r] = syllable
+	}
+	return table
+})
+
+// Convert 返回 s 的全拼和首字母。汉字转为拼音，字母、数字转为小写保留，其它字符忽略，
+// 如 "西游记2" 返回 "xiyouji2" 和 "xyj2"；hasHan 表示是否包含可转换的汉字
+func Convert(s string) (full string, initials string, hasHan bool) {
+	table := loadTable()
+	var fullBuilder, initialsBuilder strings.Builder
+	for _, r := range s {
+		if syllable, ok := table[r]; ok {
+			fullBuilder.WriteString(syllable)
+			initialsBuilder.WriteByte(syllable[0])
+			hasHan = true
+			continue
+		}
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			r = unicode.ToLower(r)
+			fullBuilder.WriteRune(r)
+			initialsBuilder.WriteRune(r)
+		}
+	}
+	return fullBuilder.String(), initialsBuilder.String(), hasHan
+}
+
+// Keywords 生成 texts 的全拼和首字母，去重后以空格分隔；不含汉字的文本已能按原文搜索，跳过
+func Keywords(texts ...string) string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, text := range texts {
+		full, initials, hasHan := Convert(text)
+		if !hasHan {
+			continue
+		}
+		for _, token := range []string{full, initials} {
+			if !seen[token] {
+				seen[token] = true
+				out = append(out, token)
+			}
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// Normalize 把用户输入的拼音转为 Keywords 中的形式：小写、去掉空格和隔音符号，如 "Liu De'hua" 返回 "liudehua"；
+// 含有其它字符、没有字母或少于 2 个字符时不是拼音，返回空
+func Normalize(kw string) string {
+	var b strings.Builder
+	letters := 0
+	for _, r := range kw {
+		switch {
+		case r < unicode.MaxASCII && unicode.IsLetter(r):
+			letters++
+			b.WriteRune(unicode.ToLower(r))
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ' || r == '\'':
+		default:
+			return ""
+		}
+	}
+	if letters == 0 || b.Len() < 2 {
+		return ""
+	}
+	return b.String()
+}
@@ -0,0 +1,51 @@
+package pinyin
+
+import "testing"
+
+func TestConvert(t *testing.T) {
+	cases := []struct {
+		s, full, initials string
+		hasHan            bool
+	}{
+		{"刘德华", "liudehua", "ldh", true},
+		{"西游记2", "xiyouji2", "xyj2", true},
+		{"长安十二时辰", "changanshiershichen", "casesc", true},
+		{"绿皮书", "lvpishu", "lps", true},
+		{"三体：第二部", "santidierbu", "stdeb", true},
+		{"The Matrix", "thematrix", "thematrix", false},
+	}
+	for _, c := range cases {
+		full, initials, hasHan := Convert(c.s)
+		if full != c.full || initials != c.initials || hasHan != c.hasHan {
+			t.Errorf("Convert(%q) = %q, %q, %v", c.s, full, initials, hasHan)
+		}
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	if got := Keywords("西游记", "Journey to the West", "西游记", "周星驰"); got != "xiyouji xyj zhouxingchi zxc" {
+		t.Errorf("Keywords = %q", got)
+	}
+	if got := Keywords("Matrix", ""); got != "" {
+		t.Errorf("Keywords without han = %q", got)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	cases := map[string]string{
+		"LDH":         "ldh",
+		"liu de hua":  "liudehua",
+		"Xi'an":       "xian",
+		"xyj2":        "xyj2",
+		"a":           "",
+		"2046":        "",
+		"刘德华":         "",
+		"spider-man":  "",
+		"  x  y  j  ": "xyj",
+	}
+	for kw, want := range cases {
+		if got := Normalize(kw); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", kw, got, want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package playurl
+
+import (
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatM3u8 = "m3u8"
+	FormatMp4  = "mp4"
+	FormatFlv  = "flv"
+	FormatWeb  = "web" // 解析/分享页面，需要 iframe 或代理播放
+)
+
+// Episode maccms 播放串中的一集
+type Episode struct {
+	Line   string // 播放线路，取自 vod_play_from，缺失时为 线路N
+	Name   string // 集名，如 第01集、HD中字
+	Sort   int    // 同一线路内的顺序，从 0 开始
+	Url    string
+	Format string
+}
+
+// Parse 解析 maccms 播放串：线路之间用 $$$ 分隔，集之间用 # 分隔，集名与地址用 $ 分隔。
+// playFrom 为对应的 vod_play_from(同样用 $$$ 分隔)，可为空。
+func Parse(playFrom, playUrl string) (episodes []Episode) {
+	playUrl = strings.TrimSpace(playUrl)
+	if playUrl == "" {
+		return
+	}
+	var froms []string
+	if playFrom != "" {
+		froms = strings.Split(playFrom, "$$$")
+	}
+	for lineIndex, group := range strings.Split(playUrl, "$$$") {
+		line := "线路" + strconv.Itoa(lineIndex+1)
+		if lineIndex < len(froms) && strings.TrimSpace(froms[lineIndex]) != "" {
+			line = strings.TrimSpace(froms[lineIndex])
+		}
+		sort := 0
+		for _, entry := range strings.Split(group, "#") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			name, link, found := strings.Cut(entry, "$")
+			if !found {
+				// 只有地址没有集名
+				link, name = name, ""
+			}
+			link = strings.TrimSpace(link)
+			if link == "" {
+				continue
+			}
+			name = strings.TrimSpace(name)
+			if name == "" {
+				name = "第" + strconv.Itoa(sort+1) + "集"
+			}
+			episodes = append(episodes, Episode{
+				Line:   line,
+				Name:   name,
+				Sort:   sort,
+				Url:    link,
+				Format: DetectFormat(link),
+			})
+			sort++
+		}
+	}
+	return
+}
+
+// DetectFormat 根据地址后缀判断播放格式
+func DetectFormat(link string) string {
+	p := link
+	if u, err := url.Parse(link); err == nil {
+		p = u.Path
+	}
+	switch strings.ToLower(path.Ext(p)) {
+	case ".m3u8":
+		return FormatM3u8
+	case ".mp4":
+		return FormatMp4
+	case ".flv":
+		return FormatFlv
+	default:
+		return FormatWeb
+	}
+}
@@ -0,0 +1,33 @@
+package playurl
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	episodes := Parse("dyttm3u8$$$dytt", "第01集$https://a.com/1/index.m3u8#第02集$https://a.com/2/index.m3u8?sign=1$$$第01集$https://share.a.com/play/1#$$$")
+	if len(episodes) != 3 {
+		t.Fatalf("expected 3 episodes, got %d: %+v", len(episodes), episodes)
+	}
+	want := []Episode{
+		{Line: "dyttm3u8", Name: "第01集", Sort: 0, Url: "https://a.com/1/index.m3u8", Format: FormatM3u8},
+		{Line: "dyttm3u8", Name: "第02集", Sort: 1, Url: "https://a.com/2/index.m3u8?sign=1", Format: FormatM3u8},
+		{Line: "dytt", Name: "第01集", Sort: 0, Url: "https://share.a.com/play/1", Format: FormatWeb},
+	}
+	for i := range want {
+		if episodes[i] != want[i] {
+			t.Errorf("episode %d: got %+v, want %+v", i, episodes[i], want[i])
+		}
+	}
+}
+
+func TestParseWithoutPlayFrom(t *testing.T) {
+	episodes := Parse("", "HD$https://a.com/a.mp4$$$https://b.com/b.m3u8")
+	if len(episodes) != 2 {
+		t.Fatalf("expected 2 episodes, got %+v", episodes)
+	}
+	if episodes[0].Line != "线路1" || episodes[0].Format != FormatMp4 {
+		t.Errorf("unexpected first episode: %+v", episodes[0])
+	}
+	if episodes[1].Line != "线路2" || episodes[1].Name != "第1集" || episodes[1].Format != FormatM3u8 {
+		t.Errorf("unexpected second episode: %+v", episodes[1])
+	}
+}
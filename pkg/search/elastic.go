@@ -0,0 +1,584 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"video/config"
+	"video/model"
+	"video/pkg/pinyin"
+	"video/pkg/zhconv"
+)
+
+// Elastic 通过 REST 接口访问 Elasticsearch。读写都经过别名 Alias，
+// Reindex 建好新索引后切换别名，不影响搜索
+type Elastic struct {
+	Addresses  []string
+	Username   string
+	Password   string
+	Alias      string
+	HttpClient *http.Client
+	next       atomic.Uint32
+}
+
+// ElasticError Elasticsearch 返回的错误
+type ElasticError struct {
+	Status int
+	Type   string
+	Reason string
+}
+
+func (e *ElasticError) Error() string {
+	return fmt.Sprintf("elasticsearch 错误，状态码: %d, %s: %s", e.Status, e.Type, e.Reason)
+}
+
+func NewElastic(cfg config.Elastic) *Elastic {
+	index := cfg.Index
+	if index == "" {
+		index = "video"
+	}
+	return &Elastic{
+		Addresses:  cfg.Addresses,
+		Username:   cfg.Username,
+		Password:   cfg.Password,
+		Alias:      index,
+		HttpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// indexBody 索引设置：繁体先转为简体，中日韩文字按二元组和单字切分，英文、拼音按单词切分
+func indexBody(refreshInterval string) map[string]any {
+	text := func(raw bool) map[string]any {
+		field := map[string]any{"type": "text", "analyzer": "cjk_text"}
+		if raw {
+			field["fields"] = map[string]any{"raw": map[string]any{"type": "keyword", "ignore_above": 256, "normalizer": "zh_keyword"}}
+		}
+		return field
+	}
+	return map[string]any{
+		"settings": map[string]any{
+			"refresh_interval": refreshInterval,
+			"analysis": map[string]any{
+				"char_filter": map[string]any{
+					"zh_simplify": map[string]any{"type": "mapping", "mappings": simplifyMappings()},
+				},
+				"normalizer": map[string]any{
+					"zh_keyword": map[string]any{"type": "custom", "char_filter": []string{"zh_simplify"}, "filter": []string{"lowercase"}},
+				},
+				"filter": map[string]any{
+					"cjk_bigram_unigram": map[string]any{"type": "cjk_bigram", "output_unigrams": true},
+				},
+				"analyzer": map[string]any{
+					"cjk_text": map[string]any{
+						"type":        "custom",
+						"char_filter": []string{"zh_simplify"},
+						"tokenizer":   "standard",
+						"filter":      []string{"cjk_width", "lowercase", "cjk_bigram_unigram"},
+					},
+				},
+			},
+		},
+		"mappings": map[string]any{
+			"dynamic": "strict",
+			"properties": map[string]any{
+				"id":           map[string]any{"type": "long"},
+				"title":        text(true),
+				"alias":        text(false),
+				"keywords":     text(false),
+				"describe":     text(false),
+				"actors":       text(true),
+				"directors":    text(true),
+				"pinyin":       map[string]any{"type": "wildcard"},
+				"type_id":      map[string]any{"type": "long"},
+				"type_pid":     map[string]any{"type": "long"},
+				"category_ids": map[string]any{"type": "long"},
+				"years":        map[string]any{"type": "integer"},
+				"browse":       map[string]any{"type": "long"},
+				"created_at":   map[string]any{"type": "date"},
+			},
+		},
+	}
+}
+
+// simplifyMappings 繁体转简体的 mapping char_filter 规则，与 zhconv.Simplify 一致，如 "國=>国"
+func simplifyMappings() []string {
+	table := zhconv.Table()
+	mappings := make([]string, 0, len(table))
+	for traditional, simplified := range table {
+		mappings = append(mappings, string(traditional)+"=>"+string(simplified))
+	}
+	sort.Strings(mappings)
+	return mappings
+}
+
+// do 发送请求，连接失败时依次尝试其它地址；out 不为空时解析响应体
+func (that *Elastic) do(ctx context.Context, method string, path string, body []byte, contentType string, out any) error {
+	if len(that.Addresses) == 0 {
+		return errors.New("未配置 Elastic.Addresses")
+	}
+	start := int(that.next.Add(1))
+	var lastErr error
+	for i := range that.Addresses {
+		address := strings.TrimRight(that.Addresses[(start+i)%len(that.Addresses)], "/")
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, address+path, reader)
+		if err != nil {
+			return err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if that.Username != "" {
+			req.SetBasicAuth(that.Username, that.Password)
+		}
+		resp, err := that.HttpClient.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			lastErr = err
+			continue
+		}
+		return readResponse(resp, out)
+	}
+	return lastErr
+}
+
+func readResponse(resp *http.Response, out any) error {
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		esErr := &ElasticError{Status: resp.StatusCode, Reason: string(data)}
+		var body struct {
+			Error struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(data, &body) == nil && body.Error.Type != "" {
+			esErr.Type, esErr.Reason = body.Error.Type, body.Error.Reason
+		}
+		return esErr
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+func (that *Elastic) doJSON(ctx context.Context, method string, path string, body any, out any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	return that.do(ctx, method, path, data, "application/json", out)
+}
+
+func isNotFound(err error) bool {
+	var esErr *ElasticError
+	return errors.As(err, &esErr) && esErr.Status == http.StatusNotFound
+}
+
+// EnsureIndex 别名不存在时创建索引并指向它，增量索引前调用，避免写入时自动创建没有分词设置的索引
+func (that *Elastic) EnsureIndex(ctx context.Context) error {
+	err := that.do(ctx, http.MethodHead, "/"+that.Alias, nil, "", nil)
+	if !isNotFound(err) {
+		return err
+	}
+	name := that.newIndexName()
+	body := indexBody("1s")
+	body["aliases"] = map[string]any{that.Alias: map[string]any{}}
+	return that.doJSON(ctx, http.MethodPut, "/"+name, body, nil)
+}
+
+func (that *Elastic) newIndexName() string {
+	return that.Alias + "_" + time.Now().Format("20060102150405")
+}
+
+// Reindex 新建索引并写入 load 返回的全部文档，完成后把别名切换到新索引并删除旧索引；
+// load 按 id 升序返回 id 大于 afterId 的文档，返回空时结束
+func (that *Elastic) Reindex(ctx context.Context, batchSize int, load func(afterId int64, limit int) ([]Document, error)) (total int, err error) {
+	name := that.newIndexName()
+	// 写入期间关闭自动刷新，完成后恢复
+	if err = that.doJSON(ctx, http.MethodPut, "/"+name, indexBody("-1"), nil); err != nil {
+		return 0, err
+	}
+	switched := false
+	defer func() {
+		if err != nil && !switched {
+			_ = that.do(context.WithoutCancel(ctx), http.MethodDelete, "/"+name, nil, "", nil)
+		}
+	}()
+	var afterId int64
+	for {
+		docs, err := load(afterId, batchSize)
+		if err != nil {
+			return total, err
+		}
+		if len(docs) == 0 {
+			break
+		}
+		if err = that.bulkIndex(ctx, name, docs); err != nil {
+			return total, err
+		}
+		total += len(docs)
+		afterId = docs[len(docs)-1].Id
+	}
+	settings := map[string]any{"index": map[string]any{"refresh_interval": "1s"}}
+	if err = that.doJSON(ctx, http.MethodPut, "/"+name+"/_settings", settings, nil); err != nil {
+		return total, err
+	}
+	if err = that.do(ctx, http.MethodPost, "/"+name+"/_refresh", nil, "", nil); err != nil {
+		return total, err
+	}
+
+	var aliases map[string]json.RawMessage
+	if err = that.doJSON(ctx, http.MethodGet, "/_alias/"+that.Alias, nil, &aliases); err != nil && !isNotFound(err) {
+		return total, err
+	}
+	actions := []map[string]any{}
+	for old := range aliases {
+		actions = append(actions, map[string]any{"remove": map[string]any{"index": old, "alias": that.Alias}})
+	}
+	actions = append(actions, map[string]any{"add": map[string]any{"index": name, "alias": that.Alias}})
+	if err = that.doJSON(ctx, http.MethodPost, "/_aliases", map[string]any{"actions": actions}, nil); err != nil {
+		return total, err
+	}
+	switched = true
+	for old := range aliases {
+		if err := that.do(ctx, http.MethodDelete, "/"+old, nil, "", nil); err != nil && !isNotFound(err) {
+			return total, fmt.Errorf("别名已切换，删除旧索引 %s 失败: %w", old, err)
+		}
+	}
+	return total, nil
+}
+
+func (that *Elastic) Index(ctx context.Context, docs ...Document) error {
+	return that.bulkIndex(ctx, that.Alias, docs)
+}
+
+func (that *Elastic) bulkIndex(ctx context.Context, index string, docs []Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for i := range docs {
+		action := map[string]any{"index": map[string]any{"_index": index, "_id": strconv.FormatInt(docs[i].Id, 10)}}
+		if err := encoder.Encode(action); err != nil {
+			return err
+		}
+		if err := encoder.Encode(&docs[i]); err != nil {
+			return err
+		}
+	}
+	return that.bulk(ctx, body.Bytes())
+}
+
+func (that *Elastic) Delete(ctx context.Context, ids ...int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, id := range ids {
+		action := map[string]any{"delete": map[string]any{"_index": that.Alias, "_id": strconv.FormatInt(id, 10)}}
+		if err := encoder.Encode(action); err != nil {
+			return err
+		}
+	}
+	return that.bulk(ctx, body.Bytes())
+}
+
+// bulk 发送 NDJSON 批量请求，返回第一条失败的结果；删除不存在的文档不算失败
+func (that *Elastic) bulk(ctx context.Context, body []byte) error {
+	var res struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Id     string `json:"_id"`
+			Status int    `json:"status"`
+			Error  *struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := that.do(ctx, http.MethodPost, "/_bulk", body, "application/x-ndjson", &res); err != nil {
+		return err
+	}
+	if !res.Errors {
+		return nil
+	}
+	for _, item := range res.Items {
+		for action, result := range item {
+			if result.Error == nil || (action == "delete" && result.Status == http.StatusNotFound) {
+				continue
+			}
+			return fmt.Errorf("索引文档 %s 失败: %w", result.Id, &ElasticError{
+				Status: result.Status,
+				Type:   result.Error.Type,
+				Reason: result.Error.Reason,
+			})
+		}
+	}
+	return nil
+}
+
+// elasticCursor 游标中保存最后一条的 sort 值，用于 search_after
+type elasticCursor struct {
+	Sort  string            `json:"s"`
+	After []json.RawMessage `json:"a"`
+	Query string            `json:"q"`
+}
+
+// searchBody 生成查询请求体，筛选规则与 Video.List 相同
+func (that *Elastic) searchBody(q model.VideoQuery) (map[string]any, error) {
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	if q.PageSize <= 0 {
+		q.PageSize = 30
+	}
+	boolQuery := map[string]any{}
+	var filter []any
+	if kw := q.Keyword(); kw != "" {
+		var must any = map[string]any{"multi_match": map[string]any{
+			"query":  kw,
+			"fields": []string{"title^3", "alias^2", "keywords^2", "actors^1.5", "directors^1.5", "describe"},
+			"type":   "best_fields",
+		}}
+		if py := pinyin.Normalize(kw); py != "" {
+			// 可能是拼音全拼或首字母，与原文匹配满足其一即可
+			must = map[string]any{"bool": map[string]any{
+				"should": []any{
+					must,
+					map[string]any{"wildcard": map[string]any{"pinyin": map[string]any{"value": "*" + py + "*", "boost": 2}}},
+				},
+				"minimum_should_match": 1,
+			}}
+		}
+		boolQuery["must"] = must
+		// 标题完全一致时排在最前
+		boolQuery["should"] = map[string]any{"term": map[string]any{"title.raw": map[string]any{"value": kw, "boost": 10}}}
+	}
+	if q.TypeId > 0 {
+		filter = append(filter, map[string]any{"term": map[string]any{"type_pid": q.TypeId}})
+	}
+	groups, err := q.Category.Groups()
+	if err != nil {
+		return nil, err
+	}
+	var years map[string]any
+	if year := q.Category.Year; year != nil {
+		yearRange := map[string]any{}
+		if year.From > 0 {
+			yearRange["gte"] = year.From
+		}
+		if year.To > 0 {
+			yearRange["lte"] = year.To
+		}
+		years = map[string]any{"range": map[string]any{"years": yearRange}}
+	}
+	for _, group := range groups {
+		terms := map[string]any{"terms": map[string]any{"category_ids": group.Ids}}
+		if group.Year && years != nil {
+			// 选中的年代与年代范围同组
+			filter = append(filter, map[string]any{"bool": map[string]any{"should": []any{terms, years}, "minimum_should_match": 1}})
+			years = nil
+			continue
+		}
+		filter = append(filter, terms)
+	}
+	if years != nil {
+		filter = append(filter, years)
+	}
+	if len(filter) > 0 {
+		boolQuery["filter"] = filter
+	}
+	if len(q.Category.Exclude) > 0 {
+		boolQuery["must_not"] = map[string]any{"terms": map[string]any{"category_ids": q.Category.Exclude}}
+	}
+
+	sort := q.Sort()
+	body := map[string]any{
+		"size":             q.PageSize,
+		"track_total_hits": true,
+		"_source":          false,
+	}
+	switch sort {
+	case model.SortScore:
+		body["sort"] = []any{map[string]any{"_score": "desc"}, map[string]any{"browse": "desc"}, map[string]any{"id": "desc"}}
+		body["highlight"] = map[string]any{
+			"pre_tags":  []string{"<em>"},
+			"post_tags": []string{"</em>"},
+			"fields": map[string]any{
+				"title":     map[string]any{"number_of_fragments": 0},
+				"alias":     map[string]any{"number_of_fragments": 0},
+				"keywords":  map[string]any{"number_of_fragments": 0},
+				"actors":    map[string]any{"number_of_fragments": 0},
+				"directors": map[string]any{"number_of_fragments": 0},
+				"describe":  map[string]any{"fragment_size": 60, "number_of_fragments": 1},
+			},
+		}
+	case model.SortBrowse:
+		body["sort"] = []any{map[string]any{"browse": "desc"}, map[string]any{"id": "desc"}}
+	default:
+		body["sort"] = []any{map[string]any{"id": "desc"}}
+	}
+	if q.Cursor != "" {
+		var cursor elasticCursor
+		data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+		if err == nil {
+			err = json.Unmarshal(data, &cursor)
+		}
+		if err != nil || cursor.Sort != sort || cursor.Query != q.Hash() || len(cursor.After) == 0 {
+			return nil, model.NewValidationError("Invalid Cursor")
+		}
+		body["search_after"] = cursor.After
+	} else {
+		// 兼容旧的 Page/Id 参数
+		if q.Id > 0 {
+			filter = append(filter, map[string]any{"range": map[string]any{"id": map[string]any{"gt": q.Id}}})
+			boolQuery["filter"] = filter
+		}
+		body["from"] = (q.Page - 1) * q.PageSize
+	}
+	if len(boolQuery) == 0 {
+		body["query"] = map[string]any{"match_all": map[string]any{}}
+	} else {
+		body["query"] = map[string]any{"bool": boolQuery}
+	}
+	return body, nil
+}
+
+func (that *Elastic) Search(ctx context.Context, q model.VideoQuery) (res Result, err error) {
+	body, err := that.searchBody(q)
+	if err != nil {
+		return
+	}
+	var resp struct {
+		Hits struct {
+			Total struct {
+				Value int64 `json:"value"`
+			} `json:"total"`
+			Hits []struct {
+				Id        string              `json:"_id"`
+				Score     *float64            `json:"_score"`
+				Sort      []json.RawMessage   `json:"sort"`
+				Highlight map[string][]string `json:"highlight"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err = that.doJSON(ctx, http.MethodPost, "/"+that.Alias+"/_search", body, &resp); err != nil {
+		return
+	}
+	res.Total = resp.Hits.Total.Value
+	for _, hit := range resp.Hits.Hits {
+		id, err := strconv.ParseInt(hit.Id, 10, 64)
+		if err != nil {
+			continue
+		}
+		item := Hit{Id: id, Highlight: hit.Highlight}
+		if hit.Score != nil {
+			item.Score = *hit.Score
+		}
+		res.Hits = append(res.Hits, item)
+	}
+	if hits := resp.Hits.Hits; len(hits) > 0 && len(hits) == body["size"].(int) {
+		data, _ := json.Marshal(elasticCursor{Sort: q.Sort(), After: hits[len(hits)-1].Sort, Query: q.Hash()})
+		res.NextCursor = base64.RawURLEncoding.EncodeToString(data)
+	}
+	return
+}
+
+// Facets 每个父分类一次聚合查询：条件同 model.FacetScopes，按 category_ids 做 terms 聚合，只统计该父分类下的子分类
+func (that *Elastic) Facets(ctx context.Context, q model.VideoQuery) (facets []model.Facet, err error) {
+	scopes, err := model.FacetScopes(q)
+	if err != nil {
+		return nil, err
+	}
+	for _, scope := range scopes {
+		children, err := model.FacetChildren(scope.Parent.Id)
+		if err != nil {
+			return nil, err
+		}
+		facet := model.Facet{Id: scope.Parent.Id, Name: scope.Parent.Name, Items: []model.FacetItem{}}
+		if len(children) > 0 {
+			if facet.Items, err = that.countCategories(ctx, scope.Query, children); err != nil {
+				return nil, err
+			}
+			model.SortFacetItems(facet.Name, facet.Items)
+		}
+		facets = append(facets, facet)
+	}
+	return
+}
+
+// facetBody 只聚合不返回文档，查询条件与 searchBody 相同
+func (that *Elastic) facetBody(q model.VideoQuery, ids []int64) (map[string]any, error) {
+	body, err := that.searchBody(q)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"size":  0,
+		"query": body["query"],
+		"aggs": map[string]any{
+			"categories": map[string]any{"terms": map[string]any{"field": "category_ids", "include": ids, "size": len(ids)}},
+		},
+	}, nil
+}
+
+// countCategories 返回 children 中视频数大于 0 的子分类及其视频数
+func (that *Elastic) countCategories(ctx context.Context, q model.VideoQuery, children []model.Category) ([]model.FacetItem, error) {
+	names := make(map[int64]string, len(children))
+	ids := make([]int64, 0, len(children))
+	for _, child := range children {
+		names[child.Id] = child.Name
+		ids = append(ids, child.Id)
+	}
+	body, err := that.facetBody(q, ids)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Aggregations struct {
+			Categories struct {
+				Buckets []struct {
+					Key      int64 `json:"key"`
+					DocCount int64 `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"categories"`
+		} `json:"aggregations"`
+	}
+	if err = that.doJSON(ctx, http.MethodPost, "/"+that.Alias+"/_search", body, &resp); err != nil {
+		return nil, err
+	}
+	items := []model.FacetItem{}
+	for _, bucket := range resp.Aggregations.Categories.Buckets {
+		if name, ok := names[bucket.Key]; ok && bucket.DocCount > 0 {
+			items = append(items, model.FacetItem{Id: bucket.Key, Name: name, Count: bucket.DocCount})
+		}
+	}
+	return items, nil
+}
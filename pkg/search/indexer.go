@@ -0,0 +1,94 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"video/model"
+	"video/pkg/event"
+)
+
+const replayBatchSize = 500
+
+// Indexer 按领域事件增量更新索引，由 relay 在事件发布后调用；
+// 失败时返回错误，relay 保留事件下一轮重试
+type Indexer struct {
+	Backend Backend
+	Load    func(ids []int64) ([]Document, error)
+}
+
+func NewIndexer(backend Backend) *Indexer {
+	return &Indexer{Backend: backend, Load: LoadDocuments}
+}
+
+// HandleEvent 新增、修改时从数据库读取最新数据写入索引，视频已删除时从索引删除；浏览事件忽略
+func (that *Indexer) HandleEvent(ctx context.Context, e event.Event) error {
+	var err error
+	switch e.Type {
+	case event.VideoCreated, event.VideoUpdated:
+		err = that.Sync(ctx, e.VideoId)
+	case event.VideoDeleted:
+		err = that.Backend.Delete(ctx, e.VideoId)
+	}
+	if err != nil {
+		return fmt.Errorf("更新视频 %d 的搜索索引失败: %w", e.VideoId, err)
+	}
+	return nil
+}
+
+// Sync 从数据库读取视频的最新数据写入索引，数据库中已不存在的视频从索引删除
+func (that *Indexer) Sync(ctx context.Context, ids ...int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	docs, err := that.Load(ids)
+	if err != nil {
+		return err
+	}
+	found := make(map[int64]bool, len(docs))
+	for _, doc := range docs {
+		found[doc.Id] = true
+	}
+	var missing []int64
+	for _, id := range ids {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+	if err = that.Backend.Index(ctx, docs...); err != nil {
+		return err
+	}
+	return that.Backend.Delete(ctx, missing...)
+}
+
+// Replay 重新索引 afterId 之后的 outbox 事件涉及的视频。reindex 期间 relay 仍写入旧索引，
+// 切换别名后用重建开始前的最大事件 id 调用，补上这段时间的变更；list 按 id 升序返回 afterId 之后的事件
+func (that *Indexer) Replay(ctx context.Context, afterId int64, list func(afterId int64, limit int) ([]model.Outbox, error)) (total int, err error) {
+	for {
+		rows, err := list(afterId, replayBatchSize)
+		if err != nil {
+			return total, err
+		}
+		if len(rows) == 0 {
+			return total, nil
+		}
+		var ids []int64
+		for _, row := range rows {
+			var e event.Event
+			if json.Unmarshal([]byte(row.Payload), &e) != nil || e.VideoId <= 0 || slices.Contains(ids, e.VideoId) {
+				continue
+			}
+			switch e.Type {
+			case event.VideoCreated, event.VideoUpdated, event.VideoDeleted:
+				ids = append(ids, e.VideoId)
+			}
+		}
+		if err = that.Sync(ctx, ids...); err != nil {
+			return total, err
+		}
+		total += len(ids)
+		afterId = rows[len(rows)-1].Id
+	}
+}
@@ -0,0 +1,91 @@
+package search
+
+import (
+	"context"
+	"strings"
+
+	"video/model"
+	"video/pkg/zhconv"
+)
+
+// MySQL 使用 Video.List 的 LIKE / MATCH 查询，数据即 video 表，不需要建索引
+type MySQL struct {
+	// Count 统计总数，为空时直接查询数据库；接口中传入带缓存的实现
+	Count func(ctx context.Context, q model.VideoQuery) (int64, error)
+	// LoadFacets 分面统计，为空时直接查询数据库；接口中传入带缓存的实现
+	LoadFacets func(ctx context.Context, q model.VideoQuery) ([]model.Facet, error)
+}
+
+func (that *MySQL) Index(ctx context.Context, docs ...Document) error {
+	return nil
+}
+
+func (that *MySQL) Delete(ctx context.Context, ids ...int64) error {
+	return nil
+}
+
+func (that *MySQL) Search(ctx context.Context, q model.VideoQuery) (res Result, err error) {
+	var video model.Video
+	data, nextCursor, err := video.List(q)
+	if err != nil {
+		return
+	}
+	if that.Count != nil {
+		res.Total, err = that.Count(ctx, q)
+	} else {
+		res.Total, err = video.Count(q)
+	}
+	if err != nil {
+		return
+	}
+	res.NextCursor = nextCursor
+	kw := q.Keyword()
+	res.Hits = make([]Hit, len(data))
+	for i := range data {
+		res.Hits[i] = Hit{Id: data[i].Id, Score: data[i].Score, Video: &data[i]}
+		if kw == "" {
+			continue
+		}
+		for field, text := range map[string]string{"title": data[i].Title, "alias": data[i].Alias, "keywords": data[i].Keywords} {
+			if fragment, ok := highlight(text, kw); ok {
+				if res.Hits[i].Highlight == nil {
+					res.Hits[i].Highlight = make(map[string][]string)
+				}
+				res.Hits[i].Highlight[field] = []string{fragment}
+			}
+		}
+	}
+	return
+}
+
+func (that *MySQL) Facets(ctx context.Context, q model.VideoQuery) ([]model.Facet, error) {
+	if that.LoadFacets != nil {
+		return that.LoadFacets(ctx, q)
+	}
+	var video model.Video
+	return video.Facets(q)
+}
+
+// highlight 用 <em></em> 包裹 text 中出现的 kw，不区分大小写和繁简，与 Elasticsearch 的高亮格式一致；
+// 繁简转换的字都是 3 字节的 UTF-8，转换后下标不变
+func highlight(text string, kw string) (string, bool) {
+	lowerText, lowerKw := zhconv.Simplify(strings.ToLower(text)), zhconv.Simplify(strings.ToLower(kw))
+	// 只处理小写后长度不变的文本，避免下标错位
+	if kw == "" || len(lowerText) != len(text) || len(lowerKw) != len(kw) || !strings.Contains(lowerText, lowerKw) {
+		return "", false
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(lowerText, lowerKw)
+		if i < 0 {
+			b.WriteString(text)
+			break
+		}
+		b.WriteString(text[:i])
+		b.WriteString("<em>")
+		b.WriteString(text[i : i+len(kw)])
+		b.WriteString("</em>")
+		text, lowerText = text[i+len(kw):], lowerText[i+len(kw):]
+	}
+	return b.String(), true
+}
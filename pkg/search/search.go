@@ -0,0 +1,179 @@
+package search
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"video/core"
+	"video/model"
+	"video/pkg/cache"
+)
+
+// Backend 视频搜索。MySQL 实现直接查询 video 表，Index、Delete 为空操作；
+// Elasticsearch 实现由 reindex 全量重建，领域事件增量更新
+type Backend interface {
+	Index(ctx context.Context, docs ...Document) error
+	Delete(ctx context.Context, ids ...int64) error
+	// Search 按关键词、分类、类型查询，排序与游标规则同 model.VideoQuery
+	Search(ctx context.Context, q model.VideoQuery) (Result, error)
+	// Facets 统计当前条件下 model.FacetNames 中各子分类的视频数，规则同 Video.Facets
+	Facets(ctx context.Context, q model.VideoQuery) ([]model.Facet, error)
+}
+
+// Document 索引中的视频
+type Document struct {
+	Id          int64     `json:"id"`
+	Title       string    `json:"title"`
+	Alias       string    `json:"alias,omitempty"`
+	Keywords    string    `json:"keywords,omitempty"`
+	Describe    string    `json:"describe,omitempty"`
+	Actors      []string  `json:"actors,omitempty"`
+	Directors   []string  `json:"directors,omitempty"`
+	Pinyin      string    `json:"pinyin,omitempty"` // 标题、别名、演员的全拼和首字母，见 pinyin.Keywords
+	TypeId      int64     `json:"type_id"`
+	TypePid     int64     `json:"type_pid"`
+	CategoryIds []int64   `json:"category_ids,omitempty"`
+	Years       []int     `json:"years,omitempty"`
+	Browse      int64     `json:"browse"`
+	CreatedAt   time.Time `json:"created_at,omitzero"`
+}
+
+// Hit 一条搜索结果，Video 为空时由 Videos 从数据库读取
+type Hit struct {
+	Id        int64
+	Score     float64
+	Highlight map[string][]string // 字段 -> 高亮片段，命中部分用 <em></em> 包裹
+	Video     *model.Video
+}
+
+// Result 一页搜索结果，NextCursor 为空表示没有下一页
+type Result struct {
+	Hits       []Hit
+	Total      int64
+	NextCursor string
+}
+
+var (
+	defaultBackend Backend
+	defaultOnce    sync.Once
+)
+
+// Default 配置了 Elastic.Addresses 时使用 Elasticsearch，否则使用 MySQL
+func Default() Backend {
+	defaultOnce.Do(func() {
+		cfg := core.New().ConfigGlobal.Elastic
+		if len(cfg.Addresses) > 0 {
+			defaultBackend = NewElastic(cfg)
+		} else {
+			defaultBackend = &MySQL{Count: cache.Default().CountVideos, LoadFacets: cache.Default().Facets}
+		}
+	})
+	return defaultBackend
+}
+
+// Videos 按 hits 的顺序返回视频，索引中有但数据库中已删除的视频跳过
+func Videos(hits []Hit) ([]model.Video, error) {
+	var ids []int64
+	for _, hit := range hits {
+		if hit.Video == nil {
+			ids = append(ids, hit.Id)
+		}
+	}
+	byId := make(map[int64]model.Video, len(ids))
+	if len(ids) > 0 {
+		var video model.Video
+		list, err := video.ListByIds(ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range list {
+			byId[v.Id] = v
+		}
+	}
+	data := make([]model.Video, 0, len(hits))
+	for _, hit := range hits {
+		if hit.Video != nil {
+			data = append(data, *hit.Video)
+		} else if v, ok := byId[hit.Id]; ok {
+			data = append(data, v)
+		}
+	}
+	return data, nil
+}
+
+// LoadDocuments 从数据库读取视频及其分类，生成索引文档，不存在的 id 不返回
+func LoadDocuments(ids []int64) ([]Document, error) {
+	var video model.Video
+	videos, err := video.ListByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+	return buildDocuments(videos)
+}
+
+// LoadDocumentsAfter 按 id 升序读取 id 大于 afterId 的 limit 个视频，用于全量重建
+func LoadDocumentsAfter(afterId int64, limit int) ([]Document, error) {
+	var video model.Video
+	videos, err := video.ListAfter(afterId, limit)
+	if err != nil {
+		return nil, err
+	}
+	return buildDocuments(videos)
+}
+
+func buildDocuments(videos []model.Video) ([]Document, error) {
+	if len(videos) == 0 {
+		return nil, nil
+	}
+	ids := make([]int64, len(videos))
+	for i := range videos {
+		ids[i] = videos[i].Id
+	}
+	names, err := model.ListCategoryNames(ids)
+	if err != nil {
+		return nil, err
+	}
+	byVideo := make(map[int64][]model.VideoCategoryName, len(videos))
+	for _, name := range names {
+		byVideo[name.VideoId] = append(byVideo[name.VideoId], name)
+	}
+	docs := make([]Document, len(videos))
+	for i := range videos {
+		docs[i] = newDocument(&videos[i], byVideo[videos[i].Id])
+	}
+	return docs, nil
+}
+
+// newDocument 演员、导演、年代来自对应父分类下的子分类
+func newDocument(video *model.Video, categories []model.VideoCategoryName) Document {
+	doc := Document{
+		Id:       video.Id,
+		Title:    video.Title,
+		Alias:    video.Alias,
+		Keywords: video.Keywords,
+		Describe: video.Describe,
+		Pinyin:   video.Pinyin,
+		TypeId:   video.TypeId,
+		TypePid:  video.TypePid,
+		Browse:   int64(video.Browse),
+	}
+	if video.CreatedAt != nil {
+		doc.CreatedAt = *video.CreatedAt
+	}
+	for _, category := range categories {
+		doc.CategoryIds = append(doc.CategoryIds, category.CategoryId)
+		switch category.ParentName {
+		case "演员":
+			doc.Actors = append(doc.Actors, category.Name)
+		case "导演":
+			doc.Directors = append(doc.Directors, category.Name)
+		case "年代":
+			if year, err := strconv.Atoi(category.Name); err == nil {
+				doc.Years = append(doc.Years, year)
+			}
+		}
+	}
+	return doc
+}
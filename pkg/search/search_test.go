@@ -0,0 +1,410 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"video/config"
+	"video/model"
+	"video/pkg/event"
+)
+
+// fakeElastic Elasticsearch 的 HTTP 替身，记录收到的请求，按 handle 返回响应
+type fakeElastic struct {
+	mu       sync.Mutex
+	requests []fakeRequest
+	handle   func(method string, path string, body []byte) (int, string)
+}
+
+type fakeRequest struct {
+	Method string
+	Path   string
+	Body   []byte
+}
+
+func (that *fakeElastic) start(t *testing.T) *Elastic {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "elastic" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		that.mu.Lock()
+		that.requests = append(that.requests, fakeRequest{Method: r.Method, Path: r.URL.Path, Body: body})
+		that.mu.Unlock()
+		status, resp := http.StatusOK, `{}`
+		if that.handle != nil {
+			status, resp = that.handle(r.Method, r.URL.Path, body)
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, resp)
+	}))
+	t.Cleanup(server.Close)
+	return NewElastic(config.Elastic{Addresses: []string{server.URL}, Username: "elastic", Password: "secret"})
+}
+
+func ndjsonLines(t *testing.T, body []byte) (lines []map[string]any) {
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("invalid ndjson line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	return
+}
+
+func TestElasticIndexAndDelete(t *testing.T) {
+	fake := &fakeElastic{}
+	es := fake.start(t)
+	ctx := context.Background()
+	docs := []Document{{Id: 1, Title: "三体", Actors: []string{"张鲁一"}}, {Id: 2, Title: "狂飙"}}
+	if err := es.Index(ctx, docs...); err != nil {
+		t.Fatal(err)
+	}
+	lines := ndjsonLines(t, fake.requests[0].Body)
+	if fake.requests[0].Path != "/_bulk" || len(lines) != 4 {
+		t.Fatalf("bulk request = %s %d lines", fake.requests[0].Path, len(lines))
+	}
+	action := lines[0]["index"].(map[string]any)
+	if action["_index"] != "video" || action["_id"] != "1" || lines[1]["title"] != "三体" {
+		t.Errorf("bulk lines = %v", lines[:2])
+	}
+
+	// 删除不存在的文档不算失败，其它失败返回错误
+	fake.handle = func(method, path string, body []byte) (int, string) {
+		return http.StatusOK, `{"errors":true,"items":[{"delete":{"_id":"1","status":404,"error":{"type":"x","reason":"missing"}}}]}`
+	}
+	if err := es.Delete(ctx, 1); err != nil {
+		t.Errorf("Delete missing = %v", err)
+	}
+	fake.handle = func(method, path string, body []byte) (int, string) {
+		return http.StatusOK, `{"errors":true,"items":[{"index":{"_id":"2","status":400,"error":{"type":"mapper_parsing_exception","reason":"bad"}}}]}`
+	}
+	var esErr *ElasticError
+	if err := es.Index(ctx, docs...); !errors.As(err, &esErr) || esErr.Type != "mapper_parsing_exception" {
+		t.Errorf("Index with item error = %v", err)
+	}
+}
+
+func TestElasticSearch(t *testing.T) {
+	fake := &fakeElastic{}
+	es := fake.start(t)
+	fake.handle = func(method, path string, body []byte) (int, string) {
+		return http.StatusOK, `{"hits":{"total":{"value":3},"hits":[
+			{"_id":"9","_score":12.5,"sort":[12.5,100,9],"highlight":{"title":["<em>三体</em>"]}},
+			{"_id":"7","_score":3,"sort":[3,5,7]}]}}`
+	}
+	ctx := context.Background()
+	q := model.VideoQuery{KeyWord: " 三体 ", TypeId: 2, PageSize: 2, Category: model.CategoryFilter{Exclude: []int64{5}}}
+	res, err := es.Search(ctx, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 3 || len(res.Hits) != 2 || res.Hits[0].Id != 9 || res.Hits[0].Score != 12.5 ||
+		res.Hits[0].Highlight["title"][0] != "<em>三体</em>" || res.NextCursor == "" {
+		t.Fatalf("result = %+v", res)
+	}
+
+	var body map[string]any
+	json.Unmarshal(fake.requests[0].Body, &body)
+	if fake.requests[0].Path != "/video/_search" || body["from"] != float64(0) || body["highlight"] == nil {
+		t.Errorf("search request = %s %v", fake.requests[0].Path, body)
+	}
+	query := body["query"].(map[string]any)["bool"].(map[string]any)
+	match := query["must"].(map[string]any)["multi_match"].(map[string]any)
+	if match["query"] != "三体" {
+		t.Errorf("multi_match = %v", match)
+	}
+	if !strings.Contains(string(fake.requests[0].Body), `"must_not":{"terms":{"category_ids":[5]}}`) ||
+		!strings.Contains(string(fake.requests[0].Body), `{"term":{"type_pid":2}}`) {
+		t.Errorf("filters missing: %s", fake.requests[0].Body)
+	}
+
+	// 下一页带上一页最后一条的 sort 值
+	q.Cursor = res.NextCursor
+	if _, err = es.Search(ctx, q); err != nil {
+		t.Fatal(err)
+	}
+	body = nil
+	json.Unmarshal(fake.requests[1].Body, &body)
+	if after, _ := body["search_after"].([]any); !reflect.DeepEqual(after, []any{3.0, 5.0, 7.0}) || body["from"] != nil {
+		t.Errorf("search_after = %v, from = %v", body["search_after"], body["from"])
+	}
+
+	// 游标只能用于生成它的查询
+	other := q
+	other.KeyWord = "狂飙"
+	for _, bad := range []model.VideoQuery{other, {KeyWord: "三体", TypeId: 2, Cursor: "bad!"}} {
+		if _, err = es.Search(ctx, bad); model.KindOf(err) != model.KindValidation {
+			t.Errorf("cursor %q for %q err = %v", bad.Cursor, bad.KeyWord, err)
+		}
+	}
+}
+
+func TestElasticSearchPinyin(t *testing.T) {
+	es := &Elastic{}
+	body, err := es.searchBody(model.VideoQuery{KeyWord: "Xi You Ji"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := json.Marshal(body)
+	if !strings.Contains(string(raw), `{"wildcard":{"pinyin":{"boost":2,"value":"*xiyouji*"}}}`) ||
+		!strings.Contains(string(raw), `"minimum_should_match":1`) {
+		t.Errorf("pinyin query missing: %s", raw)
+	}
+	body, _ = es.searchBody(model.VideoQuery{KeyWord: "三体"})
+	if raw, _ = json.Marshal(body); strings.Contains(string(raw), "pinyin") {
+		t.Errorf("han keyword matched pinyin: %s", raw)
+	}
+}
+
+func TestElasticCountCategories(t *testing.T) {
+	fake := &fakeElastic{}
+	es := fake.start(t)
+	fake.handle = func(method, path string, body []byte) (int, string) {
+		return http.StatusOK, `{"hits":{"total":{"value":5},"hits":[]},"aggregations":{"categories":{"buckets":[
+			{"key":12,"doc_count":4},{"key":11,"doc_count":1},{"key":99,"doc_count":3}]}}}`
+	}
+	children := []model.Category{{Id: 11, Name: "喜剧"}, {Id: 12, Name: "动作"}, {Id: 13, Name: "爱情"}}
+	items, err := es.countCategories(context.Background(), model.VideoQuery{KeyWord: "三体", TypeId: 2}, children)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 只返回该父分类下有视频的子分类
+	want := []model.FacetItem{{Id: 12, Name: "动作", Count: 4}, {Id: 11, Name: "喜剧", Count: 1}}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("items = %+v", items)
+	}
+	var body map[string]any
+	json.Unmarshal(fake.requests[0].Body, &body)
+	terms := body["aggs"].(map[string]any)["categories"].(map[string]any)["terms"].(map[string]any)
+	if body["size"] != 0.0 || body["sort"] != nil || terms["field"] != "category_ids" || terms["size"] != 3.0 ||
+		!reflect.DeepEqual(terms["include"], []any{11.0, 12.0, 13.0}) {
+		t.Errorf("facet request = %s", fake.requests[0].Body)
+	}
+	if raw := string(fake.requests[0].Body); !strings.Contains(raw, `"multi_match"`) || !strings.Contains(raw, `{"term":{"type_pid":2}}`) {
+		t.Errorf("facet query should match search: %s", raw)
+	}
+}
+
+func TestIndexBodySimplify(t *testing.T) {
+	raw, _ := json.Marshal(indexBody("1s"))
+	for _, want := range []string{`"國=\u003e国"`, `"char_filter":["zh_simplify"]`, `"normalizer":"zh_keyword"`} {
+		if !strings.Contains(string(raw), want) {
+			t.Errorf("index body missing %s", want)
+		}
+	}
+	if strings.Contains(string(raw), `"乾=\u003e干"`) {
+		t.Error("ambiguous mapping should be excluded")
+	}
+}
+
+func TestElasticReindex(t *testing.T) {
+	fake := &fakeElastic{}
+	es := fake.start(t)
+	fake.handle = func(method, path string, body []byte) (int, string) {
+		if method == http.MethodGet && path == "/_alias/video" {
+			return http.StatusOK, `{"video_old":{"aliases":{"video":{}}}}`
+		}
+		return http.StatusOK, `{}`
+	}
+	load := func(afterId int64, limit int) ([]Document, error) {
+		if afterId >= 3 {
+			return nil, nil
+		}
+		return []Document{{Id: afterId + 1}, {Id: afterId + 2}}, nil
+	}
+	total, err := es.Reindex(context.Background(), 2, load)
+	if err != nil || total != 4 {
+		t.Fatalf("Reindex = %d, %v", total, err)
+	}
+	newIndex := fake.requests[0].Path
+	var steps []string
+	for _, r := range fake.requests {
+		steps = append(steps, r.Method+" "+strings.Replace(r.Path, newIndex, "/NEW", 1))
+	}
+	want := []string{"PUT /NEW", "POST /_bulk", "POST /_bulk", "PUT /NEW/_settings", "POST /NEW/_refresh",
+		"GET /_alias/video", "POST /_aliases", "DELETE /video_old"}
+	if !reflect.DeepEqual(steps, want) {
+		t.Fatalf("steps = %v, want %v", steps, want)
+	}
+	if !strings.Contains(string(fake.requests[0].Body), `"cjk_bigram"`) {
+		t.Error("new index has no cjk analysis")
+	}
+	aliases := string(fake.requests[6].Body)
+	if !strings.Contains(aliases, `"remove":{"alias":"video","index":"video_old"}`) || !strings.Contains(aliases, `"add":{"alias":"video","index":"video_2`) {
+		t.Errorf("alias actions = %s", aliases)
+	}
+
+	// 写入失败时删除新建的索引，不切换别名
+	fake.requests = nil
+	fake.handle = func(method, path string, body []byte) (int, string) {
+		if path == "/_bulk" {
+			return http.StatusTooManyRequests, `{"error":{"type":"es_rejected_execution_exception","reason":"busy"}}`
+		}
+		return http.StatusOK, `{}`
+	}
+	if _, err = es.Reindex(context.Background(), 2, load); err == nil {
+		t.Fatal("expected reindex error")
+	}
+	last := fake.requests[len(fake.requests)-1]
+	if last.Method != http.MethodDelete || !strings.HasPrefix(last.Path, "/video_2") {
+		t.Errorf("last request = %s %s, want delete new index", last.Method, last.Path)
+	}
+}
+
+func TestElasticFailover(t *testing.T) {
+	fake := &fakeElastic{}
+	es := fake.start(t)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	es.Addresses = []string{down.URL, es.Addresses[0]}
+	for i := 0; i < 2; i++ {
+		if err := es.Delete(context.Background(), 1); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if len(fake.requests) != 2 {
+		t.Errorf("requests = %d, want 2", len(fake.requests))
+	}
+}
+
+type fakeBackend struct {
+	indexed []int64
+	deleted []int64
+	err     error
+}
+
+func (that *fakeBackend) Index(ctx context.Context, docs ...Document) error {
+	if that.err != nil {
+		return that.err
+	}
+	for _, doc := range docs {
+		that.indexed = append(that.indexed, doc.Id)
+	}
+	return nil
+}
+
+func (that *fakeBackend) Delete(ctx context.Context, ids ...int64) error {
+	that.deleted = append(that.deleted, ids...)
+	return nil
+}
+
+func (that *fakeBackend) Search(ctx context.Context, q model.VideoQuery) (Result, error) {
+	return Result{}, nil
+}
+
+func (that *fakeBackend) Facets(ctx context.Context, q model.VideoQuery) ([]model.Facet, error) {
+	return nil, nil
+}
+
+func TestIndexerHandleEvent(t *testing.T) {
+	backend := &fakeBackend{}
+	indexer := &Indexer{Backend: backend, Load: func(ids []int64) ([]Document, error) {
+		if ids[0] == 3 {
+			return nil, nil // 已被删除
+		}
+		return []Document{{Id: ids[0]}}, nil
+	}}
+	ctx := context.Background()
+	for _, e := range []event.Event{
+		{Type: event.VideoCreated, VideoId: 1},
+		{Type: event.VideoUpdated, VideoId: 3},
+		{Type: event.VideoDeleted, VideoId: 2},
+		{Type: event.VideoViewed, VideoId: 1},
+	} {
+		if err := indexer.HandleEvent(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(backend.indexed, []int64{1}) || !reflect.DeepEqual(backend.deleted, []int64{3, 2}) {
+		t.Errorf("indexed = %v, deleted = %v", backend.indexed, backend.deleted)
+	}
+	// 索引失败时返回错误，由 relay 重试
+	backend.err = errors.New("es down")
+	if err := indexer.HandleEvent(ctx, event.Event{Type: event.VideoUpdated, VideoId: 1}); !errors.Is(err, backend.err) {
+		t.Errorf("expected index error, got %v", err)
+	}
+}
+
+func TestIndexerReplay(t *testing.T) {
+	var rows []model.Outbox
+	for i, e := range []event.Event{
+		{Type: event.VideoCreated, VideoId: 1},
+		{Type: event.VideoViewed, VideoId: 2},
+		{Type: event.VideoUpdated, VideoId: 1},
+		{Type: event.VideoDeleted, VideoId: 3},
+		{Type: event.VideoUpdated, VideoId: 4},
+	} {
+		payload, _ := json.Marshal(e)
+		rows = append(rows, model.Outbox{Id: int64(i + 1), Payload: string(payload)})
+	}
+	list := func(afterId int64, limit int) (data []model.Outbox, err error) {
+		for _, row := range rows {
+			if row.Id > afterId && len(data) < 2 {
+				data = append(data, row)
+			}
+		}
+		return
+	}
+	backend := &fakeBackend{}
+	indexer := &Indexer{Backend: backend, Load: func(ids []int64) (docs []Document, err error) {
+		for _, id := range ids {
+			if id != 3 {
+				docs = append(docs, Document{Id: id})
+			}
+		}
+		return
+	}}
+	// 只重放 afterId 之后的事件，浏览事件忽略，已删除的视频从索引删除
+	total, err := indexer.Replay(context.Background(), 1, list)
+	if err != nil || total != 3 {
+		t.Fatalf("replayed %d: %v", total, err)
+	}
+	if !reflect.DeepEqual(backend.indexed, []int64{1, 4}) || !reflect.DeepEqual(backend.deleted, []int64{3}) {
+		t.Errorf("indexed = %v, deleted = %v", backend.indexed, backend.deleted)
+	}
+}
+
+func TestNewDocument(t *testing.T) {
+	doc := newDocument(&model.Video{Id: 1, Title: "三体", Browse: 7, Pinyin: "santi st"}, []model.VideoCategoryName{
+		{CategoryId: 11, Name: "张鲁一", ParentName: "演员"},
+		{CategoryId: 12, Name: "杨磊", ParentName: "导演"},
+		{CategoryId: 13, Name: "2023", ParentName: "年代"},
+		{CategoryId: 14, Name: "大陆", ParentName: "地区"},
+	})
+	want := Document{Id: 1, Title: "三体", Browse: 7, Pinyin: "santi st", CategoryIds: []int64{11, 12, 13, 14},
+		Actors: []string{"张鲁一"}, Directors: []string{"杨磊"}, Years: []int{2023}}
+	if !reflect.DeepEqual(doc, want) {
+		t.Errorf("doc = %+v, want %+v", doc, want)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	cases := []struct {
+		text, kw, want string
+		ok             bool
+	}{
+		{"三体 第二部 三体", "三体", "<em>三体</em> 第二部 <em>三体</em>", true},
+		{"The Three-Body", "three", "The <em>Three</em>-Body", true},
+		{"三體 第二部", "三体", "<em>三體</em> 第二部", true},
+		{"狂飙", "三体", "", false},
+	}
+	for _, c := range cases {
+		if got, ok := highlight(c.text, c.kw); got != c.want || ok != c.ok {
+			t.Errorf("highlight(%q, %q) = %q, %v", c.text, c.kw, got, ok)
+		}
+	}
+}
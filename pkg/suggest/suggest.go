@@ -0,0 +1,267 @@
+// Package suggest 搜索框的输入提示：按前缀匹配标题、别名和演员、导演，支持拼音全拼和首字母前缀。
+//
+// 候选保存在进程内的前缀树中，由 Suggester.Run 从数据库全量构建；
+// 之后轮询 outbox 表，有视频新增、修改、删除事件时重新构建，采集等其它进程的入库也能感知；
+// 全量构建要读取全部视频，两次构建之间至少间隔 RebuildInterval，采集期间持续入库时不会反复构建。
+package suggest
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"video/model"
+	"video/pkg/event"
+	"video/pkg/pinyin"
+	"video/pkg/search"
+)
+
+// 候选类型
+const (
+	KindTitle  = "title"
+	KindAlias  = "alias"
+	KindPerson = "person"
+)
+
+const (
+	DefaultLimit = 10
+	MaxLimit     = 20
+)
+
+// Suggestion 一个候选，VideoId 为标题、别名所属的视频，演员、导演为 0
+type Suggestion struct {
+	Text    string
+	Kind    string
+	VideoId int64 `json:",omitempty"`
+	Weight  int64 `json:"-"` // 标题、别名为视频的浏览数，演员、导演为参演视频的浏览数之和
+}
+
+// Suggester 持有当前的前缀树，查询无锁；Load、MaxEventId 在测试中替换
+type Suggester struct {
+	Interval        time.Duration // 轮询 outbox 的间隔
+	RebuildInterval time.Duration // 两次重建的最短间隔，期间的视频事件合并到下一次重建
+	BatchSize       int
+	// Load 按 id 升序读取 id 大于 afterId 的视频
+	Load func(afterId int64, limit int) ([]search.Document, error)
+	// MaxEventId 返回 id 大于 afterId 的 eventTypes 事件中最大的 id，没有时返回 0
+	MaxEventId func(afterId int64, eventTypes ...string) (int64, error)
+
+	trie    atomic.Pointer[Trie]
+	lastId  int64     // 已处理到的 outbox id
+	stale   bool      // 有视频事件但还没有重建成功
+	builtAt time.Time // 上次开始重建的时间，失败也计入，避免数据库故障时每轮都全量读取
+}
+
+var (
+	defaultSuggester *Suggester
+	defaultOnce      sync.Once
+)
+
+// videoEvents 需要重建的事件，浏览事件只影响排序，等下一次重建
+var videoEvents = []string{event.VideoCreated, event.VideoUpdated, event.VideoDeleted}
+
+func Default() *Suggester {
+	defaultOnce.Do(func() {
+		var outbox model.Outbox
+		defaultSuggester = &Suggester{
+			Interval:        10 * time.Second,
+			RebuildInterval: 10 * time.Minute,
+			BatchSize:       1000,
+			Load:            search.LoadDocumentsAfter,
+			MaxEventId:      outbox.MaxId,
+		}
+	})
+	return defaultSuggester
+}
+
+// Run 构建前缀树，之后每隔 Interval 检查一次视频事件，距上次重建超过 RebuildInterval 时重建，ctx 取消后返回
+func (that *Suggester) Run(ctx context.Context) {
+	var err error
+	// 构建前的最后一个事件，构建期间的入库会在下一轮触发重建
+	if that.lastId, err = that.MaxEventId(0); err != nil {
+		log.Printf("查询 outbox 失败: %v", err)
+	}
+	that.builtAt = time.Now()
+	if err = that.Rebuild(); err != nil {
+		log.Printf("构建输入提示失败: %v", err)
+	}
+	ticker := time.NewTicker(that.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err = that.poll(); err != nil {
+				log.Printf("更新输入提示失败: %v", err)
+			}
+		}
+	}
+}
+
+// poll 有新的视频事件或上次构建失败，且距上次重建超过 RebuildInterval 时重建
+func (that *Suggester) poll() error {
+	return that.pollAt(time.Now())
+}
+
+func (that *Suggester) pollAt(now time.Time) error {
+	latest, err := that.MaxEventId(that.lastId)
+	if err != nil {
+		return err
+	}
+	if latest > 0 {
+		changed, err := that.MaxEventId(that.lastId, videoEvents...)
+		if err != nil {
+			return err
+		}
+		that.lastId = latest
+		that.stale = that.stale || changed > 0
+	}
+	if that.trie.Load() != nil && (!that.stale || now.Sub(that.builtAt) < that.RebuildInterval) {
+		return nil
+	}
+	that.builtAt = now
+	if err = that.Rebuild(); err != nil {
+		return err
+	}
+	that.stale = false
+	return nil
+}
+
+// Rebuild 从数据库读取全部视频构建新的前缀树，完成后替换当前的前缀树
+func (that *Suggester) Rebuild() error {
+	start := time.Now()
+	b := newBuilder()
+	var afterId int64
+	for {
+		docs, err := that.Load(afterId, that.BatchSize)
+		if err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			break
+		}
+		for i := range docs {
+			b.add(&docs[i])
+		}
+		afterId = docs[len(docs)-1].Id
+	}
+	trie := b.trie()
+	that.trie.Store(trie)
+	log.Printf("输入提示构建完成，%d 个候选，耗时 %s", len(trie.entries), time.Since(start))
+	return nil
+}
+
+// Suggest 返回以 q 开头的标题、别名、演员、导演，q 可以是拼音全拼或首字母；前缀树未构建时返回空
+func (that *Suggester) Suggest(q string, limit int) []Suggestion {
+	trie := that.trie.Load()
+	if trie == nil {
+		return nil
+	}
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	limit = min(limit, MaxLimit)
+	var candidates []int32
+	prefix := normalize(q)
+	candidates = append(candidates, trie.lookup(prefix)...)
+	if py := pinyin.Normalize(q); py != "" && py != prefix {
+		candidates = append(candidates, trie.lookup(py)...)
+	}
+	candidates = trie.rank(candidates)
+	// 不同视频的同名标题、同一个人只返回一次
+	data := make([]Suggestion, 0, limit)
+	for _, i := range candidates {
+		entry := trie.entries[i]
+		if slices.ContainsFunc(data, func(s Suggestion) bool { return s.Kind == entry.Kind && s.Text == entry.Text }) {
+			continue
+		}
+		data = append(data, entry)
+		if len(data) == limit {
+			break
+		}
+	}
+	return data
+}
+
+// normalize 候选和查询的检索形式：繁体转简体、小写
+func normalize(s string) string {
+	return strings.ToLower(model.SearchText(s))
+}
+
+// builder 汇总视频的标题、别名和演员、导演，同一个人在多个视频中出现时权重累加
+type builder struct {
+	entries []Suggestion
+	keys    []key
+	persons map[string]int32
+	titles  map[string]bool
+}
+
+func newBuilder() *builder {
+	return &builder{persons: make(map[string]int32), titles: make(map[string]bool)}
+}
+
+func (that *builder) add(doc *search.Document) {
+	if doc.Title != "" {
+		that.addEntry(Suggestion{Text: doc.Title, Kind: KindTitle, VideoId: doc.Id, Weight: doc.Browse})
+		that.titles[normalize(doc.Title)] = true
+	}
+	for _, alias := range splitAlias(doc.Alias) {
+		if alias = strings.TrimSpace(alias); alias != "" {
+			that.addEntry(Suggestion{Text: alias, Kind: KindAlias, VideoId: doc.Id, Weight: doc.Browse})
+		}
+	}
+	seen := make(map[string]bool)
+	for _, name := range slices.Concat(doc.Actors, doc.Directors) {
+		name = strings.TrimSpace(name)
+		id := normalize(name)
+		// 同一个视频中既是演员又是导演只计一次
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		if i, ok := that.persons[id]; ok {
+			that.entries[i].Weight += doc.Browse
+			continue
+		}
+		that.persons[id] = that.addEntry(Suggestion{Text: name, Kind: KindPerson, Weight: doc.Browse})
+	}
+}
+
+// addEntry 添加候选及其检索词：原文，含汉字时还有拼音全拼和首字母
+func (that *builder) addEntry(s Suggestion) int32 {
+	i := int32(len(that.entries))
+	that.entries = append(that.entries, s)
+	text := normalize(s.Text)
+	if text == "" {
+		return i
+	}
+	that.keys = append(that.keys, key{text: text, entry: i})
+	if full, initials, hasHan := pinyin.Convert(text); hasHan {
+		that.keys = append(that.keys, key{text: full, entry: i})
+		if initials != full {
+			that.keys = append(that.keys, key{text: initials, entry: i})
+		}
+	}
+	return i
+}
+
+// trie 与某个标题相同的别名不作为候选，避免选中后打开的是另一个视频
+func (that *builder) trie() *Trie {
+	keys := slices.DeleteFunc(that.keys, func(k key) bool {
+		entry := &that.entries[k.entry]
+		return entry.Kind == KindAlias && that.titles[normalize(entry.Text)]
+	})
+	return newTrie(that.entries, keys)
+}
+
+// splitAlias 别名可能有多个，按常见分隔符拆分
+func splitAlias(alias string) []string {
+	return strings.FieldsFunc(alias, func(r rune) bool {
+		return strings.ContainsRune(",，/、|;；", r)
+	})
+}
@@ -0,0 +1,185 @@
+package suggest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"video/pkg/search"
+)
+
+var catalog = []search.Document{
+	{Id: 1, Title: "西游记", Alias: "Journey to the West", Actors: []string{"六小龄童"}, Browse: 500},
+	{Id: 2, Title: "西游记之大圣归来", Browse: 300},
+	{Id: 3, Title: "大話西遊", Alias: "西游记 / 月光宝盒", Actors: []string{"周星驰"}, Directors: []string{"刘镇伟"}, Browse: 800},
+	{Id: 4, Title: "功夫", Actors: []string{"周星驰"}, Directors: []string{"周星驰"}, Browse: 700},
+	{Id: 5, Title: "西游记", Browse: 10},
+	{Id: 6, Title: "The Matrix", Actors: []string{"Keanu Reeves"}, Browse: 50},
+}
+
+func newTestSuggester(docs []search.Document) *Suggester {
+	return &Suggester{
+		Interval:        time.Millisecond,
+		RebuildInterval: time.Minute,
+		BatchSize:       2,
+		Load: func(afterId int64, limit int) (data []search.Document, err error) {
+			for _, doc := range docs {
+				if doc.Id > afterId && len(data) < limit {
+					data = append(data, doc)
+				}
+			}
+			return
+		},
+		MaxEventId: func(afterId int64, eventTypes ...string) (int64, error) { return 0, nil },
+	}
+}
+
+func texts(data []Suggestion) (out []string) {
+	for _, s := range data {
+		out = append(out, s.Kind+":"+s.Text)
+	}
+	return
+}
+
+func TestSuggest(t *testing.T) {
+	s := newTestSuggester(catalog)
+	if s.Suggest("西", 10) != nil {
+		t.Fatal("expected no suggestions before build")
+	}
+	if err := s.Rebuild(); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		q    string
+		want []string
+	}{
+		// 繁体标题按简体匹配，同名标题只返回一次，与标题相同的别名不返回
+		{"西游", []string{"title:西游记", "title:西游记之大圣归来"}},
+		{"大话", []string{"title:大話西遊"}},
+		// 拼音全拼、首字母前缀
+		{"xiyou", []string{"title:西游记", "title:西游记之大圣归来"}},
+		{"XYJ", []string{"title:西游记", "title:西游记之大圣归来"}},
+		{"zxc", []string{"person:周星驰"}},
+		// 演员在多个视频中出现时权重累加，同一视频中既是演员又是导演只计一次
+		{"周", []string{"person:周星驰"}},
+		{"the ma", []string{"title:The Matrix"}},
+		{"keanu", []string{"person:Keanu Reeves"}},
+		{"月光", []string{"alias:月光宝盒"}},
+		{"三体", nil},
+		{"", nil},
+	}
+	for _, c := range cases {
+		if got := texts(s.Suggest(c.q, 10)); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Suggest(%q) = %v, want %v", c.q, got, c.want)
+		}
+	}
+
+	data := s.Suggest("周星驰", 10)
+	if len(data) != 1 || data[0].Weight != 1500 || data[0].VideoId != 0 {
+		t.Errorf("person = %+v", data)
+	}
+	// 同名标题取浏览数高的视频
+	if data = s.Suggest("西", 1); len(data) != 1 || data[0].Text != "西游记" || data[0].VideoId != 1 {
+		t.Errorf("limit 1 = %+v", data)
+	}
+}
+
+func TestSuggestTopK(t *testing.T) {
+	var docs []search.Document
+	for i := 1; i <= 100; i++ {
+		docs = append(docs, search.Document{Id: int64(i), Title: fmt.Sprintf("三体%03d", i), Browse: int64(i)})
+	}
+	s := newTestSuggester(docs)
+	if err := s.Rebuild(); err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{"三", "三体", "st", "santi"} {
+		data := s.Suggest(q, 100)
+		if len(data) != MaxLimit || data[0].Text != "三体100" || data[MaxLimit-1].Text != "三体081" {
+			t.Errorf("Suggest(%q) = %v", q, texts(data))
+		}
+	}
+	if data := s.Suggest("三体05", 10); len(data) != 10 || data[0].Text != "三体059" {
+		t.Errorf("Suggest(三体05) = %v", texts(data))
+	}
+}
+
+func TestSuggesterPoll(t *testing.T) {
+	docs := []search.Document{{Id: 1, Title: "狂飙"}}
+	s := newTestSuggester(nil)
+	s.Load = func(afterId int64, limit int) ([]search.Document, error) {
+		if afterId > 0 {
+			return nil, nil
+		}
+		return docs, nil
+	}
+	var latest, videoEvent int64
+	s.MaxEventId = func(afterId int64, eventTypes ...string) (int64, error) {
+		id := latest
+		if len(eventTypes) > 0 {
+			id = videoEvent
+		}
+		if id <= afterId {
+			return 0, nil
+		}
+		return id, nil
+	}
+	now := time.Now()
+	if err := s.pollAt(now); err != nil || len(s.Suggest("狂", 10)) != 1 {
+		t.Fatalf("first poll should build, err = %v", err)
+	}
+
+	// 只有浏览事件时不重建
+	docs = append(docs, search.Document{Id: 2, Title: "狂飙突进"})
+	latest = 5
+	now = now.Add(2 * time.Minute)
+	if err := s.pollAt(now); err != nil || len(s.Suggest("狂", 10)) != 1 || s.lastId != 5 {
+		t.Fatalf("viewed events should not rebuild, err = %v, lastId = %d", err, s.lastId)
+	}
+
+	// 视频事件触发重建，重建失败时间隔 RebuildInterval 后重试
+	latest, videoEvent = 8, 7
+	load := s.Load
+	s.Load = func(afterId int64, limit int) ([]search.Document, error) { return nil, errors.New("db down") }
+	if err := s.pollAt(now); err == nil || !s.stale {
+		t.Fatalf("expected rebuild error, err = %v", err)
+	}
+	s.Load = load
+	if err := s.pollAt(now.Add(30 * time.Second)); err != nil || len(s.Suggest("狂", 10)) != 1 || !s.stale {
+		t.Fatalf("expected no rebuild within interval, err = %v, stale = %v", err, s.stale)
+	}
+	now = now.Add(time.Minute)
+	if err := s.pollAt(now); err != nil || len(s.Suggest("狂", 10)) != 2 || s.stale {
+		t.Errorf("expected rebuild after failure, err = %v, got %v", err, texts(s.Suggest("狂", 10)))
+	}
+
+	// 连续的视频事件在 RebuildInterval 内合并为一次重建
+	docs = append(docs, search.Document{Id: 3, Title: "狂人日记"})
+	latest, videoEvent = 9, 9
+	if err := s.pollAt(now.Add(time.Second)); err != nil || len(s.Suggest("狂", 10)) != 2 || !s.stale {
+		t.Errorf("expected rebuild deferred, err = %v, stale = %v", err, s.stale)
+	}
+	latest, videoEvent = 10, 10
+	if err := s.pollAt(now.Add(time.Minute)); err != nil || len(s.Suggest("狂", 10)) != 3 || s.stale || s.lastId != 10 {
+		t.Errorf("expected deferred rebuild, err = %v, got %v", err, texts(s.Suggest("狂", 10)))
+	}
+}
+
+func BenchmarkSuggest(b *testing.B) {
+	var docs []search.Document
+	for i := 1; i <= 50000; i++ {
+		docs = append(docs, search.Document{Id: int64(i), Title: fmt.Sprintf("西游记第%d部", i), Alias: fmt.Sprintf("Journey %d", i),
+			Actors: []string{fmt.Sprintf("演员%d", i%3000)}, Browse: int64(i % 997)})
+	}
+	s := newTestSuggester(docs)
+	s.BatchSize = 1000
+	if err := s.Rebuild(); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Suggest("xiyouji", 10)
+	}
+}
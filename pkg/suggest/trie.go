@@ -0,0 +1,133 @@
+package suggest
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// topK 每个节点保留的候选数，接口最多返回 MaxLimit 个，去重后仍然够用
+const topK = 2 * MaxLimit
+
+// Trie 压缩前缀树，只读，重建时整体替换。每个节点保存子树中权重最高的 topK 个候选，
+// 查询只需沿前缀走到对应节点，耗时与前缀长度成正比，与目录大小无关
+type Trie struct {
+	root    *node
+	entries []Suggestion
+}
+
+type node struct {
+	label    string  // 父节点到本节点的边，按字节比较
+	children []*node // 按 label 首字节排序，首字节互不相同
+	top      []int32 // entries 的下标，按 less 排序
+}
+
+// key 一个检索词及其对应的候选
+type key struct {
+	text  string
+	entry int32
+}
+
+// newTrie keys 中的 entry 为 entries 的下标
+func newTrie(entries []Suggestion, keys []key) *Trie {
+	t := &Trie{entries: entries}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].text != keys[j].text {
+			return keys[i].text < keys[j].text
+		}
+		return keys[i].entry < keys[j].entry
+	})
+	t.root = t.build(keys, 0)
+	return t
+}
+
+// build keys 已排序且前 depth 个字节相同
+func (that *Trie) build(keys []key, depth int) *node {
+	n := &node{}
+	var candidates []int32
+	i := 0
+	// 排序后恰好以本节点结束的词在最前面
+	for ; i < len(keys) && len(keys[i].text) == depth; i++ {
+		candidates = append(candidates, keys[i].entry)
+	}
+	for i < len(keys) {
+		b := keys[i].text[depth]
+		j := i + 1
+		for j < len(keys) && keys[j].text[depth] == b {
+			j++
+		}
+		group := keys[i:j]
+		end := depth + commonPrefixLen(group[0].text[depth:], group[len(group)-1].text[depth:])
+		child := that.build(group, end)
+		child.label = group[0].text[depth:end]
+		n.children = append(n.children, child)
+		candidates = append(candidates, child.top...)
+		i = j
+	}
+	n.top = that.rank(candidates)
+	return n
+}
+
+// rank 去掉重复的候选，按 less 排序后保留 topK 个
+func (that *Trie) rank(candidates []int32) []int32 {
+	slices.Sort(candidates)
+	candidates = slices.Compact(candidates)
+	sort.Slice(candidates, func(i, j int) bool {
+		return that.less(candidates[i], candidates[j])
+	})
+	if len(candidates) > topK {
+		candidates = candidates[:topK:topK]
+	}
+	return slices.Clip(candidates)
+}
+
+// less 权重高的在前，相同时短的在前
+func (that *Trie) less(a, b int32) bool {
+	x, y := &that.entries[a], &that.entries[b]
+	if x.Weight != y.Weight {
+		return x.Weight > y.Weight
+	}
+	if len(x.Text) != len(y.Text) {
+		return len(x.Text) < len(y.Text)
+	}
+	if x.Text != y.Text {
+		return x.Text < y.Text
+	}
+	return a < b
+}
+
+// lookup 返回以 prefix 开头的词对应的候选，prefix 为空时不返回
+func (that *Trie) lookup(prefix string) []int32 {
+	if prefix == "" || that.root == nil {
+		return nil
+	}
+	n := that.root
+	for prefix != "" {
+		i := sort.Search(len(n.children), func(i int) bool { return n.children[i].label[0] >= prefix[0] })
+		if i == len(n.children) || n.children[i].label[0] != prefix[0] {
+			return nil
+		}
+		child := n.children[i]
+		if len(prefix) <= len(child.label) {
+			if strings.HasPrefix(child.label, prefix) {
+				return child.top
+			}
+			return nil
+		}
+		if !strings.HasPrefix(prefix, child.label) {
+			return nil
+		}
+		prefix, n = prefix[len(child.label):], child
+	}
+	return n.top
+}
+
+func commonPrefixLen(a, b string) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
@@ -0,0 +1,152 @@
+package views
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const memoryShards = 32
+
+// MemoryStore 进程内累计浏览数，按视频 id 分片加锁，未配置 Redis 时使用；
+// 只在单实例下准确，进程异常退出时未写库的浏览数会丢失
+type MemoryStore struct {
+	shards [memoryShards]memoryShard
+	rankMu sync.Mutex
+	ranks  map[string]map[int64]map[int64]int64 // 日期 -> typePid -> 视频 id -> 浏览数
+}
+
+type memoryShard struct {
+	mu       sync.Mutex
+	pending  map[int64]int64
+	seen     map[string]time.Time // 去重 key -> 过期时间
+	prunedAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	store := &MemoryStore{ranks: make(map[string]map[int64]map[int64]int64)}
+	for i := range store.shards {
+		store.shards[i].pending = make(map[int64]int64)
+		store.shards[i].seen = make(map[string]time.Time)
+	}
+	return store
+}
+
+func (that *MemoryStore) shard(videoId int64) *memoryShard {
+	return &that.shards[uint64(videoId)%memoryShards]
+}
+
+func (that *MemoryStore) Seen(ctx context.Context, videoId int64, clientId string, window time.Duration) (bool, error) {
+	shard := that.shard(videoId)
+	key := strconv.FormatInt(videoId, 10) + ":" + clientId
+	now := time.Now()
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	// 定期清理过期的去重记录
+	if now.Sub(shard.prunedAt) > time.Minute {
+		for k, expireAt := range shard.seen {
+			if !expireAt.After(now) {
+				delete(shard.seen, k)
+			}
+		}
+		shard.prunedAt = now
+	}
+	if expireAt, ok := shard.seen[key]; ok && expireAt.After(now) {
+		return false, nil
+	}
+	shard.seen[key] = now.Add(window)
+	return true, nil
+}
+
+func (that *MemoryStore) Incr(ctx context.Context, videoId int64, typePid int64, at time.Time) error {
+	shard := that.shard(videoId)
+	shard.mu.Lock()
+	shard.pending[videoId]++
+	shard.mu.Unlock()
+
+	day := dayKey(at)
+	that.rankMu.Lock()
+	defer that.rankMu.Unlock()
+	byType, ok := that.ranks[day]
+	if !ok {
+		byType = make(map[int64]map[int64]int64)
+		that.ranks[day] = byType
+		that.pruneRanks(at)
+	}
+	for _, t := range rankTypes(typePid) {
+		if byType[t] == nil {
+			byType[t] = make(map[int64]int64)
+		}
+		byType[t][videoId]++
+	}
+	return nil
+}
+
+// pruneRanks 删除超过 rankDays 天的日排行
+func (that *MemoryStore) pruneRanks(at time.Time) {
+	oldest := dayKey(at.AddDate(0, 0, -rankDays))
+	for day := range that.ranks {
+		if day < oldest {
+			delete(that.ranks, day)
+		}
+	}
+}
+
+func (that *MemoryStore) Drain(ctx context.Context) (map[int64]int64, error) {
+	counts := make(map[int64]int64)
+	for i := range that.shards {
+		shard := &that.shards[i]
+		shard.mu.Lock()
+		for id, n := range shard.pending {
+			counts[id] = n
+		}
+		clear(shard.pending)
+		shard.mu.Unlock()
+	}
+	return counts, nil
+}
+
+func (that *MemoryStore) Restore(ctx context.Context, counts map[int64]int64) error {
+	for id, n := range counts {
+		shard := that.shard(id)
+		shard.mu.Lock()
+		shard.pending[id] += n
+		shard.mu.Unlock()
+	}
+	return nil
+}
+
+func (that *MemoryStore) Top(ctx context.Context, period string, typePid int64, at time.Time, limit int) ([]Score, error) {
+	totals := make(map[int64]int64)
+	that.rankMu.Lock()
+	for _, day := range periodDays(period, at) {
+		for id, n := range that.ranks[day][typePid] {
+			totals[id] += n
+		}
+	}
+	that.rankMu.Unlock()
+	scores := make([]Score, 0, len(totals))
+	for id, n := range totals {
+		scores = append(scores, Score{VideoId: id, Views: n})
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Views != scores[j].Views {
+			return scores[i].Views > scores[j].Views
+		}
+		return scores[i].VideoId > scores[j].VideoId
+	})
+	if len(scores) > limit {
+		scores = scores[:limit]
+	}
+	return scores, nil
+}
+
+// rankTypes 浏览同时计入视频所属类型和全部类型(0)的排行
+func rankTypes(typePid int64) []int64 {
+	if typePid == 0 {
+		return []int64{0}
+	}
+	return []int64{typePid, 0}
+}
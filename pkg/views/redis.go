@@ -0,0 +1,119 @@
+package views
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore 在 Redis 中累计浏览数，多个实例共享去重记录和排行。
+// 同一类型的日排行 key 带相同的 hash tag，集群模式下可以 ZUNIONSTORE 计算周排行。
+type RedisStore struct {
+	Client redis.Cmdable
+	Prefix string
+}
+
+func NewRedisStore(client redis.Cmdable, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = "video:"
+	}
+	return &RedisStore{Client: client, Prefix: prefix}
+}
+
+func (that *RedisStore) pendingKey() string {
+	return that.Prefix + "views:pending"
+}
+
+func (that *RedisStore) rankKey(typePid int64, day string) string {
+	return that.Prefix + "rank:{" + strconv.FormatInt(typePid, 10) + "}:" + day
+}
+
+func (that *RedisStore) Seen(ctx context.Context, videoId int64, clientId string, window time.Duration) (bool, error) {
+	key := that.Prefix + "views:seen:" + strconv.FormatInt(videoId, 10) + ":" + clientId
+	return that.Client.SetNX(ctx, key, 1, window).Result()
+}
+
+func (that *RedisStore) Incr(ctx context.Context, videoId int64, typePid int64, at time.Time) error {
+	member := strconv.FormatInt(videoId, 10)
+	day := dayKey(at)
+	pipe := that.Client.Pipeline()
+	pipe.HIncrBy(ctx, that.pendingKey(), member, 1)
+	for _, t := range rankTypes(typePid) {
+		key := that.rankKey(t, day)
+		pipe.ZIncrBy(ctx, key, 1, member)
+		pipe.Expire(ctx, key, rankDays*24*time.Hour)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Drain 在一个 MULTI 中读取并删除待写库的浏览数，多个实例同时写库时每次浏览只会被取出一次
+func (that *RedisStore) Drain(ctx context.Context) (map[int64]int64, error) {
+	var all *redis.MapStringStringCmd
+	_, err := that.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		all = pipe.HGetAll(ctx, that.pendingKey())
+		pipe.Del(ctx, that.pendingKey())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[int64]int64, len(all.Val()))
+	for member, value := range all.Val() {
+		id, err1 := strconv.ParseInt(member, 10, 64)
+		n, err2 := strconv.ParseInt(value, 10, 64)
+		if err1 == nil && err2 == nil && n > 0 {
+			counts[id] = n
+		}
+	}
+	return counts, nil
+}
+
+func (that *RedisStore) Restore(ctx context.Context, counts map[int64]int64) error {
+	pipe := that.Client.Pipeline()
+	for id, n := range counts {
+		pipe.HIncrBy(ctx, that.pendingKey(), strconv.FormatInt(id, 10), n)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (that *RedisStore) Top(ctx context.Context, period string, typePid int64, at time.Time, limit int) ([]Score, error) {
+	days := periodDays(period, at)
+	key := that.rankKey(typePid, days[0])
+	if len(days) > 1 {
+		// 周排行合并最近 7 天，结果缓存一分钟
+		key = that.rankKey(typePid, "week:"+days[0])
+		exists, err := that.Client.Exists(ctx, key).Result()
+		if err != nil {
+			return nil, err
+		}
+		if exists == 0 {
+			keys := make([]string, 0, len(days))
+			for _, day := range days {
+				keys = append(keys, that.rankKey(typePid, day))
+			}
+			pipe := that.Client.TxPipeline()
+			pipe.ZUnionStore(ctx, key, &redis.ZStore{Keys: keys})
+			pipe.Expire(ctx, key, time.Minute)
+			if _, err = pipe.Exec(ctx); err != nil {
+				return nil, err
+			}
+		}
+	}
+	members, err := that.Client.ZRevRangeWithScores(ctx, key, 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	scores := make([]Score, 0, len(members))
+	for _, member := range members {
+		id, err := strconv.ParseInt(member.Member.(string), 10, 64)
+		if err != nil {
+			continue
+		}
+		scores = append(scores, Score{VideoId: id, Views: int64(member.Score)})
+	}
+	return scores, nil
+}
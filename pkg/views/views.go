@@ -0,0 +1,198 @@
+package views
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"sync"
+	"time"
+
+	"video/config"
+	"video/core"
+	"video/model"
+	"video/pkg/cache"
+	"video/pkg/event"
+
+	"gorm.io/gorm"
+)
+
+// 排行周期
+const (
+	PeriodDay  = "day"
+	PeriodWeek = "week"
+	PeriodAll  = "all"
+)
+
+// rankDays 按天保存的排行保留天数，周排行为最近 7 天之和
+const rankDays = 8
+
+// Score 排行中的一个视频
+type Score struct {
+	VideoId int64
+	Views   int64
+}
+
+// Store 暂存浏览数并维护日排行，Redis 和进程内各有一个实现
+type Store interface {
+	// Seen 记录 client 浏览了视频，window 内已经浏览过时返回 false
+	Seen(ctx context.Context, videoId int64, clientId string, window time.Duration) (bool, error)
+	// Incr 增加一次待写库的浏览数，并计入 at 当天的排行
+	Incr(ctx context.Context, videoId int64, typePid int64, at time.Time) error
+	// Drain 取出并清空待写库的浏览数
+	Drain(ctx context.Context) (map[int64]int64, error)
+	// Restore 写库失败时把 Drain 取出的浏览数加回去
+	Restore(ctx context.Context, counts map[int64]int64) error
+	// Top 返回截至 at 的日排行或周排行，typePid 为 0 表示全部类型
+	Top(ctx context.Context, period string, typePid int64, at time.Time, limit int) ([]Score, error)
+}
+
+// Writer 把浏览数写入数据库
+type Writer interface {
+	AddBrowse(ctx context.Context, counts map[int64]int64) error
+}
+
+// DBWriter 在一个事务内增加 video.browse，并为每个视频写入一个 video.viewed 事件
+type DBWriter struct{}
+
+func (DBWriter) AddBrowse(ctx context.Context, counts map[int64]int64) error {
+	return core.New().DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var video model.Video
+		if err := video.AddBrowse(tx, counts); err != nil {
+			return err
+		}
+		events := make([]event.Event, 0, len(counts))
+		for id, n := range counts {
+			e, err := event.New(event.VideoViewed, id, event.Viewed{Id: id, Count: n})
+			if err != nil {
+				return err
+			}
+			events = append(events, e)
+		}
+		return event.Enqueue(tx, events...)
+	})
+}
+
+// Counter 去重后累计浏览数，每隔 FlushInterval 批量写入数据库
+type Counter struct {
+	Store         Store
+	Writer        Writer
+	FlushInterval time.Duration
+	DedupWindow   time.Duration
+}
+
+var (
+	defaultCounter *Counter
+	defaultOnce    sync.Once
+)
+
+// Default 配置了 Redis 时使用 Redis 累计，多个实例共享去重和排行，否则在进程内累计
+func Default() *Counter {
+	defaultOnce.Do(func() {
+		var store Store = NewMemoryStore()
+		if client := cache.Client(); client != nil {
+			store = NewRedisStore(client, core.New().ConfigGlobal.Cache.Prefix)
+		}
+		defaultCounter = New(core.New().ConfigGlobal.Views, store, DBWriter{})
+	})
+	return defaultCounter
+}
+
+func New(cfg config.Views, store Store, writer Writer) *Counter {
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 10
+	}
+	if cfg.DedupWindow <= 0 {
+		cfg.DedupWindow = 1800
+	}
+	return &Counter{
+		Store:         store,
+		Writer:        writer,
+		FlushInterval: time.Duration(cfg.FlushInterval) * time.Second,
+		DedupWindow:   time.Duration(cfg.DedupWindow) * time.Second,
+	}
+}
+
+// Record 记录一次浏览，同一客户端在 DedupWindow 内重复浏览不计数，返回是否计数
+func (that *Counter) Record(ctx context.Context, video *model.Video, clientId string) (bool, error) {
+	seen, err := that.Store.Seen(ctx, video.Id, clientId, that.DedupWindow)
+	if err != nil || !seen {
+		return false, err
+	}
+	return true, that.Store.Incr(ctx, video.Id, video.TypePid, time.Now())
+}
+
+// Flush 把累计的浏览数写入数据库，失败时加回 Store 等待下次写入
+func (that *Counter) Flush(ctx context.Context) (int, error) {
+	counts, err := that.Store.Drain(ctx)
+	if err != nil || len(counts) == 0 {
+		return 0, err
+	}
+	if err = that.Writer.AddBrowse(ctx, counts); err != nil {
+		if restoreErr := that.Store.Restore(context.WithoutCancel(ctx), counts); restoreErr != nil {
+			log.Printf("浏览数写库失败且加回失败，丢弃 %d 个视频的浏览数: %v", len(counts), restoreErr)
+		}
+		return 0, err
+	}
+	return len(counts), nil
+}
+
+// Run 每隔 FlushInterval 写一次数据库，ctx 取消后再写一次后返回
+func (that *Counter) Run(ctx context.Context) {
+	ticker := time.NewTicker(that.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := that.Flush(ctx); err != nil {
+				log.Printf("浏览数写库失败: %v", err)
+			}
+		case <-ctx.Done():
+			if _, err := that.Flush(context.WithoutCancel(ctx)); err != nil {
+				log.Printf("浏览数写库失败: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// Top 返回排行：day、week 来自 Store，all 按 video.browse
+func (that *Counter) Top(ctx context.Context, period string, typePid int64, limit int) ([]Score, error) {
+	if period != PeriodAll {
+		return that.Store.Top(ctx, period, typePid, time.Now(), limit)
+	}
+	var video model.Video
+	videos, err := video.ListTopBrowse(typePid, limit)
+	if err != nil {
+		return nil, err
+	}
+	scores := make([]Score, 0, len(videos))
+	for _, v := range videos {
+		scores = append(scores, Score{VideoId: v.Id, Views: int64(v.Browse)})
+	}
+	return scores, nil
+}
+
+// ClientId 由客户端 IP 和 User-Agent 生成去重用的标识
+func ClientId(ip string, userAgent string) string {
+	sum := sha256.Sum256([]byte(ip + "\x00" + userAgent))
+	return hex.EncodeToString(sum[:12])
+}
+
+// dayKey 日排行按本地日期分桶
+func dayKey(at time.Time) string {
+	return at.Format("20060102")
+}
+
+// periodDays 返回周期包含的日期，day 为当天，week 为最近 7 天
+func periodDays(period string, at time.Time) []string {
+	n := 1
+	if period == PeriodWeek {
+		n = 7
+	}
+	days := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		days = append(days, dayKey(at.AddDate(0, 0, -i)))
+	}
+	return days
+}
@@ -0,0 +1,138 @@
+package views
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"video/config"
+	"video/model"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+type fakeWriter struct {
+	err    error
+	counts map[int64]int64
+}
+
+func (that *fakeWriter) AddBrowse(ctx context.Context, counts map[int64]int64) error {
+	if that.err != nil {
+		return that.err
+	}
+	if that.counts == nil {
+		that.counts = make(map[int64]int64)
+	}
+	for id, n := range counts {
+		that.counts[id] += n
+	}
+	return nil
+}
+
+// testStores 同一组用例分别在进程内和 Redis 实现上运行
+func testStores(t *testing.T) map[string]func(t *testing.T) (Store, *miniredis.Miniredis) {
+	return map[string]func(t *testing.T) (Store, *miniredis.Miniredis){
+		"memory": func(t *testing.T) (Store, *miniredis.Miniredis) {
+			return NewMemoryStore(), nil
+		},
+		"redis": func(t *testing.T) (Store, *miniredis.Miniredis) {
+			server := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+			t.Cleanup(func() { client.Close() })
+			return NewRedisStore(client, ""), server
+		},
+	}
+}
+
+func TestCounterDedupAndFlush(t *testing.T) {
+	for name, newStore := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			store, _ := newStore(t)
+			writer := &fakeWriter{}
+			counter := New(config.Views{DedupWindow: 60}, store, writer)
+			ctx := context.Background()
+			a := &model.Video{Id: 1, TypePid: 1}
+			b := &model.Video{Id: 2, TypePid: 2}
+
+			for _, client := range []string{"c1", "c1", "c2"} {
+				counter.Record(ctx, a, client)
+			}
+			if counted, err := counter.Record(ctx, b, "c1"); err != nil || !counted {
+				t.Fatalf("Record other video = %v, %v", counted, err)
+			}
+			if n, err := counter.Flush(ctx); err != nil || n != 2 {
+				t.Fatalf("Flush = %d, %v", n, err)
+			}
+			if writer.counts[1] != 2 || writer.counts[2] != 1 {
+				t.Fatalf("written = %v", writer.counts)
+			}
+			if n, _ := counter.Flush(ctx); n != 0 {
+				t.Errorf("second Flush = %d, want 0", n)
+			}
+
+			// 写库失败时浏览数加回，下次写入
+			counter.Record(ctx, a, "c3")
+			writer.err = errors.New("db down")
+			if _, err := counter.Flush(ctx); err == nil {
+				t.Fatal("expected flush error")
+			}
+			writer.err = nil
+			counter.Record(ctx, a, "c4")
+			if n, err := counter.Flush(ctx); err != nil || n != 1 || writer.counts[1] != 4 {
+				t.Errorf("Flush after failure = %d, %v, written %v", n, err, writer.counts)
+			}
+		})
+	}
+}
+
+func TestStoreTop(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	for name, newStore := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			store, _ := newStore(t)
+			ctx := context.Background()
+			incr := func(videoId, typePid int64, at time.Time, n int) {
+				for i := 0; i < n; i++ {
+					if err := store.Incr(ctx, videoId, typePid, at); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			incr(1, 1, now, 2)
+			incr(2, 1, now, 1)
+			incr(3, 2, now, 3)
+			incr(2, 1, now.AddDate(0, 0, -3), 5)
+			incr(1, 1, now.AddDate(0, 0, -7), 10) // 超出周排行范围
+
+			day, err := store.Top(ctx, PeriodDay, 1, now, 10)
+			if err != nil || len(day) != 2 || day[0] != (Score{VideoId: 1, Views: 2}) || day[1] != (Score{VideoId: 2, Views: 1}) {
+				t.Fatalf("day top = %v, %v", day, err)
+			}
+			week, err := store.Top(ctx, PeriodWeek, 1, now, 10)
+			if err != nil || len(week) != 2 || week[0] != (Score{VideoId: 2, Views: 6}) || week[1] != (Score{VideoId: 1, Views: 2}) {
+				t.Fatalf("week top = %v, %v", week, err)
+			}
+			all, err := store.Top(ctx, PeriodDay, 0, now, 1)
+			if err != nil || len(all) != 1 || all[0] != (Score{VideoId: 3, Views: 3}) {
+				t.Fatalf("all types top = %v, %v", all, err)
+			}
+		})
+	}
+}
+
+func TestRedisDedupWindow(t *testing.T) {
+	store, server := testStores(t)["redis"](t)
+	ctx := context.Background()
+	if seen, _ := store.Seen(ctx, 1, "c1", time.Minute); !seen {
+		t.Fatal("first view not counted")
+	}
+	if seen, _ := store.Seen(ctx, 1, "c1", time.Minute); seen {
+		t.Fatal("repeat view counted")
+	}
+	server.FastForward(2 * time.Minute)
+	if seen, _ := store.Seen(ctx, 1, "c1", time.Minute); !seen {
+		t.Error("view after window not counted")
+	}
+}
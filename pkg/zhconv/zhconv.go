@@ -0,0 +1,52 @@
+// Package zhconv 繁体转简体，用于生成标题、别名、分类名称的检索形式，原文仍按来源保存和展示。
+//
+// t2s.txt 每行为一个繁体字及其简体字，覆盖 U+3400 - U+9FFF，由 ICU 的 Traditional-Simplified 转换逐字生成
+// (uconv -x Traditional-Simplified)，转换前后都是 3 字节的 UTF-8 字符。简体中也常用的字(乾、著、藉、夥等)不在表中，避免 "乾隆" 检索为 "干隆"。
+package zhconv
+
+import (
+	_ "embed"
+	"strings"
+	"sync"
+)
+
+//go:embed t2s.txt
+var data string
+
+var loadTable = sync.OnceValue(func() map[rune]rune {
+	table := make(map[rune]rune, 3000)
+	for _, line := range strings.Split(data, "\n") {
+		chars := []rune(line)
+		if len(chars) != 2 {
+			continue
+		}
+		table[chars[0]] = chars[1]
+	}
+	return table
+})
+
+// Table 繁体字到简体字的映射表，调用方不能修改
+func Table() map[rune]rune {
+	return loadTable()
+}
+
+// Simplify 把 s 中的繁体字逐字转换为简体，其它字符不变，如 "中國電視劇" 返回 "中国电视剧"
+func Simplify(s string) string {
+	table := loadTable()
+	for i, r := range s {
+		if _, ok := table[r]; ok {
+			// 第一个繁体字之前的部分原样保留
+			var b strings.Builder
+			b.Grow(len(s))
+			b.WriteString(s[:i])
+			for _, r := range s[i:] {
+				if simplified, ok := table[r]; ok {
+					r = simplified
+				}
+				b.WriteRune(r)
+			}
+			return b.String()
+		}
+	}
+	return s
+}
@@ -0,0 +1,23 @@
+package zhconv
+
+import "testing"
+
+func TestSimplify(t *testing.T) {
+	cases := map[string]string{
+		"中國":         "中国",
+		"中国":         "中国",
+		"電視劇 第2季":    "电视剧 第2季",
+		"臺灣":         "台湾",
+		"後來的我們":      "后来的我们",
+		"乾隆王朝":       "乾隆王朝",
+		"著名":         "著名",
+		"The Matrix": "The Matrix",
+		"":           "",
+		"愛情公寓(Love)": "爱情公寓(Love)",
+	}
+	for s, want := range cases {
+		if got := Simplify(s); got != want {
+			t.Errorf("Simplify(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
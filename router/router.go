@@ -2,8 +2,12 @@ package router
 
 import (
 	"video/controller"
+	"video/controller/account"
 	"video/controller/category"
+	"video/controller/play"
 	"video/controller/videoClass"
+	"video/middlewares"
+	"video/pkg/auth"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,12 +24,34 @@ type ApiRouter struct {
 
 func (that *ApiRouter) InitApiRouter(Router *gin.RouterGroup) {
 	that.Router = Router
+	authService := auth.Default()
+	videoWrite := middlewares.Auth(authService, auth.ScopeVideoWrite)
+	videoDelete := middlewares.Auth(authService, auth.ScopeVideoDelete)
 	apiRouter := Router.Group("/v1").Group("/video")
 	{
-		apiRouter.POST("/create", controller.Create) //
-		apiRouter.POST("/update", controller.Update) //
-		apiRouter.GET("/list", controller.List)      //
-		apiRouter.GET("/get", controller.Get)        //
+		apiRouter.POST("/create", videoWrite, controller.Create)    //
+		apiRouter.POST("/update", videoWrite, controller.Update)    //
+		apiRouter.POST("/bulk", videoWrite, controller.Bulk)        // 批量入库，JSON 数组或 NDJSON
+		apiRouter.POST("/delete", videoDelete, controller.Delete)   // 级联软删除
+		apiRouter.POST("/restore", videoDelete, controller.Restore) // 恢复删除
+		apiRouter.GET("/list", controller.List)                     //
+		apiRouter.GET("/get", controller.Get)                       //
+		apiRouter.GET("/rank", controller.Rank)                     // 浏览排行 period=day|week|all
+	}
+
+	authRouter := that.Router.Group("/v1").Group("/auth")
+	{
+		authRouter.POST("/token", account.Token)     // 账号密码登录
+		authRouter.POST("/refresh", account.Refresh) // 刷新 token
+		keyAdmin := middlewares.Auth(authService, auth.ScopeApiKey)
+		authRouter.POST("/keys", keyAdmin, account.CreateKey)        // 创建 API key
+		authRouter.GET("/keys", keyAdmin, account.ListKeys)          //
+		authRouter.POST("/keys/revoke", keyAdmin, account.RevokeKey) // 吊销 API key
+	}
+
+	searchRouter := that.Router.Group("/v1").Group("/search")
+	{
+		searchRouter.GET("/suggest", controller.Suggest) // 输入提示，支持拼音前缀
 	}
 
 	categoryRouter := that.Router.Group("/v1").Group("/category")
@@ -37,4 +63,11 @@ func (that *ApiRouter) InitApiRouter(Router *gin.RouterGroup) {
 	{
 		videoClassRouter.GET("/list", videoClass.List) //
 	}
+
+	playRouter := that.Router.Group("/v1").Group("/play")
+	{
+		playRouter.GET("/m3u8", play.M3u8)              // 去除插播
+		playRouter.GET("/segment", play.Segment)        // 缓存分片
+		playRouter.GET("/cache/stats", play.CacheStats) // 缓存命中统计
+	}
 }